@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/idexter/golang-lc3-vm/apps"
+)
+
+const appsUsage = "Usage: golang-lc3-vm apps list | apps run [run flags] name"
+
+// appsCommand lists and runs the programs built into the binary.
+func appsCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, appsUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help":
+		fmt.Println(appsUsage)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, a := range apps.List {
+			fmt.Fprintf(w, "%s\t%s\n", a.Name, a.Description)
+		}
+		_ = w.Flush()
+	case "run":
+		runProgram("apps run", args[1:], apps.FS, func(name string) string {
+			a, ok := apps.Find(name)
+			if !ok {
+				log.Fatalf("Unknown program %s, \"golang-lc3-vm apps list\" lists the programs", name)
+			}
+			return a.File()
+		})
+	default:
+		fmt.Fprintln(os.Stderr, appsUsage)
+		os.Exit(2)
+	}
+}
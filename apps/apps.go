@@ -0,0 +1,45 @@
+// Package apps embeds sample programs into the binary. The sources of the demos are in the
+// src directory.
+package apps
+
+import (
+	"embed"
+	"strings"
+)
+
+// FS holds the object files of the programs.
+//
+//go:embed *.obj
+var FS embed.FS
+
+// App is an embedded program.
+type App struct {
+	Name        string
+	Description string
+}
+
+// File returns the name of the object file of the program in FS.
+func (a App) File() string {
+	return a.Name + ".obj"
+}
+
+// List lists the embedded programs.
+var List = []App{
+	{Name: "hello-world", Description: "prints a greeting"},
+	{Name: "2048", Description: "the 2048 sliding tile puzzle"},
+	{Name: "rogue", Description: "a tiny dungeon crawler"},
+	{Name: "primes", Description: "the sieve of Eratosthenes, compiled from src/primes.c"},
+	{Name: "hanoi", Description: "the towers of Hanoi solved recursively, compiled from src/hanoi.c"},
+	{Name: "caps", Description: "echoes a line of input in upper case, assembled from src/caps.asm"},
+}
+
+// Find returns the program with the name, a trailing .obj is ignored.
+func Find(name string) (App, bool) {
+	name = strings.TrimSuffix(name, ".obj")
+	for _, a := range List {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return App{}, false
+}
@@ -0,0 +1,63 @@
+package apps
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/cc"
+	"github.com/idexter/golang-lc3-vm/lc3test"
+)
+
+func TestList(t *testing.T) {
+	for _, a := range List {
+		b, err := fs.ReadFile(FS, a.File())
+		assert.Nil(t, err, a.Name)
+		assert.NotEmpty(t, b, a.Name)
+	}
+
+	a, ok := Find("2048.obj")
+	assert.True(t, ok)
+	assert.Equal(t, "2048", a.Name)
+	_, ok = Find("missing")
+	assert.False(t, ok)
+}
+
+// TestDemos checks that the object files are built from the current sources.
+func TestDemos(t *testing.T) {
+	for _, d := range []struct {
+		app, src string
+		build    func(string, []byte) (*asm.Program, error)
+	}{
+		{"primes", "src/primes.c", cc.Build},
+		{"hanoi", "src/hanoi.c", cc.Build},
+		{"caps", "src/caps.asm", asm.Assemble},
+	} {
+		src, err := ioutil.ReadFile(d.src)
+		assert.Nil(t, err)
+		p, err := d.build(d.src, src)
+		if !assert.Nil(t, err, d.src) {
+			continue
+		}
+		a, ok := Find(d.app)
+		assert.True(t, ok, d.app)
+		want, err := fs.ReadFile(FS, a.File())
+		assert.Nil(t, err)
+		assert.Equal(t, want, p.Object(), "%s is outdated", a.File())
+	}
+}
+
+func TestApps_output(t *testing.T) {
+	image := func(name string) []byte {
+		b, err := fs.ReadFile(FS, name)
+		assert.Nil(t, err)
+		return b
+	}
+	lc3test.Image(t, image("hello-world.obj")).Run().ExpectOutput("Hello World!")
+	assert.Contains(t, lc3test.Image(t, image("primes.obj")).Run().Output(), "2 3 5 7 11 13 ")
+	assert.Contains(t, lc3test.Image(t, image("hanoi.obj")).Run().Output(), "Done in 7 moves\n")
+	lc3test.Image(t, image("caps.obj")).Input("Hello, World\n").Run().ExpectOutput("Type a line: HELLO, WORLD\n")
+}
@@ -0,0 +1,23 @@
+; Echoes a line of input in upper case.
+        .ORIG x3000
+        LEA R0, PROMPT
+        PUTS
+        LD R2, MINUS_A          ; -'a'
+        LD R3, LOWER_UPPER      ; 'A' - 'a'
+LOOP    GETC
+        ADD R1, R0, #-10        ; stop at the end of the line
+        BRz DONE
+        ADD R1, R0, R2          ; lower case letters are 'a' to 'a'+25
+        BRn PRINT
+        ADD R1, R1, #-16
+        ADD R1, R1, #-10
+        BRzp PRINT
+        ADD R0, R0, R3
+PRINT   OUT
+        BRnzp LOOP
+DONE    OUT
+        HALT
+PROMPT      .STRINGZ "Type a line: "
+MINUS_A     .FILL #-97
+LOWER_UPPER .FILL #-32
+        .END
@@ -0,0 +1,25 @@
+// Solves the towers of Hanoi, recursively.
+
+int moves = 0;
+
+void move(int disks, int from, int to, int via) {
+    if (disks == 0) return;
+    move(disks - 1, from, via, to);
+    puts("Move disk ");
+    putc('0' + disks);
+    puts(" from ");
+    putc('A' + from);
+    puts(" to ");
+    putc('A' + to);
+    putc('\n');
+    moves = moves + 1;
+    move(disks - 1, via, to, from);
+}
+
+int main() {
+    move(3, 0, 2, 1);
+    puts("Done in ");
+    putc('0' + moves);
+    puts(" moves\n");
+    return 0;
+}
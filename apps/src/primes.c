@@ -0,0 +1,36 @@
+// Prints the prime numbers below 200 with the sieve of Eratosthenes.
+
+int composite[200];
+
+void print(int n) {
+    int digits[5];
+    int i = 0;
+    while (1) {
+        digits[i] = n % 10;
+        i = i + 1;
+        n = n / 10;
+        if (n == 0) break;
+    }
+    while (i > 0) {
+        i = i - 1;
+        putc('0' + digits[i]);
+    }
+}
+
+int main() {
+    int n = 2;
+    while (n < 200) {
+        if (!composite[n]) {
+            int m = n + n;
+            print(n);
+            putc(' ');
+            while (m < 200) {
+                composite[m] = 1;
+                m = m + n;
+            }
+        }
+        n = n + 1;
+    }
+    putc('\n');
+    return 0;
+}
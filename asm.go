@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// asmCommand assembles a source file into an object file and its debug information, or
+// into a relocatable module.
+func asmCommand(args []string) {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	output := flags.String("o", "", "write the output to `file`, defaults to the source with .obj or .rel extension")
+	module := flags.Bool("c", false, "write a relocatable module for the linker instead of an object file")
+	debugInfo := flags.Bool("debug-info", true, "write debug information next to the object file")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm asm [-c] [-o file] [--debug-info=false] source.asm")
+		os.Exit(2)
+	}
+	source := flags.Arg(0)
+	src, err := ioutil.ReadFile(source) //nolint: gosec
+	if err != nil {
+		log.Fatalf("Can't read source: %v", err)
+	}
+	p := assemble(source, src)
+
+	if *module {
+		if *output == "" {
+			*output = strings.TrimSuffix(source, filepath.Ext(source)) + ".rel"
+		}
+		b, err := p.Module(source).MarshalBinary()
+		if err != nil {
+			log.Fatalf("Can't encode module: %v", err)
+		}
+		if err := ioutil.WriteFile(*output, b, 0o644); err != nil { //nolint: gosec
+			log.Fatalf("Can't write module: %v", err)
+		}
+		return
+	}
+
+	if len(p.Relocations) > 0 {
+		log.Fatalf("%s refers to relocatable sections or other modules, assemble it with -c and link it", source)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(source, filepath.Ext(source)) + ".obj"
+	}
+	if err := ioutil.WriteFile(*output, p.Object(), 0o644); err != nil { //nolint: gosec
+		log.Fatalf("Can't write object file: %v", err)
+	}
+	if *debugInfo {
+		writeFile(vm.DebugInfoPath(*output), func(w io.Writer) error { return p.Debug().WriteJSON(w) })
+	}
+}
+
+// assemble assembles a source file, errors and warnings are printed with their source lines.
+func assemble(path string, src []byte) *asm.Program {
+	p, err := asm.Assemble(path, src)
+	if errs, ok := err.(asm.ErrorList); ok {
+		log.Fatalf("Can't assemble %s:\n%s", path, errs.Detail())
+	}
+	if err != nil {
+		log.Fatalf("Can't assemble %s: %v", path, err)
+	}
+	if len(p.Warnings) > 0 {
+		fmt.Fprintln(os.Stderr, p.Warnings.Detail())
+	}
+	return p
+}
@@ -0,0 +1,536 @@
+// Package asm assembles LC-3 assembly language into object files loadable by vm.LC3RAM.
+package asm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/link"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// Pos is a position in a source file, Column is 0 when the whole line is meant.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	if p.Column == 0 {
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Error is an assembly error or warning.
+type Error struct {
+	Pos Pos
+	Msg string
+	// Expanded lists the macro invocations Pos was expanded from, innermost first.
+	Expanded []Pos
+	// Warning is set for problems which don't stop the assembly.
+	Warning bool
+	// Source is the text of the line at Pos, Detail shows it.
+	Source string
+}
+
+func (e *Error) Error() string {
+	return e.format(false)
+}
+
+// Detail formats the error like Error and adds the source line with a caret under the column.
+func (e *Error) Detail() string {
+	return e.format(true)
+}
+
+func (e *Error) format(detail bool) string {
+	var b strings.Builder
+	b.WriteString(e.Pos.String())
+	if e.Warning {
+		b.WriteString(": warning")
+	}
+	b.WriteString(": " + e.Msg)
+	if detail && e.Source != "" {
+		b.WriteString("\n\t" + e.Source)
+		if e.Pos.Column > 0 {
+			b.WriteString("\n\t" + caret(e.Source, e.Pos.Column))
+		}
+	}
+	for _, p := range e.Expanded {
+		b.WriteString("\n\texpanded from " + p.String())
+	}
+	return b.String()
+}
+
+// caret returns a line with a ^ under the column of line, tabs are kept so the caret lines up.
+func caret(line string, column int) string {
+	var b strings.Builder
+	for i := 0; i < column-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// ErrorList is the list of all errors of a source file.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Detail formats the errors with their source lines, see Error.Detail.
+func (l ErrorList) Detail() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Detail()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Section is a block of words starting at an .ORIG address, or a relocatable .SECTION
+// which has a name and is placed by the linker.
+type Section struct {
+	Name   string
+	Origin uint16
+	Words  []uint16
+}
+
+// Program is an assembled program.
+type Program struct {
+	Sections []Section
+	// Symbols are the label addresses, labels of relocatable sections have their offset
+	// from the start of the section.
+	Symbols map[string]uint16
+	// Globals are the labels exported by .GLOBAL, Externs the labels of other modules
+	// imported by .EXTERN. Relocations are the references the linker has to resolve.
+	Globals     []string
+	Externs     []string
+	Relocations []link.Relocation
+	// Warnings are problems which didn't stop the assembly.
+	Warnings ErrorList
+
+	sectionOf map[string]int // section index of the labels
+	stmts     []*statement
+}
+
+// Object returns the program in the object file format, an origin word followed by the
+// words of the program. Sections are placed at their addresses, gaps are filled with zeros.
+// Programs with relocations have to be linked instead, see Module.
+func (p *Program) Object() []byte {
+	if len(p.Sections) == 0 {
+		return []byte{0, 0}
+	}
+	start, end := 0x10000, 0
+	for _, s := range p.Sections {
+		if int(s.Origin) < start {
+			start = int(s.Origin)
+		}
+		if e := int(s.Origin) + len(s.Words); e > end {
+			end = e
+		}
+	}
+	words := make([]uint16, end-start)
+	for _, s := range p.Sections {
+		copy(words[int(s.Origin)-start:], s.Words)
+	}
+
+	b := make([]byte, 2+2*len(words))
+	binary.BigEndian.PutUint16(b, uint16(start))
+	for i, w := range words {
+		binary.BigEndian.PutUint16(b[2+2*i:], w)
+	}
+	return b
+}
+
+// Labels returns the labels of the program ordered by address.
+func (p *Program) Labels() []string {
+	labels := make([]string, 0, len(p.Symbols))
+	for l := range p.Symbols {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if p.Symbols[labels[i]] != p.Symbols[labels[j]] {
+			return p.Symbols[labels[i]] < p.Symbols[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+	return labels
+}
+
+// Module returns the program as a relocatable module for the linker, name is used in its
+// error messages.
+func (p *Program) Module(name string) *link.Module {
+	m := &link.Module{Name: name, Imports: p.Externs, Relocations: p.Relocations}
+	for _, s := range p.Sections {
+		m.Sections = append(m.Sections, link.Section(s))
+	}
+	exported := map[string]bool{}
+	for _, label := range p.Globals {
+		exported[label] = true
+	}
+	for _, label := range p.Labels() {
+		section := p.sectionOf[label]
+		m.Symbols = append(m.Symbols, link.Symbol{
+			Name:     label,
+			Section:  section,
+			Offset:   p.Symbols[label] - p.Sections[section].Origin,
+			Exported: exported[label],
+		})
+	}
+	return m
+}
+
+// Debug returns the debug information of the program. Only absolute sections are
+// described, relocatable sections have no addresses before they are linked.
+func (p *Program) Debug() *vm.DebugInfo {
+	d := &vm.DebugInfo{Object: crc32.ChecksumIEEE(p.Object())}
+	files := map[string]int{}
+	for _, s := range p.stmts {
+		if p.Sections[s.section].Name != "" {
+			continue
+		}
+		file, ok := files[s.pos.File]
+		if !ok {
+			file = len(d.Files)
+			files[s.pos.File] = file
+			d.Files = append(d.Files, s.pos.File)
+		}
+		d.Lines = append(d.Lines, vm.DebugLine{
+			Address: s.address,
+			Size:    s.words,
+			File:    file,
+			Line:    s.pos.Line,
+			Column:  s.op.column,
+			Text:    s.text(),
+		})
+		switch s.name {
+		case ".FILL", ".BLKW", ".STRINGZ":
+			d.Data = append(d.Data, vm.DebugRegion{Address: s.address, Size: s.words, Kind: s.name})
+		}
+	}
+	sort.SliceStable(d.Lines, func(i, j int) bool { return d.Lines[i].Address < d.Lines[j].Address })
+	for _, label := range p.Labels() {
+		if p.Sections[p.sectionOf[label]].Name == "" {
+			d.Labels = append(d.Labels, vm.DebugLabel{Name: label, Address: p.Symbols[label]})
+		}
+	}
+	return d
+}
+
+// statement is a parsed source line.
+type statement struct {
+	pos      Pos
+	expanded []Pos
+	label    *token
+	op       *token // opcode or directive, nil for lines with only a label
+	name     string // upper cased op
+	args     []token
+	section  int
+	address  uint16
+	words    int
+}
+
+// global is a label exported by .GLOBAL.
+type global struct {
+	label    string
+	pos      Pos
+	expanded []Pos
+}
+
+type assembler struct {
+	errors      ErrorList
+	warnings    ErrorList
+	files       map[string][]string // source lines by file name
+	fileOrder   map[string]int      // in which the files were read
+	labelPos    map[string]Pos
+	symbols     map[string]uint16
+	sectionOf   map[string]int
+	sections    []Section
+	stmts       []*statement
+	expanded    []Pos        // macro invocations of the line being assembled
+	starts      []*statement // .ORIG and .SECTION statements of the sections
+	globals     []global
+	externs     map[string]bool
+	externList  []string
+	relocations []link.Relocation
+}
+
+// Assemble assembles the source of file. The error is an ErrorList with every error found.
+//
+// The source is preprocessed first:
+//
+//	.INCLUDE "file.asm"      ; assembles file.asm here, relative to the directory of file
+//	.DEFINE NAME VALUE...    ; replaces NAME by VALUE in the following lines
+//	.IF VALUE [OP VALUE]     ; OP is one of == != < <= > >=
+//	.IFDEF NAME / .IFNDEF NAME
+//	.ELSE / .ENDIF
+//	.MACRO NAME PARAM...     ; defines an instruction expanding to the lines up to .ENDM
+//	.ENDM
+//
+// Labels starting with @ in the body of a macro are local to each invocation.
+//
+// Programs split into modules use relocatable sections, which are linked with the link package:
+//
+//	.SECTION NAME            ; starts a section placed by the linker, it ends with .END
+//	.GLOBAL LABEL...         ; exports labels to other modules
+//	.EXTERN LABEL...         ; imports labels of other modules
+func Assemble(file string, src []byte) (*Program, error) {
+	a := &assembler{
+		symbols:   map[string]uint16{},
+		sectionOf: map[string]int{},
+		externs:   map[string]bool{},
+		files:     map[string][]string{},
+		fileOrder: map[string]int{},
+		labelPos:  map[string]Pos{},
+	}
+	a.layout(a.preprocess(file, src))
+	if len(a.errors) == 0 {
+		for _, s := range a.stmts {
+			a.expanded = s.expanded
+			sec := &a.sections[s.section]
+			sec.Words = append(sec.Words, a.encode(s)...)
+		}
+	}
+	if len(a.errors) == 0 {
+		a.checkFlow()
+	}
+	// Warnings of the passes are mixed, report them in source order
+	sort.SliceStable(a.warnings, func(i, j int) bool {
+		p, q := a.warnings[i].Pos, a.warnings[j].Pos
+		if p.File != q.File {
+			return a.fileOrder[p.File] < a.fileOrder[q.File]
+		}
+		if p.Line != q.Line {
+			return p.Line < q.Line
+		}
+		return p.Column < q.Column
+	})
+	if len(a.errors) > 0 {
+		return nil, a.errors
+	}
+	p := &Program{
+		Sections:    a.sections,
+		Symbols:     a.symbols,
+		Externs:     a.externList,
+		Relocations: a.relocations,
+		Warnings:    a.warnings,
+		sectionOf:   a.sectionOf,
+		stmts:       a.stmts,
+	}
+	for _, g := range a.globals {
+		p.Globals = append(p.Globals, g.label)
+	}
+	return p, nil
+}
+
+func (a *assembler) errorf(pos Pos, format string, args ...interface{}) {
+	a.errors = append(a.errors, a.diagnostic(pos, format, args...))
+}
+
+func (a *assembler) warnf(pos Pos, format string, args ...interface{}) {
+	w := a.diagnostic(pos, format, args...)
+	w.Warning = true
+	a.warnings = append(a.warnings, w)
+}
+
+func (a *assembler) diagnostic(pos Pos, format string, args ...interface{}) *Error {
+	e := &Error{Pos: pos, Msg: fmt.Sprintf(format, args...), Expanded: a.expanded}
+	if lines := a.files[pos.File]; pos.Line > 0 && pos.Line <= len(lines) {
+		e.Source = strings.TrimRight(lines[pos.Line-1], "\r")
+	}
+	return e
+}
+
+// text returns the statement without label and comment, as in "ADD R1, R1, #-1".
+func (s *statement) text() string {
+	args := make([]string, len(s.args))
+	for i, t := range s.args {
+		args[i] = t.text
+		if t.str {
+			args[i] = strconv.Quote(t.text)
+		}
+	}
+	if len(args) == 0 {
+		return s.op.text
+	}
+	return s.op.text + " " + strings.Join(args, ", ")
+}
+
+// at returns the position of t in the line of s.
+func (s *statement) at(t token) Pos {
+	p := s.pos
+	p.Column = t.column
+	return p
+}
+
+// layout parses the lines, assigns addresses to statements and defines the labels.
+func (a *assembler) layout(lines []line) {
+	pc, inSection := 0, false
+	for _, l := range lines {
+		a.expanded = l.expanded
+		s := a.parse(l)
+		if s == nil {
+			continue
+		}
+
+		switch s.name {
+		case ".ORIG", ".SECTION":
+			if s.label != nil {
+				a.errorf(s.at(*s.label), "label on %s", s.name)
+			}
+			section, ok := a.section(s)
+			if !ok {
+				continue
+			}
+			pc, inSection = int(section.Origin), true
+			a.sections = append(a.sections, section)
+			a.starts = append(a.starts, s)
+			continue
+		case ".GLOBAL", ".EXTERN":
+			a.declare(s)
+			continue
+		case ".END":
+			if !inSection {
+				a.errorf(s.pos, ".END without .ORIG")
+			}
+			inSection = false
+			continue
+		}
+		if !inSection {
+			a.errorf(s.pos, "statement outside of .ORIG and .END")
+			continue
+		}
+
+		if s.label != nil {
+			a.define(s, pc)
+		}
+		if s.op == nil {
+			continue
+		}
+		s.section, s.address, s.words = len(a.sections)-1, uint16(pc), a.size(s)
+		a.stmts = append(a.stmts, s)
+		pc += s.words
+		if pc > 0x10000 {
+			a.errorf(s.pos, "program exceeds memory end xFFFF")
+			return
+		}
+	}
+
+	for _, g := range a.globals {
+		if _, ok := a.symbols[g.label]; !ok {
+			a.expanded = g.expanded
+			a.errorf(g.pos, "undefined label %s", g.label)
+		}
+	}
+	a.checkOverlaps()
+}
+
+// section starts the section of an .ORIG or .SECTION statement.
+func (a *assembler) section(s *statement) (Section, bool) {
+	if s.name == ".ORIG" {
+		origin, ok := a.number(s, 0, 0, 0xFFFF)
+		return Section{Origin: uint16(origin)}, ok
+	}
+	if !a.args(s, 1) {
+		return Section{}, false
+	}
+	if t := s.args[0]; t.str || !isLabel(t.text) {
+		a.errorf(s.at(t), "invalid section name %s", t.text)
+		return Section{}, false
+	}
+	return Section{Name: s.args[0].text}, true
+}
+
+// declare handles .GLOBAL and .EXTERN.
+func (a *assembler) declare(s *statement) {
+	if s.label != nil {
+		a.errorf(s.at(*s.label), "label on %s", s.name)
+	}
+	for _, t := range s.args {
+		if t.str || !isLabel(t.text) {
+			a.errorf(s.at(t), "invalid label %s", t.text)
+			continue
+		}
+		if s.name == ".GLOBAL" {
+			a.globals = append(a.globals, global{label: t.text, pos: s.at(t), expanded: s.expanded})
+			continue
+		}
+		if _, ok := a.symbols[t.text]; ok {
+			a.errorf(s.at(t), "label %s is defined and can't be .EXTERN", t.text)
+		} else if !a.externs[t.text] {
+			a.externs[t.text] = true
+			a.externList = append(a.externList, t.text)
+		}
+	}
+}
+
+// parse splits a line into label, op and arguments.
+func (a *assembler) parse(l line) *statement {
+	tokens := l.tokens
+	s := &statement{pos: l.pos, expanded: l.expanded}
+	if !isOp(tokens[0].text) {
+		t := tokens[0]
+		t.text = strings.TrimSuffix(t.text, ":")
+		if t.str || !isLabel(t.text) {
+			a.errorf(s.at(t), "unknown instruction %s", t.text)
+			return nil
+		}
+		s.label = &t
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 {
+		if !isOp(tokens[0].text) {
+			a.errorf(s.at(tokens[0]), "unknown instruction %s", tokens[0].text)
+			return nil
+		}
+		s.op, s.name, s.args = &tokens[0], strings.ToUpper(tokens[0].text), tokens[1:]
+	}
+	return s
+}
+
+func (a *assembler) define(s *statement, pc int) {
+	name := s.label.text
+	if _, ok := a.symbols[name]; ok {
+		a.errorf(s.at(*s.label), "label %s redefined, previous definition at %v", name, a.labelPos[name])
+		return
+	}
+	if a.externs[name] {
+		a.errorf(s.at(*s.label), "label %s is defined and can't be .EXTERN", name)
+		return
+	}
+	a.symbols[name] = uint16(pc)
+	a.sectionOf[name] = len(a.sections) - 1
+	a.labelPos[name] = s.at(*s.label)
+}
+
+// size returns the number of words a statement occupies.
+func (a *assembler) size(s *statement) int {
+	switch s.name {
+	case ".BLKW":
+		n, _ := a.number(s, 0, 1, 0xFFFF)
+		return n
+	case ".STRINGZ":
+		if !a.args(s, 1) {
+			return 0
+		}
+		if !s.args[0].str {
+			a.errorf(s.at(s.args[0]), ".STRINGZ needs a string")
+		}
+		return len(s.args[0].text) + 1
+	}
+	return 1
+}
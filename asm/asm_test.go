@@ -0,0 +1,267 @@
+package asm
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/link"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+func TestAssemble_helloWorld(t *testing.T) {
+	p, err := Assemble("hello.asm", []byte(`
+; Prints a greeting
+        .ORIG x3000
+        LEA R0, HELLO   ; address of the string
+        PUTS
+        HALT
+HELLO   .STRINGZ "Hello World!"
+        .END
+`))
+	assert.Nil(t, err)
+
+	want, err := ioutil.ReadFile("../apps/hello-world.obj")
+	assert.Nil(t, err)
+	assert.Equal(t, want, p.Object())
+	assert.Equal(t, map[string]uint16{"HELLO": 0x3003}, p.Symbols)
+}
+
+func TestAssemble_instructions(t *testing.T) {
+	p, err := Assemble("all.asm", []byte(`
+	.ORIG x3000
+START	ADD R1, R2, R3
+	add r1, r2, #-16
+	AND R7, R0, x0F
+	NOT R4, R5
+	BRnzp START
+	BRz #-1
+	BR NEXT
+NEXT:	JMP R3
+	RET
+	JSR START
+	JSRR R6
+	LD R0, DATA
+	LDI R1, DATA
+	LDR R2, R3, #-32
+	LEA R4, DATA
+	ST R5, DATA
+	STI R6, DATA
+	STR R7, R0, #31
+	TRAP x25
+	GETC
+	OUT
+	PUTS
+	IN
+	PUTSP
+	HALT
+	RTI
+DATA	.FILL START
+	.FILL #-1
+	.BLKW 2
+	.STRINGZ "a\"\n"
+	.END
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Section{{Origin: 0x3000, Words: []uint16{
+		0b0001_001_010_0_00_011,
+		0b0001_001_010_1_10000,
+		0b0101_111_000_1_01111,
+		0b1001_100_101_111111,
+		0b0000_111_111111011,
+		0b0000_010_111111111,
+		0b0000_111_000000000,
+		0b1100_000_011_000000,
+		0b1100_000_111_000000,
+		0b0100_1_11111110110,
+		0b0100_0_00_110_000000,
+		0b0010_000_000001110,
+		0b1010_001_000001101,
+		0b0110_010_011_100000,
+		0b1110_100_000001011,
+		0b0011_101_000001010,
+		0b1011_110_000001001,
+		0b0111_111_000_011111,
+		0xF025, 0xF020, 0xF021, 0xF022, 0xF023, 0xF024, 0xF025,
+		0x8000,
+		0x3000, 0xFFFF, 0, 0, 'a', '"', '\n', 0,
+	}}}, p.Sections)
+	assert.Equal(t, uint16(0x3007), p.Symbols["NEXT"])
+}
+
+func TestProgram_Object(t *testing.T) {
+	p, err := Assemble("sections.asm", []byte(`
+	.ORIG x3002
+	.FILL x2
+	.END
+	.ORIG x3000
+	.FILL x1
+	.END
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x30, 0x00, 0, 1, 0, 0, 0, 2}, p.Object())
+	assert.Equal(t, []byte{0, 0}, (&Program{}).Object())
+}
+
+func TestAssemble_errors(t *testing.T) {
+	for src, msg := range map[string]string{
+		"ADD R0, R0, #1":                                   "x.asm:1: statement outside of .ORIG and .END",
+		".ORIG x3000\nFOO R1":                              "x.asm:2:5: unknown instruction R1",
+		".ORIG x3000\nADD R0, R1":                          "x.asm:2:1: ADD expects 3 operands, got 2",
+		".ORIG x3000\nADD R0, R1, #16":                     "x.asm:2:13: #16 is out of range [-16, 15]",
+		".ORIG x3000\nLDR R0, R8, #0":                      "x.asm:2:9: expected register, got R8",
+		".ORIG x3000\nBR NOWHERE":                          "x.asm:2:4: undefined label NOWHERE",
+		".ORIG x3000\nA .FILL 1\nA .FILL 2":                "x.asm:3:1: label A redefined, previous definition at x.asm:2:1",
+		".ORIG x3000\n.STRINGZ \"abc":                      "x.asm:2:10: unterminated string",
+		".ORIG x3000\nLD R0, FAR\n.BLKW 300\nFAR":          "x.asm:2:8: label FAR is out of range: offset 300 doesn't fit 9 bits",
+		".ORIG xFFFF\n.BLKW 2":                             "x.asm:2: program exceeds memory end xFFFF",
+		".ORIG x3000\nTRAP x100":                           "x.asm:2:6: x100 is out of range [0, 255]",
+		".ORIG x3000\n.BLKW 4\n.END\n.ORIG x3002\n.FILL 1": "x.asm:4:1: section x3002-x3002 overlaps section x3000-x3003 of x.asm:1",
+	} {
+		_, err := Assemble("x.asm", []byte(src))
+		if assert.NotNil(t, err, src) {
+			assert.Equal(t, msg, err.Error(), src)
+		}
+	}
+
+	_, err := Assemble("x.asm", []byte(".ORIG x3000\nADD R9, R0, R0\nBR X\n"))
+	assert.Len(t, err, 2)
+}
+
+func TestProgram_Module(t *testing.T) {
+	main, err := Assemble("main.asm", []byte(`
+	.EXTERN PRINT
+	.GLOBAL MAIN
+	.SECTION text
+MAIN	JSR PRINT
+	LD R0, PTR
+	BR MAIN
+	.END
+	.SECTION data
+PTR	.FILL PRINT
+SELF	.FILL PTR
+	.END
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PRINT"}, main.Externs)
+	assert.Equal(t, []string{"MAIN"}, main.Globals)
+	assert.Equal(t, []uint16{0x4800, 0x2000, 0x0FFD}, main.Sections[0].Words)
+
+	lib, err := Assemble("lib.asm", []byte(`
+	.GLOBAL PRINT
+	.ORIG x4000
+PRINT	OUT
+	RET
+	.END
+`))
+	assert.Nil(t, err)
+
+	m := main.Module("main.asm")
+	assert.Equal(t, []link.Symbol{
+		{Name: "MAIN", Section: 0, Offset: 0, Exported: true},
+		{Name: "PTR", Section: 1, Offset: 0},
+		{Name: "SELF", Section: 1, Offset: 1},
+	}, m.Symbols)
+	assert.Equal(t, []link.Relocation{
+		{Section: 0, Offset: 0, Kind: link.PCOffset11, Symbol: "PRINT"},
+		{Section: 0, Offset: 1, Kind: link.PCOffset9, Symbol: "PTR"},
+		{Section: 1, Offset: 0, Kind: link.Word, Symbol: "PRINT"},
+		{Section: 1, Offset: 1, Kind: link.Word, Symbol: "PTR"},
+	}, m.Relocations)
+
+	script, err := link.ParseScript([]byte("text x3F00\ndata"))
+	assert.Nil(t, err)
+	img, err := link.Link([]*link.Module{m, lib.Module("lib.asm")}, script)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0x3F00), img.Origin)
+	assert.Equal(t, []uint16{0x48FF, 0x2001, 0x0FFD, 0x4000, 0x3F03}, img.Words[:5])
+	assert.Equal(t, []uint16{0xF021, 0xC1C0}, img.Words[0x100:])
+
+	for src, msg := range map[string]string{
+		".GLOBAL NOWHERE":                           "x.asm:1:9: undefined label NOWHERE",
+		".EXTERN A\n.ORIG x3000\nA .FILL 1":         "x.asm:3:1: label A is defined and can't be .EXTERN",
+		".SECTION \"text\"":                         "x.asm:1:10: invalid section name text",
+		".EXTERN FAR\n.ORIG x3000\nADD R0, R0, FAR": "x.asm:3:13: expected number, got FAR",
+	} {
+		_, err := Assemble("x.asm", []byte(src))
+		if assert.NotNil(t, err, src) {
+			assert.Equal(t, msg, err.Error(), src)
+		}
+	}
+}
+
+func TestProgram_Debug(t *testing.T) {
+	p, err := Assemble("hello.asm", []byte(`
+	.ORIG x3000
+MAIN	LEA R0, HELLO
+	PUTS
+	BRnzp MAIN
+HELLO	.STRINGZ "Hi"
+	.END
+	.SECTION text
+	RET
+	.END
+`))
+	assert.Nil(t, err)
+	d := p.Debug()
+	assert.Equal(t, crc32.ChecksumIEEE(p.Object()), d.Object)
+	assert.Equal(t, []string{"hello.asm"}, d.Files)
+	assert.Equal(t, []vm.DebugLine{
+		{Address: 0x3000, Size: 1, Line: 3, Column: 6, Text: "LEA R0, HELLO"},
+		{Address: 0x3001, Size: 1, Line: 4, Column: 2, Text: "PUTS"},
+		{Address: 0x3002, Size: 1, Line: 5, Column: 2, Text: "BRnzp MAIN"},
+		{Address: 0x3003, Size: 3, Line: 6, Column: 7, Text: `.STRINGZ "Hi"`},
+	}, d.Lines)
+	assert.Equal(t, []vm.DebugLabel{{Name: "MAIN", Address: 0x3000}, {Name: "HELLO", Address: 0x3003}}, d.Labels)
+	assert.Equal(t, []vm.DebugRegion{{Address: 0x3003, Size: 3, Kind: ".STRINGZ"}}, d.Data)
+	assert.Equal(t, "hello.asm:5: BRnzp MAIN", d.Location(0x3002))
+}
+
+func TestErrorList_Detail(t *testing.T) {
+	_, err := Assemble("x.asm", []byte(".ORIG x3000\n\tADD R0, R1, #16\n.MACRO M\n\tBR NOWHERE\n.ENDM\n  M\n.END"))
+	if assert.IsType(t, ErrorList{}, err) {
+		assert.Equal(t, "x.asm:2:14: #16 is out of range [-16, 15]\n"+
+			"\t\tADD R0, R1, #16\n"+
+			"\t\t            ^\n"+
+			"x.asm:4:5: undefined label NOWHERE\n"+
+			"\t\tBR NOWHERE\n"+
+			"\t\t   ^\n"+
+			"\texpanded from x.asm:6:3", err.(ErrorList).Detail())
+	}
+}
+
+func TestAssemble_warnings(t *testing.T) {
+	p, err := Assemble("x.asm", []byte(`
+	.ORIG x3000
+	BRz SKIP
+	HALT
+	ADD R0, R0, #1
+	ADD R0, R0, #1
+SKIP	JSR SUB
+	.FILL x12345
+	.FILL #-40000
+SUB	RET
+	.END
+	.ORIG x4000
+	TRAP x25
+	.END
+	.ORIG x5000
+	BR #-1
+	.BLKW 1
+	.END
+`))
+	assert.Nil(t, err)
+	var warnings []string
+	for _, w := range p.Warnings {
+		warnings = append(warnings, w.Error())
+	}
+	assert.Equal(t, []string{
+		"x.asm:5:2: warning: unreachable code",
+		"x.asm:7:6: warning: execution continues after the last instruction, HALT is missing",
+		"x.asm:8:8: warning: .FILL value 74565 doesn't fit 16 bits, truncated to x2345",
+		"x.asm:9:8: warning: .FILL value -40000 doesn't fit 16 bits, truncated to x63C0",
+	}, warnings)
+	assert.Equal(t, []uint16{0x2345, 0x63C0}, p.Sections[0].Words[5:7])
+}
@@ -0,0 +1,85 @@
+package asm
+
+// checkOverlaps reports .ORIG sections which share addresses, the later section is blamed.
+func (a *assembler) checkOverlaps() {
+	sizes := make([]int, len(a.sections))
+	for _, s := range a.stmts {
+		sizes[s.section] += s.words
+	}
+	for j, later := range a.sections {
+		if later.Name != "" || sizes[j] == 0 {
+			continue
+		}
+		for i, earlier := range a.sections[:j] {
+			if earlier.Name != "" || sizes[i] == 0 {
+				continue
+			}
+			start, end := int(later.Origin), int(later.Origin)+sizes[j]
+			otherStart, otherEnd := int(earlier.Origin), int(earlier.Origin)+sizes[i]
+			if start < otherEnd && otherStart < end {
+				a.expanded = a.starts[j].expanded
+				a.errorf(a.starts[j].at(*a.starts[j].op), "section x%04X-x%04X overlaps section x%04X-x%04X of %v",
+					start, end-1, otherStart, otherEnd-1, a.starts[i].pos)
+			}
+		}
+	}
+}
+
+// checkFlow warns about instructions which can't be reached because they follow an
+// unconditional jump and have no label, and about code which runs into data or past the
+// end of its section because it doesn't end with HALT, RET or a jump.
+func (a *assembler) checkFlow() {
+	labeled := map[int]map[uint16]bool{}
+	for name, address := range a.symbols {
+		section := a.sectionOf[name]
+		if labeled[section] == nil {
+			labeled[section] = map[uint16]bool{}
+		}
+		labeled[section][address] = true
+	}
+
+	reachable := true
+	for i, s := range a.stmts {
+		if i == 0 || s.section != a.stmts[i-1].section || labeled[s.section][s.address] {
+			reachable = true
+		}
+		if isData(s) {
+			continue
+		}
+		a.expanded = s.expanded
+		if !reachable {
+			a.warnf(s.at(*s.op), "unreachable code")
+			// Once per block of unreachable code
+			reachable = true
+		}
+		if stops(s) {
+			reachable = false
+			continue
+		}
+		if next := i + 1; next == len(a.stmts) || a.stmts[next].section != s.section || isData(a.stmts[next]) {
+			a.warnf(s.at(*s.op), "execution continues after the last instruction, HALT is missing")
+		}
+	}
+}
+
+// isData reports whether a statement reserves data instead of encoding an instruction.
+func isData(s *statement) bool {
+	switch s.name {
+	case ".FILL", ".BLKW", ".STRINGZ":
+		return true
+	}
+	return false
+}
+
+// stops reports whether an instruction never continues with the next one.
+func stops(s *statement) bool {
+	switch s.name {
+	case "JMP", "RET", "RTI", "HALT":
+		return true
+	case "TRAP":
+		v, ok := parseNumber(s.args[0].text)
+		return ok && v == 0x25
+	}
+	nzp, ok := parseBranch(s.name)
+	return ok && nzp == 0x7
+}
@@ -0,0 +1,265 @@
+package asm
+
+import (
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/link"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// memoryOps are the instructions with a register and a PCoffset9 operand.
+var memoryOps = map[string]uint16{"LD": vm.OP_LD, "LDI": vm.OP_LDI, "LEA": vm.OP_LEA, "ST": vm.OP_ST, "STI": vm.OP_STI}
+
+// trapAliases are the names of the trap service routines.
+var trapAliases = map[string]uint16{"GETC": 0x20, "OUT": 0x21, "PUTS": 0x22, "IN": 0x23, "PUTSP": 0x24, "HALT": 0x25}
+
+var otherOps = map[string]bool{
+	"ADD": true, "AND": true, "NOT": true, "JMP": true, "RET": true, "JSR": true, "JSRR": true,
+	"LDR": true, "STR": true, "TRAP": true, "RTI": true,
+	".ORIG": true, ".END": true, ".FILL": true, ".BLKW": true, ".STRINGZ": true,
+	".SECTION": true, ".GLOBAL": true, ".EXTERN": true,
+}
+
+// isOp reports whether s is an instruction or a directive.
+func isOp(s string) bool {
+	name := strings.ToUpper(s)
+	_, memory := memoryOps[name]
+	_, trap := trapAliases[name]
+	_, branch := parseBranch(name)
+	return otherOps[name] || memory || trap || branch
+}
+
+// parseBranch returns the condition codes of BR, BRn, BRz, BRp, BRnz, BRnp, BRzp and BRnzp.
+// BR without condition codes branches always.
+func parseBranch(name string) (uint16, bool) {
+	if !strings.HasPrefix(name, "BR") {
+		return 0, false
+	}
+	flags := name[2:]
+	if flags == "" {
+		return 0x7, true
+	}
+	var nzp uint16
+	last := -1
+	for _, c := range flags {
+		i := strings.IndexRune("NZP", c)
+		if i <= last {
+			return 0, false
+		}
+		last = i
+		nzp |= 0x4 >> uint(i)
+	}
+	return nzp, true
+}
+
+// encode returns the words of a statement.
+func (a *assembler) encode(s *statement) []uint16 {
+	switch s.name {
+	case ".FILL":
+		if !a.args(s, 1) || a.relocate(s, s.args[0], link.Word) {
+			return []uint16{0}
+		}
+		v, ok := a.value(s, 0)
+		if ok && (v < -0x8000 || v > 0xFFFF) {
+			a.warnf(s.at(s.args[0]), ".FILL value %d doesn't fit 16 bits, truncated to x%04X", v, uint16(v))
+		}
+		return []uint16{uint16(v)}
+	case ".BLKW":
+		return make([]uint16, a.size(s))
+	case ".STRINGZ":
+		words := make([]uint16, 0, a.size(s))
+		for _, c := range []byte(s.args[0].text) {
+			words = append(words, uint16(c))
+		}
+		return append(words, 0)
+	}
+	return []uint16{a.encodeInstruction(s)}
+}
+
+// encodeInstruction returns the word of an instruction, errors leave fields zero.
+func (a *assembler) encodeInstruction(s *statement) uint16 {
+	if op, ok := memoryOps[s.name]; ok {
+		if !a.args(s, 2) {
+			return 0
+		}
+		return op<<12 | a.register(s, 0)<<9 | a.pcOffset(s, 1, 9)
+	}
+	if vector, ok := trapAliases[s.name]; ok {
+		a.args(s, 0)
+		return vm.OP_TRAP<<12 | vector
+	}
+	if nzp, ok := parseBranch(s.name); ok {
+		if !a.args(s, 1) {
+			return 0
+		}
+		return vm.OP_BR<<12 | nzp<<9 | a.pcOffset(s, 0, 9)
+	}
+
+	switch s.name {
+	case "ADD", "AND":
+		op := vm.OP_ADD
+		if s.name == "AND" {
+			op = vm.OP_AND
+		}
+		if !a.args(s, 3) {
+			return 0
+		}
+		w := op<<12 | a.register(s, 0)<<9 | a.register(s, 1)<<6
+		if _, ok := parseRegister(s.args[2].text); ok {
+			return w | a.register(s, 2)
+		}
+		return w | 1<<5 | a.immediate(s, 2, 5)
+	case "NOT":
+		if !a.args(s, 2) {
+			return 0
+		}
+		return vm.OP_NOT<<12 | a.register(s, 0)<<9 | a.register(s, 1)<<6 | 0x3F
+	case "JMP", "JSRR":
+		op := vm.OP_JMP
+		if s.name == "JSRR" {
+			op = vm.OP_JSR
+		}
+		if !a.args(s, 1) {
+			return 0
+		}
+		return op<<12 | a.register(s, 0)<<6
+	case "RET":
+		a.args(s, 0)
+		return vm.OP_JMP<<12 | 7<<6
+	case "JSR":
+		if !a.args(s, 1) {
+			return 0
+		}
+		return vm.OP_JSR<<12 | 1<<11 | a.pcOffset(s, 0, 11)
+	case "LDR", "STR":
+		op := vm.OP_LDR
+		if s.name == "STR" {
+			op = vm.OP_STR
+		}
+		if !a.args(s, 3) {
+			return 0
+		}
+		return op<<12 | a.register(s, 0)<<9 | a.register(s, 1)<<6 | a.immediate(s, 2, 6)
+	case "TRAP":
+		if !a.args(s, 1) {
+			return 0
+		}
+		v, _ := a.number(s, 0, 0, 0xFF)
+		return vm.OP_TRAP<<12 | uint16(v)
+	case "RTI":
+		a.args(s, 0)
+		return vm.OP_RTI << 12
+	}
+	a.errorf(s.at(*s.op), "%s is not an instruction", s.op.text)
+	return 0
+}
+
+// args checks the number of arguments.
+func (a *assembler) args(s *statement, n int) bool {
+	if len(s.args) != n {
+		a.errorf(s.at(*s.op), "%s expects %d operands, got %d", s.name, n, len(s.args))
+		return false
+	}
+	return true
+}
+
+func (a *assembler) register(s *statement, i int) uint16 {
+	r, ok := parseRegister(s.args[i].text)
+	if !ok {
+		a.errorf(s.at(s.args[i]), "expected register, got %s", s.args[i].text)
+	}
+	return r
+}
+
+// number parses a numeric operand in the range [min, max].
+func (a *assembler) number(s *statement, i, min, max int) (int, bool) {
+	if len(s.args) <= i {
+		a.errorf(s.at(*s.op), "%s expects %d operands, got %d", s.name, i+1, len(s.args))
+		return 0, false
+	}
+	t := s.args[i]
+	v, ok := parseNumber(t.text)
+	if !ok || t.str {
+		a.errorf(s.at(t), "expected number, got %s", t.text)
+		return 0, false
+	}
+	if v < min || v > max {
+		a.errorf(s.at(t), "%s is out of range [%d, %d]", t.text, min, max)
+		return 0, false
+	}
+	return v, true
+}
+
+// immediate parses a signed operand of the given bit width.
+func (a *assembler) immediate(s *statement, i int, bits uint) uint16 {
+	v, _ := a.number(s, i, -1<<(bits-1), 1<<(bits-1)-1)
+	return uint16(v) & (1<<bits - 1)
+}
+
+// value resolves a number or a label.
+func (a *assembler) value(s *statement, i int) (int, bool) {
+	t := s.args[i]
+	if v, ok := parseNumber(t.text); ok && !t.str {
+		return v, true
+	}
+	address, ok := a.symbols[t.text]
+	if !ok || t.str {
+		a.errorf(s.at(t), "undefined label %s", t.text)
+		return 0, false
+	}
+	return int(address), true
+}
+
+// pcOffset resolves a label to an offset from the incremented PC, numbers are used as offsets.
+func (a *assembler) pcOffset(s *statement, i int, bits uint) uint16 {
+	t := s.args[i]
+	if _, ok := parseNumber(t.text); ok {
+		return a.immediate(s, i, bits)
+	}
+	kind := link.PCOffset9
+	if bits == 11 {
+		kind = link.PCOffset11
+	}
+	if a.relocate(s, t, kind) {
+		return 0
+	}
+	address, ok := a.value(s, i)
+	if !ok {
+		return 0
+	}
+	offset := address - int(s.address) - 1
+	if min, max := -1<<(bits-1), 1<<(bits-1)-1; offset < min || offset > max {
+		a.errorf(s.at(t), "label %s is out of range: offset %d doesn't fit %d bits", t.text, offset, bits)
+		return 0
+	}
+	return uint16(offset) & (1<<bits - 1)
+}
+
+// relocate records a relocation when the label t can only be resolved by the linker: labels
+// of other modules, addresses of labels in relocatable sections and PC relative references
+// between sections of which one is relocatable.
+func (a *assembler) relocate(s *statement, t token, kind link.RelocationKind) bool {
+	if _, ok := parseNumber(t.text); ok || t.str {
+		return false
+	}
+	section, defined := a.sectionOf[t.text]
+	if !defined && !a.externs[t.text] {
+		return false
+	}
+	if defined {
+		relocatable := a.sections[section].Name != ""
+		if kind == link.Word && !relocatable {
+			return false
+		}
+		if kind != link.Word && (section == s.section || !relocatable && a.sections[s.section].Name == "") {
+			return false
+		}
+	}
+	a.relocations = append(a.relocations, link.Relocation{
+		Section: s.section,
+		Offset:  s.address - a.sections[s.section].Origin,
+		Kind:    kind,
+		Symbol:  t.text,
+	})
+	return true
+}
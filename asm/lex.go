@@ -0,0 +1,138 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// token is a word of a source line, string literals are unquoted.
+type token struct {
+	text   string
+	column int  // 1-based
+	str    bool // string literal
+}
+
+// tokenize splits a line into tokens separated by white space and commas, comments are dropped.
+func tokenize(line string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ';':
+			return tokens, nil
+		case c == ' ' || c == '\t' || c == ',' || c == '\r':
+			i++
+		case c == '"':
+			s, n, err := unquote(line[i:])
+			if err != nil {
+				return nil, &columnError{column: i + 1, msg: err.Error()}
+			}
+			tokens = append(tokens, token{text: s, column: i + 1, str: true})
+			i += n
+		default:
+			start := i
+			for i < len(line) && !strings.ContainsRune(" \t,;\"\r", rune(line[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: line[start:i], column: start + 1})
+		}
+	}
+	return tokens, nil
+}
+
+// columnError is an error at a column of the current line.
+type columnError struct {
+	column int
+	msg    string
+}
+
+func (e *columnError) Error() string {
+	return e.msg
+}
+
+// unquote parses the string literal at the start of s and returns its length in s.
+func unquote(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'e':
+				b.WriteByte(0x1B)
+			case '0':
+				b.WriteByte(0)
+			case '\\', '"':
+				b.WriteByte(s[i])
+			default:
+				return "", 0, fmt.Errorf("unknown escape sequence \\%c", s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// parseNumber parses #decimal, xhex, bbinary and plain decimal numbers, negative
+// numbers are allowed with every prefix.
+func parseNumber(s string) (int, bool) {
+	base := 10
+	t := s
+	switch {
+	case strings.HasPrefix(t, "#"):
+		t = t[1:]
+	case strings.HasPrefix(t, "x"), strings.HasPrefix(t, "X"):
+		t, base = t[1:], 16
+	case strings.HasPrefix(t, "0x"), strings.HasPrefix(t, "0X"):
+		t, base = t[2:], 16
+	case strings.HasPrefix(t, "b"), strings.HasPrefix(t, "B"):
+		t, base = t[1:], 2
+	}
+	if t == "" || t == "-" {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(t, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// parseRegister parses R0 to R7.
+func parseRegister(s string) (uint16, bool) {
+	if len(s) != 2 || (s[0] != 'R' && s[0] != 'r') || s[1] < '0' || s[1] > '7' {
+		return 0, false
+	}
+	return uint16(s[1] - '0'), true
+}
+
+// isLabel reports whether s can be used as a label.
+func isLabel(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	if _, ok := parseRegister(s); ok {
+		return false
+	}
+	_, isNumber := parseNumber(s)
+	return !isNumber
+}
@@ -0,0 +1,396 @@
+package asm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// maxExpansionDepth limits nested macro invocations, it stops macros which invoke themselves.
+const maxExpansionDepth = 64
+
+// line is a tokenized source line.
+type line struct {
+	pos      Pos
+	tokens   []token
+	expanded []Pos // macro invocations the line was expanded from, innermost first
+}
+
+// macro is a .MACRO definition.
+type macro struct {
+	def    line
+	params []string
+	body   []line
+}
+
+// conditional is an open .IF block.
+type conditional struct {
+	def    line
+	outer  bool // the enclosing block is assembled
+	taken  bool // the condition of the current branch holds
+	inElse bool
+}
+
+func (c *conditional) active() bool {
+	return c.outer && c.taken
+}
+
+// preprocessor includes files, expands macros and constants and drops the lines of
+// conditional blocks which aren't assembled.
+type preprocessor struct {
+	a          *assembler
+	defines    map[string][]token
+	macros     map[string]*macro // by upper cased name
+	includes   []string          // files being included
+	expansions int               // number of macro invocations, makes local labels unique
+	depth      int
+	lines      []line
+}
+
+// preprocess returns the lines of file to assemble.
+func (a *assembler) preprocess(file string, src []byte) []line {
+	p := &preprocessor{a: a, defines: map[string][]token{}, macros: map[string]*macro{}, includes: []string{file}}
+	p.source(p.read(file, src))
+	return p.lines
+}
+
+// read tokenizes the lines of a file.
+func (p *preprocessor) read(file string, src []byte) []line {
+	var lines []line
+	p.a.files[file] = strings.Split(string(src), "\n")
+	if _, ok := p.a.fileOrder[file]; !ok {
+		p.a.fileOrder[file] = len(p.a.fileOrder)
+	}
+	for i, text := range p.a.files[file] {
+		pos := Pos{File: file, Line: i + 1}
+		tokens, err := tokenize(text)
+		if err != nil {
+			pos.Column = err.(*columnError).column
+			p.a.errorf(pos, "%v", err)
+			continue
+		}
+		if len(tokens) > 0 {
+			lines = append(lines, line{pos: pos, tokens: tokens})
+		}
+	}
+	return lines
+}
+
+// source preprocesses the lines of a file or a macro expansion. Macro definitions and
+// conditional blocks must end in the source they started in.
+func (p *preprocessor) source(lines []line) {
+	var (
+		conds []*conditional
+		def   *macro
+	)
+	active := func() bool {
+		return len(conds) == 0 || conds[len(conds)-1].active()
+	}
+
+	for _, l := range lines {
+		p.a.expanded = l.expanded
+		name := ""
+		if !l.tokens[0].str {
+			name = strings.ToUpper(l.tokens[0].text)
+		}
+
+		if def != nil {
+			switch name {
+			case ".ENDM":
+				p.args(l, 0)
+				def = nil
+			case ".MACRO":
+				p.errorf(l, 0, "nested .MACRO definition")
+			default:
+				def.body = append(def.body, l)
+			}
+			continue
+		}
+
+		switch name {
+		case ".IF", ".IFDEF", ".IFNDEF":
+			c := &conditional{def: l, outer: active()}
+			if c.outer {
+				c.taken = p.condition(l, name)
+			}
+			conds = append(conds, c)
+			continue
+		case ".ELSE":
+			p.args(l, 0)
+			if len(conds) == 0 {
+				p.errorf(l, 0, ".ELSE without .IF")
+			} else if c := conds[len(conds)-1]; c.inElse {
+				p.errorf(l, 0, "duplicate .ELSE")
+			} else {
+				c.taken, c.inElse = !c.taken, true
+			}
+			continue
+		case ".ENDIF":
+			p.args(l, 0)
+			if len(conds) == 0 {
+				p.errorf(l, 0, ".ENDIF without .IF")
+			} else {
+				conds = conds[:len(conds)-1]
+			}
+			continue
+		}
+		if !active() {
+			continue
+		}
+
+		switch name {
+		case ".MACRO":
+			def = p.defineMacro(l)
+		case ".ENDM":
+			p.errorf(l, 0, ".ENDM without .MACRO")
+		case ".DEFINE":
+			p.define(l)
+		case ".INCLUDE":
+			p.include(l)
+		default:
+			p.statement(l)
+		}
+	}
+
+	if def != nil {
+		p.a.expanded = def.def.expanded
+		p.errorf(def.def, 0, ".MACRO without .ENDM")
+	}
+	for _, c := range conds {
+		p.a.expanded = c.def.expanded
+		p.errorf(c.def, 0, "%s without .ENDIF", strings.ToUpper(c.def.tokens[0].text))
+	}
+}
+
+// errorf reports an error at the token i of l.
+func (p *preprocessor) errorf(l line, i int, format string, args ...interface{}) {
+	pos := l.pos
+	pos.Column = l.tokens[i].column
+	p.a.errorf(pos, format, args...)
+}
+
+// args checks the number of arguments of a directive.
+func (p *preprocessor) args(l line, n int) bool {
+	if len(l.tokens)-1 != n {
+		p.errorf(l, 0, "%s expects %d operands, got %d", strings.ToUpper(l.tokens[0].text), n, len(l.tokens)-1)
+		return false
+	}
+	return true
+}
+
+// name checks that the token i of l can be used as a name.
+func (p *preprocessor) name(l line, i int) (string, bool) {
+	t := l.tokens[i]
+	if t.str || !isLabel(t.text) || isOp(t.text) {
+		p.errorf(l, i, "invalid name %s", t.text)
+		return "", false
+	}
+	return t.text, true
+}
+
+// defineMacro starts the definition of .MACRO NAME PARAM..., the body is collected by source.
+func (p *preprocessor) defineMacro(l line) *macro {
+	m := &macro{def: l}
+	if len(l.tokens) < 2 {
+		p.errorf(l, 0, ".MACRO expects a name")
+		return m
+	}
+	name, ok := p.name(l, 1)
+	if !ok {
+		return m
+	}
+	for i := range l.tokens[2:] {
+		if param, ok := p.name(l, i+2); ok {
+			m.params = append(m.params, param)
+		}
+	}
+	key := strings.ToUpper(name)
+	if prev, ok := p.macros[key]; ok {
+		p.errorf(l, 1, "macro %s redefined, previous definition at %v", name, prev.def.pos)
+		return m
+	}
+	p.macros[key] = m
+	return m
+}
+
+// define handles .DEFINE NAME VALUE..., the value is expanded when it is defined.
+func (p *preprocessor) define(l line) {
+	if len(l.tokens) < 2 {
+		p.errorf(l, 0, ".DEFINE expects a name")
+		return
+	}
+	name, ok := p.name(l, 1)
+	if !ok {
+		return
+	}
+	if _, ok := p.defines[name]; ok {
+		p.errorf(l, 1, "%s redefined", name)
+		return
+	}
+	p.defines[name] = p.substitute(l.tokens[2:])
+}
+
+// include handles .INCLUDE "file", relative paths are resolved from the directory of the including file.
+func (p *preprocessor) include(l line) {
+	if !p.args(l, 1) {
+		return
+	}
+	if !l.tokens[1].str {
+		p.errorf(l, 1, ".INCLUDE needs a string")
+		return
+	}
+	path := l.tokens[1].text
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(l.pos.File), path)
+	}
+	for _, f := range p.includes {
+		if f == path {
+			p.errorf(l, 1, "%s includes itself", path)
+			return
+		}
+	}
+	src, err := ioutil.ReadFile(path) //nolint: gosec
+	if err != nil {
+		p.errorf(l, 1, "%v", err)
+		return
+	}
+
+	p.includes = append(p.includes, path)
+	p.source(p.read(path, src))
+	p.includes = p.includes[:len(p.includes)-1]
+}
+
+// condition evaluates .IFDEF NAME, .IFNDEF NAME, .IF VALUE and .IF VALUE OP VALUE.
+func (p *preprocessor) condition(l line, directive string) bool {
+	if directive != ".IF" {
+		if !p.args(l, 1) {
+			return false
+		}
+		_, defined := p.defines[l.tokens[1].text]
+		return defined == (directive == ".IFDEF")
+	}
+
+	expr := line{pos: l.pos, tokens: p.substitute(l.tokens[1:])}
+	value := func(i int) (int, bool) {
+		v, ok := parseNumber(expr.tokens[i].text)
+		if !ok || expr.tokens[i].str {
+			p.errorf(expr, i, "expected number, got %s", expr.tokens[i].text)
+		}
+		return v, ok
+	}
+	switch len(expr.tokens) {
+	case 1:
+		v, _ := value(0)
+		return v != 0
+	case 3:
+		x, ok1 := value(0)
+		y, ok2 := value(2)
+		if !ok1 || !ok2 {
+			return false
+		}
+		switch expr.tokens[1].text {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		case ">":
+			return x > y
+		case ">=":
+			return x >= y
+		}
+		p.errorf(expr, 1, "unknown operator %s", expr.tokens[1].text)
+		return false
+	}
+	p.errorf(l, 0, ".IF expects a value or a comparison")
+	return false
+}
+
+// substitute replaces the names of .DEFINE constants, the replacements keep the column of the name.
+func (p *preprocessor) substitute(tokens []token) []token {
+	out := make([]token, 0, len(tokens))
+	for _, t := range tokens {
+		value, ok := p.defines[t.text]
+		if !ok || t.str {
+			out = append(out, t)
+			continue
+		}
+		for _, v := range value {
+			v.column = t.column
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// statement expands constants and macro invocations of an instruction line.
+func (p *preprocessor) statement(l line) {
+	l.tokens = p.substitute(l.tokens)
+	for i := 0; i < len(l.tokens) && i < 2; i++ {
+		m, ok := p.macros[strings.ToUpper(l.tokens[i].text)]
+		if !ok || l.tokens[i].str {
+			continue
+		}
+		if i == 1 {
+			// The label of the invocation
+			p.lines = append(p.lines, line{pos: l.pos, tokens: l.tokens[:1], expanded: l.expanded})
+		}
+		p.expand(m, l, i)
+		return
+	}
+	p.lines = append(p.lines, l)
+}
+
+// expand invokes the macro m whose name is the token i of l.
+func (p *preprocessor) expand(m *macro, l line, i int) {
+	args := l.tokens[i+1:]
+	if len(args) != len(m.params) {
+		p.errorf(l, i, "%s expects %d operands, got %d", m.def.tokens[1].text, len(m.params), len(args))
+		return
+	}
+	if p.depth == maxExpansionDepth {
+		p.errorf(l, i, "macro %s is nested too deeply", m.def.tokens[1].text)
+		return
+	}
+
+	p.expansions++
+	call := l.pos
+	call.Column = l.tokens[i].column
+	expanded := append([]Pos{call}, l.expanded...)
+	body := make([]line, len(m.body))
+	for j, b := range m.body {
+		tokens := make([]token, len(b.tokens))
+		for k, t := range b.tokens {
+			tokens[k] = p.bind(m, args, t)
+		}
+		body[j] = line{pos: b.pos, tokens: tokens, expanded: expanded}
+	}
+
+	p.depth++
+	p.source(body)
+	p.depth--
+	p.a.expanded = l.expanded
+}
+
+// bind replaces a macro parameter by its argument and renames local labels, which start
+// with @, to names unique to the invocation.
+func (p *preprocessor) bind(m *macro, args []token, t token) token {
+	if t.str {
+		return t
+	}
+	for i, param := range m.params {
+		if t.text == param {
+			arg := args[i]
+			arg.column = t.column
+			return arg
+		}
+	}
+	if name := strings.TrimSuffix(t.text, ":"); strings.HasPrefix(name, "@") && isLabel(name[1:]) {
+		t.text = fmt.Sprintf("__%s_%d%s", name[1:], p.expansions, t.text[len(name):])
+	}
+	return t
+}
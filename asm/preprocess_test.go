@@ -0,0 +1,131 @@
+package asm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble_macros(t *testing.T) {
+	p, err := Assemble("macros.asm", []byte(`
+.DEFINE SP R6
+.DEFINE ONE #1
+.MACRO PUSH reg
+	ADD SP, SP, #-1
+	STR reg, SP, #0
+.ENDM
+.MACRO POP reg
+	LDR reg, SP, #0
+	ADD SP, SP, ONE
+.ENDM
+.MACRO COUNTDOWN reg
+@LOOP	ADD reg, reg, #-1
+	BRp @LOOP
+.ENDM
+
+	.ORIG x3000
+START	push R1
+	COUNTDOWN R2
+	COUNTDOWN R3
+	POP R1
+	.END
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{
+		0b0001_110_110_1_11111,
+		0b0111_001_110_000000,
+		0b0001_010_010_1_11111,
+		0b0000_001_111111110,
+		0b0001_011_011_1_11111,
+		0b0000_001_111111110,
+		0b0110_001_110_000000,
+		0b0001_110_110_1_00001,
+	}, p.Sections[0].Words)
+	assert.Equal(t, map[string]uint16{"START": 0x3000, "__LOOP_2": 0x3002, "__LOOP_3": 0x3004}, p.Symbols)
+}
+
+func TestAssemble_conditionals(t *testing.T) {
+	src := []byte(`
+.DEFINE SIZE 2
+	.ORIG x3000
+.IFDEF DEBUG
+	.FILL 1
+.ELSE
+	.FILL 2
+.ENDIF
+.IF SIZE > 1
+	.FILL 3
+.IF SIZE == 3
+	.FILL 4
+.ENDIF
+.ELSE
+	.IF BOGUS
+	.ENDIF
+.ENDIF
+.IFNDEF SIZE
+	.FILL 5
+.ENDIF
+.IF 0
+	.FILL 6
+.ENDIF
+	.END
+`)
+	p, err := Assemble("cond.asm", src)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{2, 3}, p.Sections[0].Words)
+}
+
+func TestAssemble_include(t *testing.T) {
+	dir := t.TempDir()
+	lib := `
+.IFNDEF LIB
+.DEFINE LIB 1
+.MACRO NEWLINE
+	AND R0, R0, #0
+	ADD R0, R0, #10
+	OUT
+.ENDM
+.ENDIF
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "lib.asm"), []byte(lib), 0o600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "loop.asm"), []byte(`.INCLUDE "loop.asm"`), 0o600))
+
+	p, err := Assemble(filepath.Join(dir, "main.asm"), []byte(`
+.INCLUDE "lib.asm"
+.INCLUDE "lib.asm"
+	.ORIG x3000
+	NEWLINE
+	.END
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0x5020, 0x102A, 0xF021}, p.Sections[0].Words)
+
+	_, err = Assemble(filepath.Join(dir, "main.asm"), []byte(`.INCLUDE "loop.asm"`))
+	assert.EqualError(t, err, filepath.Join(dir, "loop.asm")+":1:10: "+filepath.Join(dir, "loop.asm")+" includes itself")
+}
+
+func TestAssemble_preprocessorErrors(t *testing.T) {
+	for src, msg := range map[string]string{
+		".IF 1":                            "x.asm:1:1: .IF without .ENDIF",
+		".ENDIF":                           "x.asm:1:1: .ENDIF without .IF",
+		".IF 1\n.ELSE\n.ELSE\n.ENDIF":      "x.asm:3:1: duplicate .ELSE",
+		".IF X\n.ENDIF":                    "x.asm:1:5: expected number, got X",
+		".IF 1 ~ 2\n.ENDIF":                "x.asm:1:7: unknown operator ~",
+		".MACRO M\n":                       "x.asm:1:1: .MACRO without .ENDM",
+		".MACRO ADD\n.ENDM":                "x.asm:1:8: invalid name ADD",
+		".MACRO M\n.ENDM\n.MACRO m\n.ENDM": "x.asm:3:8: macro m redefined, previous definition at x.asm:1",
+		".DEFINE A 1\n.DEFINE A 2":         "x.asm:2:9: A redefined",
+		".MACRO M a\n.ENDM\nM":             "x.asm:3:1: M expects 1 operands, got 0",
+		".INCLUDE missing.asm":             "x.asm:1:10: .INCLUDE needs a string",
+		".MACRO M\nM\n.ENDM\nM":            "x.asm:2:1: macro M is nested too deeply",
+		".MACRO M r\n.ORIG x3000\nADD r, r, #20\n.ENDM\nM R1": "x.asm:3:11: #20 is out of range [-16, 15]\n" +
+			"\texpanded from x.asm:5:1",
+	} {
+		_, err := Assemble("x.asm", []byte(src))
+		if assert.NotNil(t, err, src) {
+			assert.Contains(t, err.Error(), msg, src)
+		}
+	}
+}
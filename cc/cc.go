@@ -0,0 +1,391 @@
+// Package cc compiles a small C-like language to LC-3 assembly.
+//
+// Programs consist of int variables, int arrays and functions. Functions take int
+// parameters, an array parameter is written as int a[] and holds the address of the
+// array, any int can be indexed that way. Statements are blocks, declarations, if/else,
+// while, break, continue, return and expressions with the operators of C except the bit
+// operators, increments and compound assignments. The built-in functions getc(), putc(c),
+// puts(s) and halt() use the TRAP routines of the VM. The program starts with main().
+//
+// The generated code follows the textbook convention: R6 is the stack pointer, R5 the
+// frame pointer and R4 points to the globals. Callers push the arguments from left to
+// right, callees push R7 and R5 and keep their locals below R5, results are returned in R0.
+// Branches and calls too far for the PC relative forms jump through R2.
+// Multiplication, division, modulo and ordering comparisons call routines of a small
+// runtime library.
+package cc
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+)
+
+// StackTop is the initial stack pointer, the stack grows down from the device registers.
+const StackTop = 0xFE00
+
+// symbol is a variable or a parameter.
+type symbol struct {
+	global bool
+	offset int  // from R5 for locals and parameters, from R4 for globals
+	array  bool // the symbol stands for the address of its words
+}
+
+// function is a function declared by the program.
+type function struct {
+	pos    asm.Pos
+	params int
+	void   bool
+}
+
+// call is a call of a function which may be defined later.
+type call struct {
+	pos  asm.Pos
+	name string
+	args int
+}
+
+// builtins are the functions mapped to TRAP routines, by number of arguments.
+var builtins = map[string]int{"getc": 0, "putc": 1, "puts": 1, "halt": 0}
+
+// bailout stops the compilation at the first error.
+type bailout struct {
+	err *asm.Error
+}
+
+type compiler struct {
+	lex *lexer
+	tok token
+
+	functions map[string]*function
+	calls     []call
+	globals   map[string]*symbol
+	size      int // words of globals
+	data      strings.Builder
+	strings   []string
+	runtime   map[string]bool
+	code      strings.Builder // compiled functions
+	labels    int
+
+	// The function being compiled
+	body      strings.Builder
+	fn        *function
+	scopes    []map[string]*symbol
+	frame     int    // words of locals
+	ret       string // label of the epilogue
+	loops     [][2]string
+	commented int // last source line copied into a comment
+}
+
+// Compile compiles a program to LC-3 assembly, errors are returned as an asm.ErrorList.
+func Compile(file string, src []byte) (code string, err error) {
+	c := &compiler{
+		lex:       &lexer{file: file, src: string(src), line: 1},
+		functions: map[string]*function{},
+		globals:   map[string]*symbol{},
+		runtime:   map[string]bool{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			b, ok := r.(bailout)
+			if !ok {
+				panic(r)
+			}
+			lines := strings.Split(c.lex.src, "\n")
+			if l := b.err.Pos.Line; l >= 1 && l <= len(lines) {
+				b.err.Source = lines[l-1]
+			}
+			code, err = "", asm.ErrorList{b.err}
+		}
+	}()
+
+	c.next()
+	c.program()
+	return c.output(file), nil
+}
+
+// Build compiles a program and assembles it.
+func Build(file string, src []byte) (*asm.Program, error) {
+	code, err := Compile(file, src)
+	if err != nil {
+		return nil, err
+	}
+	return asm.Assemble(strings.TrimSuffix(file, filepath.Ext(file))+".asm", []byte(code))
+}
+
+func (c *compiler) errorf(pos asm.Pos, format string, args ...interface{}) {
+	panic(bailout{&asm.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}})
+}
+
+func (c *compiler) next() {
+	t, err := c.lex.next()
+	if err != nil {
+		panic(bailout{err.(*asm.Error)})
+	}
+	c.tok = t
+}
+
+// is reports whether the current token is the keyword or punctuation s.
+func (c *compiler) is(s string) bool {
+	return (c.tok.kind == tokenPunct || c.tok.kind == tokenKeyword) && c.tok.text == s
+}
+
+func (c *compiler) accept(s string) bool {
+	if c.is(s) {
+		c.next()
+		return true
+	}
+	return false
+}
+
+func (c *compiler) expect(s string) {
+	if !c.accept(s) {
+		c.errorf(c.tok.pos, "expected %s, got %v", s, c.tok)
+	}
+}
+
+func (c *compiler) name() token {
+	t := c.tok
+	if t.kind != tokenName {
+		c.errorf(t.pos, "expected name, got %v", t)
+	}
+	c.next()
+	return t
+}
+
+func (c *compiler) number() int {
+	negative := c.accept("-")
+	t := c.tok
+	if t.kind != tokenNumber {
+		c.errorf(t.pos, "expected number, got %v", t)
+	}
+	c.next()
+	if negative {
+		return -t.value
+	}
+	return t.value
+}
+
+// program compiles the declarations of globals and functions.
+func (c *compiler) program() {
+	for c.tok.kind != tokenEOF {
+		void := c.accept("void")
+		if !void {
+			c.expect("int")
+		}
+		name := c.name()
+		if c.is("(") {
+			c.function(name, void)
+			continue
+		}
+		if void {
+			c.errorf(name.pos, "variable %s can't be void", name.text)
+		}
+		c.global(name)
+		for c.accept(",") {
+			c.global(c.name())
+		}
+		c.expect(";")
+	}
+
+	for _, call := range c.calls {
+		f, ok := c.functions[call.name]
+		switch {
+		case !ok:
+			c.errorf(call.pos, "undefined function %s", call.name)
+		case f.params != call.args:
+			c.errorf(call.pos, "%s expects %d arguments, got %d", call.name, f.params, call.args)
+		}
+	}
+	main, ok := c.functions["main"]
+	if !ok {
+		c.errorf(c.tok.pos, "function main is missing")
+	}
+	if main.params != 0 {
+		c.errorf(main.pos, "main can't have parameters")
+	}
+}
+
+// declared checks that a global name is new.
+func (c *compiler) declared(name token) {
+	_, variable := c.globals[name.text]
+	_, function := c.functions[name.text]
+	_, builtin := builtins[name.text]
+	if variable || function || builtin {
+		c.errorf(name.pos, "%s redeclared", name.text)
+	}
+}
+
+// global compiles "int name", "int name = value", "int name[size]" and "int name[size] = {values}".
+func (c *compiler) global(name token) {
+	c.declared(name)
+	s := &symbol{global: true, offset: c.size}
+	c.globals[name.text] = s
+	if !c.accept("[") {
+		value := 0
+		if c.accept("=") {
+			value = c.number()
+		}
+		fmt.Fprintf(&c.data, "G_%s\t.FILL #%d\n", name.text, signed(value))
+		c.size++
+		return
+	}
+
+	s.array = true
+	pos := c.tok.pos
+	size := c.number()
+	if size <= 0 {
+		c.errorf(pos, "array %s must have a positive size", name.text)
+	}
+	c.expect("]")
+	var values []int
+	if c.accept("=") {
+		c.expect("{")
+		for !c.accept("}") {
+			if len(values) > 0 {
+				c.expect(",")
+			}
+			pos := c.tok.pos
+			values = append(values, c.number())
+			if len(values) > size {
+				c.errorf(pos, "too many values for array %s", name.text)
+			}
+		}
+	}
+	for i, v := range values {
+		label := ""
+		if i == 0 {
+			label = "G_" + name.text
+		}
+		fmt.Fprintf(&c.data, "%s\t.FILL #%d\n", label, signed(v))
+	}
+	if n := size - len(values); n > 0 {
+		label := ""
+		if len(values) == 0 {
+			label = "G_" + name.text
+		}
+		fmt.Fprintf(&c.data, "%s\t.BLKW #%d\n", label, n)
+	}
+	c.size += size
+}
+
+// function compiles a function definition.
+func (c *compiler) function(name token, void bool) {
+	c.declared(name)
+	f := &function{pos: name.pos, void: void}
+	c.functions[name.text] = f
+
+	c.expect("(")
+	var params []token
+	if !c.accept("void") {
+		for !c.is(")") {
+			if len(params) > 0 {
+				c.expect(",")
+			}
+			c.expect("int")
+			params = append(params, c.name())
+			if c.accept("[") {
+				c.expect("]")
+			}
+		}
+	}
+	c.expect(")")
+	f.params = len(params)
+
+	// The arguments are above the saved R5 and R7, the last one first
+	scope := map[string]*symbol{}
+	for i, p := range params {
+		if _, ok := scope[p.text]; ok {
+			c.errorf(p.pos, "parameter %s redeclared", p.text)
+		}
+		scope[p.text] = &symbol{offset: 2 + len(params) - 1 - i}
+	}
+	c.fn, c.scopes, c.frame, c.ret, c.loops = f, []map[string]*symbol{scope}, 0, c.label(), nil
+	c.body.Reset()
+	c.block()
+
+	body := c.body.String()
+	c.body.Reset()
+	c.emit("ADD R6, R6, #-1")
+	c.emit("STR R7, R6, #0      ; push the return address")
+	c.emit("ADD R6, R6, #-1")
+	c.emit("STR R5, R6, #0      ; push the frame pointer of the caller")
+	c.emit("ADD R5, R6, #0")
+	if c.frame > 0 {
+		c.add("R6", "R6", -c.frame)
+	}
+	c.body.WriteString(body)
+	c.place(c.ret)
+	c.emit("ADD R6, R5, #0      ; drop the locals")
+	c.emit("LDR R5, R6, #0")
+	c.emit("LDR R7, R6, #1")
+	c.emit("ADD R6, R6, #2")
+	c.emit("RET")
+	// Branches stay inside the function, calls may still take their long form
+	code := c.body.String()
+	code = c.resolve(code, branchMarker, words(code, 4) > 256)
+	fmt.Fprintf(&c.code, "\n; %s\nF_%s\n%s", strings.TrimSpace(c.line(name.pos.Line)), name.text, code)
+}
+
+// line returns a line of the source.
+func (c *compiler) line(n int) string {
+	lines := strings.SplitN(c.lex.src, "\n", n+1)
+	if n > len(lines) {
+		return ""
+	}
+	return lines[n-1]
+}
+
+// lookup finds a variable, the innermost scope first.
+func (c *compiler) lookup(name token) *symbol {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if s, ok := c.scopes[i][name.text]; ok {
+			return s
+		}
+	}
+	if s, ok := c.globals[name.text]; ok {
+		return s
+	}
+	c.errorf(name.pos, "undefined variable %s", name.text)
+	return nil
+}
+
+// output assembles the program: the startup code, the runtime, the functions and the data.
+func (c *compiler) output(file string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "; Compiled from %s\n", filepath.Base(file))
+	b.WriteString("\t.ORIG x3000\n")
+	var code strings.Builder
+	code.WriteString(startup)
+	for _, name := range []string{"mul", "divmod", "cmp"} {
+		if c.runtime[name] {
+			code.WriteString(runtime[name])
+		}
+	}
+	code.WriteString(c.code.String())
+	b.WriteString(c.resolve(code.String(), callMarker, words(code.String(), 1) > 1024))
+
+	b.WriteString("\n; Globals, R4 points to them\n__data\n")
+	b.WriteString(c.data.String())
+	for i, s := range c.strings {
+		fmt.Fprintf(&b, "S%d\t.STRINGZ %s\n", i, quote(s))
+	}
+	b.WriteString("\t.END\n")
+	return b.String()
+}
+
+// signed converts 16-bit values to the range of .FILL with a decimal operand.
+func signed(v int) int {
+	v &= 0xFFFF
+	if v > 0x7FFF {
+		v -= 0x10000
+	}
+	return v
+}
+
+// quote formats a string for .STRINGZ.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`, "\x00", `\0`, "\x1b", `\e`).Replace(s) + `"`
+}
@@ -0,0 +1,223 @@
+package cc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/lc3test"
+)
+
+// run compiles a program and returns its output.
+func run(t *testing.T, src string) string {
+	t.Helper()
+	code, err := Compile("test.c", []byte(src))
+	if errs, ok := err.(asm.ErrorList); ok {
+		t.Fatalf("can't compile program:\n%s", errs.Detail())
+	}
+	return lc3test.Asm(t, code).Run().Output()
+}
+
+func TestCompile_helloWorld(t *testing.T) {
+	assert.Equal(t, "Hello World!\n", run(t, `
+int main() {
+	puts("Hello World!\n");
+	return 0;
+}
+`))
+}
+
+func TestCompile_arithmetic(t *testing.T) {
+	assert.Equal(t, "5040 -176 -2 176 2 -900 1000 0 1 1 0 1 1 0 1 ", run(t, `
+void print(int n) {
+	int digits[5];
+	int i = 0;
+	if (n < 0) {
+		putc('-');
+		n = -n;
+	}
+	while (1) {
+		digits[i] = n % 10;
+		i = i + 1;
+		n = n / 10;
+		if (n == 0) break;
+	}
+	while (i > 0) {
+		i = i - 1;
+		putc('0' + digits[i]);
+	}
+	putc(' ');
+}
+
+int fact(int n) {
+	if (n <= 1) return 1;
+	return n * fact(n - 1);
+}
+
+int main() {
+	print(fact(7));
+	print(-1234 / 7);
+	print(-1234 % 7);
+	print(-1234 / -7);
+	print(1234 % -7);
+	print(300 * -3);
+	print(10 * 100);
+	print(5 / 0);
+	print(!0);
+	print(3 > 2 && 2 < 3);
+	print(3 > 2 && 2 > 3);
+	print(0 || 5);
+	print(2 - 1 == 1);
+	print(1 != 1);
+	print(-3 <= -3);
+	return 0;
+}
+`))
+}
+
+func TestCompile_comparisons(t *testing.T) {
+	// R1 - R0 overflows for operands of opposite signs near the limits
+	assert.Equal(t, "FFTT TTFF FFTT TTFF TTFF FTFT ", run(t, `
+void test(int a, int b) {
+	int results[4];
+	int i = 0;
+	results[0] = a < b;
+	results[1] = a <= b;
+	results[2] = a > b;
+	results[3] = a >= b;
+	while (i < 4) {
+		if (results[i]) putc('T'); else putc('F');
+		i = i + 1;
+	}
+	putc(' ');
+}
+
+int main() {
+	test(20000, -20000);
+	test(-20000, 20000);
+	test(32767, -32767);
+	test(-32767, 32767);
+	test(-32768, 32767);
+	test(-5, -5);
+	return 0;
+}
+`))
+}
+
+func TestCompile_globalsAndArrays(t *testing.T) {
+	assert.Equal(t, "cba!", run(t, `
+int letters[3] = {'a', 'b', 'c'};
+int count = 3;
+int big[40];
+
+void reverse(int a[], int n) {
+	int i = 0;
+	while (i < n / 2) {
+		int t = a[i];
+		a[i] = a[n - 1 - i];
+		a[n - 1 - i] = t;
+		i = i + 1;
+	}
+}
+
+int main() {
+	int local[40];
+	int i;
+	reverse(letters, count);
+	i = 0;
+	while (1) {
+		if (i == count) break;
+		putc(letters[i]);
+		i = i + 1;
+	}
+	big[39] = 33;
+	local[39] = big[39];
+	putc(local[39]);
+	return 0;
+}
+`))
+}
+
+func TestCompile_input(t *testing.T) {
+	code, err := Compile("test.c", []byte(`
+int main() {
+	int c = getc();
+	while (c != '\n') {
+		if (c >= 'a' && c <= 'z') c = c - 32;
+		putc(c);
+		c = getc();
+	}
+	halt();
+}
+`))
+	assert.Nil(t, err)
+	lc3test.Asm(t, code).Input("shout!\n").Run().ExpectOutput("SHOUT!")
+}
+
+func TestCompile_largeProgram(t *testing.T) {
+	// The loops and returns span functions of more than 256 words, main calls functions
+	// and the runtime from more than 1024 words away
+	var src strings.Builder
+	for f := 0; f < 4; f++ {
+		fmt.Fprintf(&src, "int grow%d(int n) {\n\twhile (1) {\n\t\tif (n > 300) return n;\n", f)
+		for i := 0; i < 100; i++ {
+			src.WriteString("\t\tn = n + 1;\n")
+		}
+		src.WriteString("\t}\n\treturn 0;\n}\n\n")
+	}
+	src.WriteString(`int main() {
+	if (grow0(0) * 2 == 800) puts("ok");
+	if (grow3(5) < 306) puts(" ok");
+	return 0;
+}
+`)
+
+	code, err := Compile("test.c", []byte(src.String()))
+	assert.Nil(t, err)
+	assert.Contains(t, code, "\tJMP R2\n")
+	assert.Contains(t, code, "\tJSRR R2\n")
+	p, err := Build("test.c", []byte(src.String()))
+	assert.Nil(t, err)
+	assert.Greater(t, len(p.Object())/2, 1024)
+	assert.Equal(t, "ok ok", lc3test.Asm(t, code).Run().Output())
+
+	// Small programs keep the short forms
+	code, err = Compile("test.c", []byte("int main() { while (1) { if (2 * 3 > 5) break; } return 0; }"))
+	assert.Nil(t, err)
+	assert.NotContains(t, code, "\tJMP R2\n")
+	assert.NotContains(t, code, "\tJSRR R2\n")
+}
+
+func TestCompile_errors(t *testing.T) {
+	for src, want := range map[string]string{
+		"int main() { return x; }":                   "test.c:1:21: undefined variable x",
+		"int main() { f(1); return 0; }\nint f() {}": "test.c:1:14: f expects 0 arguments, got 1",
+		"int main() { g(); return 0; }":              "test.c:1:14: undefined function g",
+		"int f() { return 0; }":                      "test.c:1:22: function main is missing",
+		"int main() { break; }":                      "test.c:1:14: break outside of a loop",
+		"int main() { 1 = 2; }":                      "test.c:1:14: can't assign to an expression",
+		"int main() { return 0 }":                    "test.c:1:23: expected ;, got }",
+		"int x; int x;":                              "test.c:1:12: x redeclared",
+		"void main() { return 1; }":                  "test.c:1:15: void function can't return a value",
+		"int main() { puts(\"a); }":                  "test.c:1:19: unterminated literal",
+		"int main() { putc(1, 2); }":                 "test.c:1:14: putc expects 1 arguments, got 2",
+		"int main() { int a[2]; a = 1; }":            "test.c:1:24: can't assign to an array",
+		"int main() { int i; int i; }":               "test.c:1:25: i redeclared",
+		"int main(int argc) { return 0; }":           "test.c:1:5: main can't have parameters",
+	} {
+		_, err := Compile("test.c", []byte(src))
+		if assert.NotNil(t, err, src) {
+			assert.Equal(t, want, err.Error(), src)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	p, err := Build("dir/test.c", []byte("int main() { return 0; }"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0x3000), p.Sections[0].Origin)
+	assert.Equal(t, "dir/test.asm", p.Debug().Files[0])
+}
@@ -0,0 +1,276 @@
+package cc
+
+import "strconv"
+
+// operandKind tells where an operand is.
+type operandKind int
+
+const (
+	inR0       operandKind = iota // the value is in R0
+	inVariable                    // the value is in a variable, not loaded yet
+	atAddress                     // the address of the value is in R0
+)
+
+// operand is a compiled expression, variables and array elements are only loaded when
+// they aren't assigned to.
+type operand struct {
+	kind operandKind
+	sym  *symbol
+}
+
+// binaryOperators lists the binary operators by increasing precedence.
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// skipIfFalse are the condition codes of the comparison of left and right, as computed by
+// __cmp, for which a comparison is false.
+var skipIfFalse = map[string]string{"<": "zp", "<=": "p", ">": "nz", ">=": "n", "==": "np", "!=": "z"}
+
+// value compiles an expression into R0.
+func (c *compiler) value() {
+	c.load0(c.assignment())
+}
+
+// load0 loads an operand into R0.
+func (c *compiler) load0(o operand) {
+	switch o.kind {
+	case inVariable:
+		c.load("R0", o.sym)
+	case atAddress:
+		c.emit("LDR R0, R0, #0")
+	}
+}
+
+func (c *compiler) assignment() operand {
+	pos := c.tok.pos
+	o := c.binary(0)
+	if !c.accept("=") {
+		return o
+	}
+	switch o.kind {
+	case inVariable:
+		if o.sym.array {
+			c.errorf(pos, "can't assign to an array")
+		}
+		c.value()
+		c.store(o.sym)
+	case atAddress:
+		c.push()
+		c.value()
+		c.pop("R1")
+		c.emit("STR R0, R1, #0")
+	default:
+		c.errorf(pos, "can't assign to an expression")
+	}
+	return operand{}
+}
+
+// operator returns the binary operator of a precedence level at the current token.
+func (c *compiler) operator(level int) (string, bool) {
+	for _, op := range binaryOperators[level] {
+		if c.is(op) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (c *compiler) binary(level int) operand {
+	if level == len(binaryOperators) {
+		return c.unary()
+	}
+	o := c.binary(level + 1)
+	for {
+		op, ok := c.operator(level)
+		if !ok {
+			return o
+		}
+		c.next()
+		c.load0(o)
+		o = operand{}
+		if op == "&&" || op == "||" {
+			c.logical(op, level)
+			continue
+		}
+
+		c.push()
+		c.load0(c.binary(level + 1))
+		c.pop("R1")
+		c.arithmetic(op)
+	}
+}
+
+// logical compiles the right operand of && and || only when the left one in R0 doesn't
+// decide the result.
+func (c *compiler) logical(op string, level int) {
+	short, end := c.label(), c.label()
+	decided := "z"
+	if op == "||" {
+		decided = "np"
+	}
+	c.emit("ADD R0, R0, #0")
+	c.branch(decided, short)
+	c.load0(c.binary(level + 1))
+	c.emit("ADD R0, R0, #0")
+	c.branch(decided, short)
+	c.emit("AND R0, R0, #0")
+	if op == "&&" {
+		c.emit("ADD R0, R0, #1")
+	}
+	c.branch("nzp", end)
+	c.place(short)
+	c.emit("AND R0, R0, #0")
+	if op == "||" {
+		c.emit("ADD R0, R0, #1")
+	}
+	c.place(end)
+}
+
+// arithmetic computes R1 op R0 into R0.
+func (c *compiler) arithmetic(op string) {
+	switch op {
+	case "+":
+		c.emit("ADD R0, R1, R0")
+	case "-":
+		c.emit("NOT R0, R0")
+		c.emit("ADD R0, R0, #1")
+		c.emit("ADD R0, R1, R0")
+	case "*":
+		c.runtime["mul"] = true
+		c.jsr("__mul")
+	case "/", "%":
+		c.runtime["divmod"] = true
+		c.jsr("__divmod")
+		if op == "%" {
+			c.emit("ADD R0, R1, #0")
+		}
+	case "==", "!=":
+		// Equality tests R1 - R0 for zero, which holds even when the subtraction overflows
+		c.emit("NOT R0, R0")
+		c.emit("ADD R0, R0, #1")
+		c.emit("ADD R1, R1, R0")
+		c.compare(op)
+	default:
+		c.runtime["cmp"] = true
+		c.jsr("__cmp")
+		c.emit("ADD R1, R0, #0")
+		c.compare(op)
+	}
+}
+
+// compare sets R0 to 1 when the sign of R1 makes the comparison op true, else to 0.
+func (c *compiler) compare(op string) {
+	skip := c.label()
+	c.emit("AND R0, R0, #0")
+	c.emit("ADD R1, R1, #0")
+	c.emit("BR%s %s", skipIfFalse[op], skip)
+	c.emit("ADD R0, R0, #1")
+	c.place(skip)
+}
+
+func (c *compiler) unary() operand {
+	switch {
+	case c.accept("-"):
+		c.load0(c.unary())
+		c.emit("NOT R0, R0")
+		c.emit("ADD R0, R0, #1")
+	case c.accept("!"):
+		c.load0(c.unary())
+		skip := c.label()
+		c.emit("ADD R1, R0, #0")
+		c.emit("AND R0, R0, #0")
+		c.emit("ADD R1, R1, #0")
+		c.emit("BRnp %s", skip)
+		c.emit("ADD R0, R0, #1")
+		c.place(skip)
+	default:
+		return c.postfix()
+	}
+	return operand{}
+}
+
+// postfix compiles primary expressions, calls and indexing.
+func (c *compiler) postfix() operand {
+	t := c.tok
+	switch t.kind {
+	case tokenNumber:
+		c.next()
+		c.loadNumber("R0", t.value)
+		return operand{}
+	case tokenString:
+		c.next()
+		c.strings = append(c.strings, t.text)
+		c.constant("R0", "S"+strconv.Itoa(len(c.strings)-1))
+		return operand{}
+	case tokenName:
+		c.next()
+		if c.is("(") {
+			c.call(t)
+			return operand{}
+		}
+		o := operand{kind: inVariable, sym: c.lookup(t)}
+		for c.accept("[") {
+			// The address of the element is the value of the operand plus the index
+			c.load0(o)
+			c.push()
+			c.value()
+			c.expect("]")
+			c.pop("R1")
+			c.emit("ADD R0, R1, R0")
+			o = operand{kind: atAddress}
+		}
+		return o
+	}
+	if c.accept("(") {
+		o := c.assignment()
+		c.expect(")")
+		return o
+	}
+	c.errorf(t.pos, "unexpected %v", t)
+	return operand{}
+}
+
+// call compiles a call of a function or a built-in function.
+func (c *compiler) call(name token) {
+	c.expect("(")
+	args := 0
+	_, builtin := builtins[name.text]
+	for !c.accept(")") {
+		if args > 0 {
+			c.expect(",")
+		}
+		c.value()
+		if !builtin {
+			c.push()
+		}
+		args++
+	}
+
+	if builtin {
+		if args != builtins[name.text] {
+			c.errorf(name.pos, "%s expects %d arguments, got %d", name.text, builtins[name.text], args)
+		}
+		switch name.text {
+		case "getc":
+			c.emit("GETC")
+		case "putc":
+			c.emit("OUT")
+		case "puts":
+			c.emit("PUTS")
+		case "halt":
+			c.emit("HALT")
+		}
+		return
+	}
+	c.calls = append(c.calls, call{pos: name.pos, name: name.text, args: args})
+	c.jsr("F_" + name.text)
+	if args > 0 {
+		c.add("R6", "R6", args)
+	}
+}
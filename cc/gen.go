@@ -0,0 +1,300 @@
+package cc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// emit appends an instruction to the function being compiled.
+func (c *compiler) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&c.body, "\t"+format+"\n", args...)
+}
+
+// Branches and calls are emitted as markers and replaced once the size of the code is
+// known: BR reaches 255 words and JSR 1023 words, beyond that the long forms load the
+// target from a .FILL next to the code into R2.
+const (
+	branchMarker = "\t@BR"
+	callMarker   = "\t@JSR "
+)
+
+// branch branches to label when one of the condition codes of cond is set.
+func (c *compiler) branch(cond, label string) {
+	c.emit("@BR%s %s", cond, label)
+}
+
+// jsr calls a function or a routine of the runtime.
+func (c *compiler) jsr(label string) {
+	c.emit("@JSR %s", label)
+}
+
+// resolve replaces the markers starting with prefix by the short or the long form.
+func (c *compiler) resolve(code, prefix string, long bool) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(code, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			b.WriteString(line)
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		op, target := fields[0], fields[1]
+		switch {
+		case !long:
+			fmt.Fprintf(&b, "\t%s %s\n", op, target)
+		case op == "JSR":
+			constant, next := c.label(), c.label()
+			fmt.Fprintf(&b, "\tLD R2, %s\n\tBRnzp %s\n%s\t.FILL %s\n%s\n\tJSRR R2\n", constant, next, constant, target, next)
+		default:
+			skip, constant := c.label(), c.label()
+			if cond := op[len("BR"):]; cond != "nzp" {
+				fmt.Fprintf(&b, "\tBR%s %s\n", inverse(cond), skip)
+			}
+			fmt.Fprintf(&b, "\tLD R2, %s\n\tJMP R2\n%s\t.FILL %s\n%s\n", constant, constant, target, skip)
+		}
+	}
+	return b.String()
+}
+
+// inverse returns the condition codes missing from cond.
+func inverse(cond string) string {
+	var b strings.Builder
+	for _, flag := range "nzp" {
+		if !strings.ContainsRune(cond, flag) {
+			b.WriteRune(flag)
+		}
+	}
+	return b.String()
+}
+
+// words returns the number of words of code, instructions and .FILL take one word and
+// calls take callWords as long as their markers are unresolved.
+func words(code string, callWords int) int {
+	n := 0
+	for _, line := range strings.Split(code, "\n") {
+		switch {
+		case strings.HasPrefix(line, callMarker):
+			n += callWords
+		case strings.HasPrefix(line, "\t;"):
+		case strings.Contains(line, "\t"):
+			n++
+		}
+	}
+	return n
+}
+
+// label returns a new label.
+func (c *compiler) label() string {
+	c.labels++
+	return fmt.Sprintf("L%d", c.labels)
+}
+
+// place defines a label at the next instruction.
+func (c *compiler) place(label string) {
+	fmt.Fprintf(&c.body, "%s\n", label)
+}
+
+// constant loads a value into a register. Values beyond the 5-bit immediates of ADD are
+// stored next to the code and jumped over.
+func (c *compiler) constant(reg string, value string) {
+	constant, next := c.label(), c.label()
+	c.emit("LD %s, %s", reg, constant)
+	c.emit("BRnzp %s", next)
+	fmt.Fprintf(&c.body, "%s\t.FILL %s\n", constant, value)
+	c.place(next)
+}
+
+// loadNumber loads an integer into a register.
+func (c *compiler) loadNumber(reg string, value int) {
+	value = signed(value)
+	if value < -16 || value > 15 {
+		c.constant(reg, fmt.Sprintf("#%d", value))
+		return
+	}
+	c.emit("AND %s, %s, #0", reg, reg)
+	if value != 0 {
+		c.emit("ADD %s, %s, #%d", reg, reg, value)
+	}
+}
+
+// add emits dst = src + n. Large values are loaded into dst first, or into R1 when dst
+// and src are the same register.
+func (c *compiler) add(dst, src string, n int) {
+	if n >= -16 && n <= 15 {
+		c.emit("ADD %s, %s, #%d", dst, src, n)
+		return
+	}
+	tmp := dst
+	if dst == src {
+		tmp = "R1"
+	}
+	c.loadNumber(tmp, n)
+	c.emit("ADD %s, %s, %s", dst, src, tmp)
+}
+
+// push pushes R0 on the stack.
+func (c *compiler) push() {
+	c.emit("ADD R6, R6, #-1")
+	c.emit("STR R0, R6, #0")
+}
+
+// pop pops the top of the stack into a register.
+func (c *compiler) pop(reg string) {
+	c.emit("LDR %s, R6, #0", reg)
+	c.emit("ADD R6, R6, #1")
+}
+
+// base returns the register variables are addressed from.
+func base(s *symbol) string {
+	if s.global {
+		return "R4"
+	}
+	return "R5"
+}
+
+// load loads a variable into a register, arrays are loaded as their address.
+func (c *compiler) load(reg string, s *symbol) {
+	switch {
+	case s.array:
+		c.add(reg, base(s), s.offset)
+	case s.offset >= -32 && s.offset <= 31:
+		c.emit("LDR %s, %s, #%d", reg, base(s), s.offset)
+	default:
+		c.add(reg, base(s), s.offset)
+		c.emit("LDR %s, %s, #0", reg, reg)
+	}
+}
+
+// store stores R0 into a variable.
+func (c *compiler) store(s *symbol) {
+	if s.offset >= -32 && s.offset <= 31 {
+		c.emit("STR R0, %s, #%d", base(s), s.offset)
+		return
+	}
+	c.add("R1", base(s), s.offset)
+	c.emit("STR R0, R1, #0")
+}
+
+// comment copies the source line of the current token into the code.
+func (c *compiler) comment() {
+	if line := c.tok.pos.Line; line > c.commented {
+		c.commented = line
+		if text := strings.TrimSpace(c.line(line)); text != "" {
+			c.emit("; %s", text)
+		}
+	}
+}
+
+// block compiles { statements }.
+func (c *compiler) block() {
+	c.expect("{")
+	c.scopes = append(c.scopes, map[string]*symbol{})
+	for !c.accept("}") {
+		if c.tok.kind == tokenEOF {
+			c.errorf(c.tok.pos, "expected }, got %v", c.tok)
+		}
+		c.statement()
+	}
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+// test branches to label when R0 is zero.
+func (c *compiler) test(label string) {
+	c.emit("ADD R0, R0, #0")
+	c.branch("z", label)
+}
+
+func (c *compiler) statement() {
+	c.comment()
+	pos := c.tok.pos
+	switch {
+	case c.is("{"):
+		c.block()
+	case c.accept(";"):
+	case c.accept("int"):
+		c.local(c.name())
+		for c.accept(",") {
+			c.local(c.name())
+		}
+		c.expect(";")
+	case c.accept("if"):
+		c.expect("(")
+		c.value()
+		c.expect(")")
+		otherwise := c.label()
+		c.test(otherwise)
+		c.statement()
+		if c.accept("else") {
+			end := c.label()
+			c.branch("nzp", end)
+			c.place(otherwise)
+			c.statement()
+			c.place(end)
+		} else {
+			c.place(otherwise)
+		}
+	case c.accept("while"):
+		start, end := c.label(), c.label()
+		c.place(start)
+		c.expect("(")
+		c.value()
+		c.expect(")")
+		c.test(end)
+		c.loops = append(c.loops, [2]string{start, end})
+		c.statement()
+		c.loops = c.loops[:len(c.loops)-1]
+		c.branch("nzp", start)
+		c.place(end)
+	case c.is("break"), c.is("continue"):
+		keyword := c.tok.text
+		c.next()
+		if len(c.loops) == 0 {
+			c.errorf(pos, "%s outside of a loop", keyword)
+		}
+		loop := c.loops[len(c.loops)-1]
+		c.expect(";")
+		if keyword == "break" {
+			c.branch("nzp", loop[1])
+		} else {
+			c.branch("nzp", loop[0])
+		}
+	case c.accept("return"):
+		if !c.is(";") {
+			if c.fn.void {
+				c.errorf(pos, "void function can't return a value")
+			}
+			c.value()
+		} else if !c.fn.void {
+			c.errorf(pos, "missing return value")
+		}
+		c.expect(";")
+		c.branch("nzp", c.ret)
+	default:
+		c.value()
+		c.expect(";")
+	}
+}
+
+// local declares "int name", "int name = value" and "int name[size]" in the current scope.
+func (c *compiler) local(name token) {
+	scope := c.scopes[len(c.scopes)-1]
+	if _, ok := scope[name.text]; ok {
+		c.errorf(name.pos, "%s redeclared", name.text)
+	}
+	s := &symbol{}
+	size := 1
+	if c.accept("[") {
+		pos := c.tok.pos
+		if size = c.number(); size <= 0 {
+			c.errorf(pos, "array %s must have a positive size", name.text)
+		}
+		c.expect("]")
+		s.array = true
+	}
+	c.frame += size
+	s.offset = -c.frame
+	scope[name.text] = s
+	if !s.array && c.accept("=") {
+		c.value()
+		c.store(s)
+	}
+}
@@ -0,0 +1,204 @@
+package cc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+)
+
+// tokenKind is the class of a token.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber // numbers and character literals
+	tokenString
+	tokenPunct // operators and punctuation
+	tokenKeyword
+)
+
+var keywords = map[string]bool{
+	"int": true, "void": true, "if": true, "else": true, "while": true, "return": true, "break": true, "continue": true,
+}
+
+// punctuation lists operators longest first.
+var punctuation = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "(", ")", "[", "]", "{", "}", ",", ";",
+}
+
+// token is a word of the source, string literals are unquoted.
+type token struct {
+	kind  tokenKind
+	text  string
+	value int // of numbers
+	pos   asm.Pos
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return t.text
+}
+
+// lexer splits the source into tokens.
+type lexer struct {
+	file  string
+	src   string
+	i     int
+	line  int
+	start int // offset of the current line
+}
+
+func (l *lexer) pos() asm.Pos {
+	return asm.Pos{File: l.file, Line: l.line, Column: l.i - l.start + 1}
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &asm.Error{Pos: l.pos(), Msg: fmt.Sprintf(format, args...)}
+}
+
+// skip skips white space and comments.
+func (l *lexer) skip() error {
+	for l.i < len(l.src) {
+		switch {
+		case l.src[l.i] == '\n':
+			l.i++
+			l.line++
+			l.start = l.i
+		case strings.ContainsRune(" \t\r", rune(l.src[l.i])):
+			l.i++
+		case strings.HasPrefix(l.src[l.i:], "//"):
+			for l.i < len(l.src) && l.src[l.i] != '\n' {
+				l.i++
+			}
+		case strings.HasPrefix(l.src[l.i:], "/*"):
+			pos := l.pos()
+			end := strings.Index(l.src[l.i+2:], "*/")
+			if end < 0 {
+				return &asm.Error{Pos: pos, Msg: "unterminated comment"}
+			}
+			for end += l.i + 4; l.i < end; l.i++ {
+				if l.src[l.i] == '\n' {
+					l.line++
+					l.start = l.i + 1
+				}
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// next returns the next token.
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	t := token{pos: l.pos()}
+	if l.i == len(l.src) {
+		return t, nil
+	}
+
+	c := l.src[l.i]
+	switch {
+	case isLetter(c):
+		start := l.i
+		for l.i < len(l.src) && (isLetter(l.src[l.i]) || isDigit(l.src[l.i])) {
+			l.i++
+		}
+		t.text = l.src[start:l.i]
+		t.kind = tokenName
+		if keywords[t.text] {
+			t.kind = tokenKeyword
+		}
+	case isDigit(c):
+		start := l.i
+		for l.i < len(l.src) && (isLetter(l.src[l.i]) || isDigit(l.src[l.i])) {
+			l.i++
+		}
+		t.kind, t.text = tokenNumber, l.src[start:l.i]
+		v, err := strconv.ParseInt(t.text, 0, 32)
+		if err != nil || v > 0xFFFF {
+			return t, &asm.Error{Pos: t.pos, Msg: fmt.Sprintf("invalid number %s", t.text)}
+		}
+		t.value = int(v)
+	case c == '\'':
+		s, err := l.quoted('\'')
+		if err != nil {
+			return t, err
+		}
+		if len(s) != 1 {
+			return t, &asm.Error{Pos: t.pos, Msg: "character literal must hold one character"}
+		}
+		t.kind, t.text, t.value = tokenNumber, l.src[t.pos.Column-1+l.start:l.i], int(s[0])
+	case c == '"':
+		s, err := l.quoted('"')
+		if err != nil {
+			return t, err
+		}
+		t.kind, t.text = tokenString, s
+	default:
+		for _, p := range punctuation {
+			if strings.HasPrefix(l.src[l.i:], p) {
+				l.i += len(p)
+				t.kind, t.text = tokenPunct, p
+				return t, nil
+			}
+		}
+		return t, l.errorf("unexpected character %q", c)
+	}
+	return t, nil
+}
+
+// quoted parses a string or character literal.
+func (l *lexer) quoted(quote byte) (string, error) {
+	pos := l.pos()
+	var b strings.Builder
+	for l.i++; l.i < len(l.src) && l.src[l.i] != '\n'; l.i++ {
+		c := l.src[l.i]
+		switch c {
+		case quote:
+			l.i++
+			return b.String(), nil
+		case '\\':
+			l.i++
+			if l.i == len(l.src) {
+				break
+			}
+			switch l.src[l.i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case '\\', '\'', '"':
+				b.WriteByte(l.src[l.i])
+			default:
+				return "", l.errorf("unknown escape sequence \\%c", l.src[l.i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", &asm.Error{Pos: pos, Msg: "unterminated literal"}
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
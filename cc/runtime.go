@@ -0,0 +1,116 @@
+package cc
+
+// startup sets up the stack and the globals and calls main.
+const startup = `	LD R6, __stack
+	ADD R5, R6, #0
+	LD R4, __globals
+	LD R0, __main
+	JSRR R0
+	HALT
+__stack	.FILL xFE00
+__globals	.FILL __data
+__main	.FILL F_main
+`
+
+// runtime holds the routines for the operations the LC-3 lacks. They compute R1 op R0
+// into R0, may change R1 and preserve the other registers.
+var runtime = map[string]string{
+	"cmp": `
+; R0 = R1 - R0 as far as its sign goes: negative, zero or positive as R1 is less than,
+; equal to or greater than R0. Operands of different signs are ordered by the sign of R1,
+; only operands of the same sign are subtracted, which can't overflow.
+__cmp	ADD R1, R1, #0
+	BRn __cmp_negative
+	ADD R0, R0, #0
+	BRzp __cmp_subtract
+	AND R0, R0, #0      ; R1 >= 0 > R0
+	ADD R0, R0, #1
+	RET
+__cmp_negative
+	ADD R0, R0, #0
+	BRn __cmp_subtract
+	AND R0, R0, #0      ; R1 < 0 <= R0
+	ADD R0, R0, #-1
+	RET
+__cmp_subtract
+	NOT R0, R0
+	ADD R0, R0, #1
+	ADD R0, R1, R0
+	RET
+`,
+	"mul": `
+; R0 = R1 * R0, adds R1 shifted left for each bit of R0
+__mul	ADD R6, R6, #-3
+	STR R2, R6, #0
+	STR R3, R6, #1
+	STR R4, R6, #2
+	AND R2, R2, #0      ; product
+	ADD R3, R2, #1      ; bit of R0
+__mul_loop
+	AND R4, R0, R3
+	BRz __mul_skip
+	ADD R2, R2, R1
+__mul_skip
+	ADD R1, R1, R1
+	ADD R3, R3, R3
+	BRnp __mul_loop     ; until the bit is shifted out
+	ADD R0, R2, #0
+	LDR R2, R6, #0
+	LDR R3, R6, #1
+	LDR R4, R6, #2
+	ADD R6, R6, #3
+	RET
+`,
+	"divmod": `
+; R0 = R1 / R0 and R1 = R1 % R0 truncated toward zero like C, by repeated subtraction.
+; Division by zero returns 0 and leaves R1.
+__divmod	ADD R6, R6, #-3
+	STR R2, R6, #0
+	STR R3, R6, #1
+	STR R4, R6, #2
+	AND R2, R2, #0      ; quotient
+	AND R3, R3, #0      ; -1 when the signs differ
+	AND R4, R4, #0      ; 1 when the dividend is negative
+	ADD R0, R0, #0
+	BRz __divmod_done
+	BRp __divmod_divisor
+	NOT R0, R0
+	ADD R0, R0, #1
+	NOT R3, R3
+__divmod_divisor
+	ADD R1, R1, #0
+	BRzp __divmod_dividend
+	NOT R1, R1
+	ADD R1, R1, #1
+	NOT R3, R3
+	ADD R4, R4, #1
+__divmod_dividend
+	NOT R0, R0
+	ADD R0, R0, #1      ; -|divisor|
+__divmod_loop
+	ADD R1, R1, R0
+	BRn __divmod_restore
+	ADD R2, R2, #1
+	BRnzp __divmod_loop
+__divmod_restore
+	NOT R0, R0
+	ADD R0, R0, #1
+	ADD R1, R1, R0      ; remainder
+	ADD R3, R3, #0
+	BRz __divmod_sign
+	NOT R2, R2
+	ADD R2, R2, #1
+__divmod_sign
+	ADD R4, R4, #0
+	BRz __divmod_done
+	NOT R1, R1
+	ADD R1, R1, #1
+__divmod_done
+	ADD R0, R2, #0
+	LDR R2, R6, #0
+	LDR R3, R6, #1
+	LDR R4, R6, #2
+	ADD R6, R6, #3
+	RET
+`,
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/cfg"
+)
+
+// cfgCommand prints the control-flow graph of a program as text or as a Graphviz DOT graph.
+func cfgCommand(args []string) {
+	flags := flag.NewFlagSet("cfg", flag.ExitOnError)
+	format := flags.String("format", "text", "output `format`, text or dot")
+	output := flags.String("o", "", "write the graph to `file` instead of stdout")
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) != 1 || (*format != "text" && *format != "dot") {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm cfg [--format=text|dot] [-o file] program.obj|source.asm")
+		os.Exit(2)
+	}
+	path := paths[0]
+	object, debug := readProgram(path)
+	g, err := cfg.FromObject(object)
+	if err != nil {
+		log.Fatalf("Can't read program %s: %v", path, err)
+	}
+
+	name := labelsOf(debug)
+	write := func(w io.Writer) error {
+		if *format == "dot" {
+			return g.WriteDOT(w, filepath.Base(path), name)
+		}
+		return writeBlocks(w, g, name)
+	}
+	if *output == "" {
+		if err := write(os.Stdout); err != nil {
+			log.Fatalf("Can't write graph: %v", err)
+		}
+		return
+	}
+	writeFile(*output, write)
+}
+
+// writeBlocks lists the blocks of a graph with their instructions and successors.
+func writeBlocks(w io.Writer, g *cfg.Graph, name func(uint16) (string, bool)) error {
+	var sb strings.Builder
+	for i, b := range g.Blocks {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "block x%04X", b.Start)
+		if name != nil {
+			if label, ok := name(b.Start); ok {
+				sb.WriteString(" " + label)
+			}
+		}
+		succs := []string{"none"}
+		if len(b.Succs) > 0 {
+			succs = succs[:0]
+		}
+		for _, e := range b.Succs {
+			succs = append(succs, fmt.Sprintf("x%04X (%s)", e.To.Start, e.Kind))
+		}
+		fmt.Fprintf(&sb, " -> %s\n", strings.Join(succs, ", "))
+		for _, ins := range b.Instructions {
+			fmt.Fprintf(&sb, "\tx%04X  %s\n", ins.Address, ins.Format(name))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// parseInterspersed parses flags which may follow the positional arguments, as in
+// "cfg prog.obj --format=dot", and returns the positional arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = flags.Parse(args)
+		if flags.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
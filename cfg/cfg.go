@@ -0,0 +1,404 @@
+// Package cfg builds control-flow graphs of LC-3 programs. Instructions are decoded by the
+// rules of the VM and only instructions reachable from the entry point are part of the graph.
+package cfg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// Instruction is an instruction of a program.
+type Instruction struct {
+	Address uint16
+	vm.Instruction
+}
+
+// Target returns the address a BR or JSR jumps to. BR without condition codes never
+// jumps, JMP, JSRR and RET have no static target.
+func (i Instruction) Target() (uint16, bool) {
+	if (i.Op == vm.OP_BR && i.NZP != 0) || (i.Op == vm.OP_JSR && i.Imm) {
+		return i.Address + 1 + i.Offset, true
+	}
+	return 0, false
+}
+
+// Continues reports whether execution may continue with the next instruction, calls are
+// assumed to return.
+func (i Instruction) Continues() bool {
+	switch i.Op {
+	case vm.OP_BR:
+		return i.NZP != vm.FL_NEG|vm.FL_ZRO|vm.FL_POS
+	case vm.OP_JMP, vm.OP_RTI:
+		return false
+	case vm.OP_TRAP:
+		return i.TrapVector() != vm.TRAP_HALT
+	}
+	return true
+}
+
+// Indirect reports whether the instruction is a JMP, other than RET, or a JSRR, which
+// jump to the address in a register.
+func (i Instruction) Indirect() bool {
+	return (i.Op == vm.OP_JMP && i.R1 != vm.R_R7) || (i.Op == vm.OP_JSR && !i.Imm)
+}
+
+// writes reports whether the instruction writes register r.
+func (i Instruction) writes(r uint16) bool {
+	switch i.Op {
+	case vm.OP_ADD, vm.OP_AND, vm.OP_NOT, vm.OP_LD, vm.OP_LDI, vm.OP_LDR, vm.OP_LEA:
+		return i.R0 == r
+	case vm.OP_JSR:
+		return r == vm.R_R7
+	case vm.OP_TRAP:
+		input := i.TrapVector() == vm.TRAP_GETC || i.TrapVector() == vm.TRAP_IN
+		return r == vm.R_R7 || (input && r == vm.R_R0)
+	}
+	return false
+}
+
+// endsBlock reports whether an instruction is the last one of its block.
+func (i Instruction) endsBlock() bool {
+	_, jumps := i.Target()
+	return jumps || !i.Continues() || i.Op == vm.OP_JSR
+}
+
+// Mnemonic returns the name of the instruction, as in BRnz, JSRR, RET or PUTS.
+func (i Instruction) Mnemonic() string {
+	switch i.Op {
+	case vm.OP_BR:
+		name := "BR"
+		for _, f := range []struct {
+			flag uint16
+			name string
+		}{{vm.FL_NEG, "n"}, {vm.FL_ZRO, "z"}, {vm.FL_POS, "p"}} {
+			if i.NZP&f.flag != 0 {
+				name += f.name
+			}
+		}
+		return name
+	case vm.OP_JMP:
+		if i.R1 == vm.R_R7 {
+			return "RET"
+		}
+	case vm.OP_JSR:
+		if !i.Imm {
+			return "JSRR"
+		}
+	case vm.OP_TRAP:
+		if name := vm.TrapName(i.TrapVector()); name[0] != 'x' {
+			return name
+		}
+	}
+	return vm.OpcodeName(i.Op)
+}
+
+// Format disassembles the instruction, name returns the label of an address to use
+// instead of hex, it may be nil. Words the VM can't execute are formatted as .FILL.
+func (i Instruction) Format(name func(address uint16) (string, bool)) string {
+	address := func(a uint16) string {
+		if name != nil {
+			if label, ok := name(a); ok {
+				return label
+			}
+		}
+		return fmt.Sprintf("x%04X", a)
+	}
+	target := i.Address + 1 + i.Offset
+	switch i.Op {
+	case vm.OP_ADD, vm.OP_AND:
+		if i.Imm {
+			return fmt.Sprintf("%s R%d, R%d, #%d", i.Mnemonic(), i.R0, i.R1, int16(i.Offset))
+		}
+		return fmt.Sprintf("%s R%d, R%d, R%d", i.Mnemonic(), i.R0, i.R1, i.R2)
+	case vm.OP_NOT:
+		return fmt.Sprintf("NOT R%d, R%d", i.R0, i.R1)
+	case vm.OP_BR:
+		if i.NZP == 0 {
+			return "NOP"
+		}
+		return fmt.Sprintf("%s %s", i.Mnemonic(), address(target))
+	case vm.OP_LD, vm.OP_LDI, vm.OP_LEA, vm.OP_ST, vm.OP_STI:
+		return fmt.Sprintf("%s R%d, %s", i.Mnemonic(), i.R0, address(target))
+	case vm.OP_LDR, vm.OP_STR:
+		return fmt.Sprintf("%s R%d, R%d, #%d", i.Mnemonic(), i.R0, i.R1, int16(i.Offset))
+	case vm.OP_JMP:
+		if i.R1 == vm.R_R7 {
+			return "RET"
+		}
+		return fmt.Sprintf("JMP R%d", i.R1)
+	case vm.OP_JSR:
+		if i.Imm {
+			return "JSR " + address(target)
+		}
+		return fmt.Sprintf("JSRR R%d", i.R1)
+	case vm.OP_TRAP:
+		if name := i.Mnemonic(); name != "TRAP" {
+			return name
+		}
+		return fmt.Sprintf("TRAP x%02X", i.TrapVector())
+	case vm.OP_RTI:
+		return "RTI"
+	}
+	return fmt.Sprintf(".FILL x%04X", i.Word)
+}
+
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// EdgeKind tells how control passes along an edge.
+type EdgeKind int
+
+// Edge kinds.
+const (
+	Next   EdgeKind = iota // to the following instruction, including the return from a call
+	Branch                 // a taken BR
+	Call                   // a JSR or JSRR to a subroutine
+	Jump                   // a JMP whose register holds a constant
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case Next:
+		return "next"
+	case Branch:
+		return "branch"
+	case Call:
+		return "call"
+	case Jump:
+		return "jump"
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+// Edge connects two blocks.
+type Edge struct {
+	From, To *Block
+	Kind     EdgeKind
+}
+
+// Block is a basic block, a straight sequence of instructions which is only entered at
+// its first instruction and left after its last one.
+type Block struct {
+	Start        uint16
+	Instructions []Instruction
+	Succs        []*Edge
+	Preds        []*Edge
+}
+
+// Last returns the last instruction of the block.
+func (b *Block) Last() Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Graph is the control-flow graph of a program.
+type Graph struct {
+	Origin uint16
+	Words  []uint16
+	Entry  *Block   // nil when the entry point is outside of the program
+	Blocks []*Block // ordered by address
+	// Subroutines are the blocks called by JSR or JSRR, ordered by address.
+	Subroutines []*Block
+
+	blocks   map[uint16]*Block
+	code     map[uint16]bool
+	resolved map[uint16]uint16 // targets of indirect jumps by the address of the jump
+}
+
+// FromObject builds the graph of an object file. The program is entered at vm.PC_START
+// like the VM does, or at its origin when it doesn't contain vm.PC_START.
+func FromObject(b []byte) (*Graph, error) {
+	if len(b) < 2 {
+		return nil, vm.ErrObjectTooShort
+	}
+	if len(b)%2 != 0 {
+		return nil, vm.ErrObjectOddLength
+	}
+	origin := binary.BigEndian.Uint16(b)
+	words := make([]uint16, (len(b)-2)/2)
+	if int(origin)+len(words) > vm.MaxMemorySize {
+		return nil, vm.ErrObjectTooLarge
+	}
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(b[2+2*i:])
+	}
+
+	g := &Graph{Origin: origin, Words: words}
+	entry := vm.PC_START
+	if !g.Contains(entry) {
+		entry = origin
+	}
+	return Build(origin, words, entry), nil
+}
+
+// Build builds the graph of a program loaded at origin and entered at entry.
+func Build(origin uint16, words []uint16, entry uint16) *Graph {
+	g := &Graph{Origin: origin, Words: words, blocks: map[uint16]*Block{}, code: map[uint16]bool{}, resolved: map[uint16]uint16{}}
+	leaders := map[uint16]bool{entry: true}
+	subroutines := map[uint16]bool{}
+	work := []uint16{entry}
+	for len(work) > 0 {
+		g.explore(work, leaders, subroutines)
+		g.split(leaders)
+
+		// Resolving indirect jumps may reveal more code, which is explored in another round
+		work = nil
+		for _, b := range g.Blocks {
+			last := b.Last()
+			if _, ok := g.resolved[last.Address]; ok || !last.Indirect() {
+				continue
+			}
+			target, ok := g.resolve(b)
+			if !ok || !g.Contains(target) {
+				continue
+			}
+			g.resolved[last.Address] = target
+			leaders[target] = true
+			if last.Op == vm.OP_JSR {
+				subroutines[target] = true
+			}
+			work = append(work, target)
+		}
+	}
+
+	for _, b := range g.Blocks {
+		last := b.Last()
+		if target, ok := g.Target(last); ok {
+			kind := Branch
+			switch {
+			case last.Op == vm.OP_JSR:
+				kind = Call
+			case last.Op == vm.OP_JMP:
+				kind = Jump
+			}
+			g.connect(b, g.blocks[target], kind)
+		}
+		if last.Continues() && last.Address != 0xFFFF {
+			g.connect(b, g.blocks[last.Address+1], Next)
+		}
+	}
+	for _, b := range g.Blocks {
+		if subroutines[b.Start] {
+			g.Subroutines = append(g.Subroutines, b)
+		}
+	}
+	g.Entry = g.blocks[entry]
+	return g
+}
+
+// explore marks the instructions reachable from work and the first instructions of blocks.
+func (g *Graph) explore(work []uint16, leaders, subroutines map[uint16]bool) {
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+		for g.Contains(address) && !g.code[address] {
+			g.code[address] = true
+			ins := g.Instruction(address)
+			if target, ok := ins.Target(); ok && g.Contains(target) {
+				leaders[target] = true
+				work = append(work, target)
+				if ins.Op == vm.OP_JSR {
+					subroutines[target] = true
+				}
+			}
+			if !ins.Continues() || address == 0xFFFF {
+				break
+			}
+			address++
+			if ins.endsBlock() {
+				leaders[address] = true
+			}
+		}
+	}
+}
+
+// split partitions the reachable instructions into blocks.
+func (g *Graph) split(leaders map[uint16]bool) {
+	g.blocks, g.Blocks = map[uint16]*Block{}, nil
+	for address := range leaders {
+		if !g.code[address] {
+			continue
+		}
+		b := &Block{Start: address}
+		for {
+			ins := g.Instruction(address)
+			b.Instructions = append(b.Instructions, ins)
+			if ins.endsBlock() || address == 0xFFFF || leaders[address+1] || !g.code[address+1] {
+				break
+			}
+			address++
+		}
+		g.blocks[b.Start] = b
+		g.Blocks = append(g.Blocks, b)
+	}
+	sort.Slice(g.Blocks, func(i, j int) bool { return g.Blocks[i].Start < g.Blocks[j].Start })
+}
+
+// resolve finds the target of the JMP or JSRR ending a block when its register was set
+// from a constant earlier in the block, by LEA or by LD of a word of the program.
+func (g *Graph) resolve(b *Block) (uint16, bool) {
+	last := b.Last()
+	for i := len(b.Instructions) - 2; i >= 0; i-- {
+		ins := b.Instructions[i]
+		if !ins.writes(last.R1) {
+			continue
+		}
+		address := ins.Address + 1 + ins.Offset
+		switch {
+		case ins.Op == vm.OP_LEA:
+			return address, true
+		case ins.Op == vm.OP_LD && g.Contains(address):
+			return g.Word(address), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// Target returns the address an instruction jumps to, including JMP and JSRR which were
+// resolved from constants.
+func (g *Graph) Target(ins Instruction) (uint16, bool) {
+	if target, ok := ins.Target(); ok {
+		return target, true
+	}
+	target, ok := g.resolved[ins.Address]
+	return target, ok
+}
+
+func (g *Graph) connect(from, to *Block, kind EdgeKind) {
+	if to == nil {
+		// The target is outside of the program
+		return
+	}
+	e := &Edge{From: from, To: to, Kind: kind}
+	from.Succs = append(from.Succs, e)
+	to.Preds = append(to.Preds, e)
+}
+
+// Contains reports whether address belongs to the program.
+func (g *Graph) Contains(address uint16) bool {
+	return address >= g.Origin && int(address) < int(g.Origin)+len(g.Words)
+}
+
+// Word returns the word of the program at address.
+func (g *Graph) Word(address uint16) uint16 {
+	return g.Words[address-g.Origin]
+}
+
+// Instruction decodes the word at address.
+func (g *Graph) Instruction(address uint16) Instruction {
+	return Instruction{Address: address, Instruction: vm.Decode(g.Word(address))}
+}
+
+// IsCode reports whether address holds a reachable instruction.
+func (g *Graph) IsCode(address uint16) bool {
+	return g.code[address]
+}
+
+// Block returns the block starting at address.
+func (g *Graph) Block(address uint16) *Block {
+	return g.blocks[address]
+}
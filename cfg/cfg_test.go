@@ -0,0 +1,133 @@
+package cfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+func build(t *testing.T, src string) *Graph {
+	t.Helper()
+	p, err := asm.Assemble("test.asm", []byte(src))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	g, err := FromObject(p.Object())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return g
+}
+
+func starts(blocks []*Block) []uint16 {
+	var s []uint16
+	for _, b := range blocks {
+		s = append(s, b.Start)
+	}
+	return s
+}
+
+func TestBuild(t *testing.T) {
+	g := build(t, `
+	.ORIG x3000
+	AND R0, R0, #0     ; x3000
+LOOP	ADD R0, R0, #1     ; x3001
+	BRn DONE           ; x3002
+	JSR SUB            ; x3003
+	BRnzp LOOP         ; x3004
+DONE	HALT               ; x3005
+	ADD R1, R1, #1     ; x3006 unreachable
+SUB	ADD R2, R2, #1     ; x3007
+	RET                ; x3008
+	.END
+`)
+	assert.Equal(t, uint16(0x3000), g.Entry.Start)
+	assert.Equal(t, []uint16{0x3000, 0x3001, 0x3003, 0x3004, 0x3005, 0x3007}, starts(g.Blocks))
+	assert.Equal(t, []uint16{0x3007}, starts(g.Subroutines))
+	assert.False(t, g.IsCode(0x3006))
+	assert.True(t, g.IsCode(0x3008))
+
+	succs := func(address uint16) map[uint16]EdgeKind {
+		m := map[uint16]EdgeKind{}
+		for _, e := range g.Block(address).Succs {
+			m[e.To.Start] = e.Kind
+		}
+		return m
+	}
+	assert.Equal(t, map[uint16]EdgeKind{0x3001: Next}, succs(0x3000))
+	assert.Equal(t, map[uint16]EdgeKind{0x3003: Next, 0x3005: Branch}, succs(0x3001))
+	assert.Equal(t, map[uint16]EdgeKind{0x3004: Next, 0x3007: Call}, succs(0x3003))
+	assert.Equal(t, map[uint16]EdgeKind{0x3001: Branch}, succs(0x3004))
+	assert.Empty(t, succs(0x3005))
+	assert.Empty(t, succs(0x3007))
+	assert.Len(t, g.Block(0x3001).Preds, 2)
+}
+
+func TestFromObject(t *testing.T) {
+	_, err := FromObject([]byte{0x30})
+	assert.NotNil(t, err)
+
+	// Entered at the origin when x3000 isn't part of the program
+	g, err := FromObject([]byte{0x40, 0x00, 0xF0, 0x25})
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0x4000), g.Entry.Start)
+	assert.Equal(t, "HALT", g.Entry.Last().Mnemonic())
+}
+
+func TestInstruction_Mnemonic(t *testing.T) {
+	for word, want := range map[uint16]string{
+		0x0C00: "BRnz", 0x0A00: "BRnp", 0x0E00: "BRnzp", 0xC1C0: "RET", 0xC080: "JMP", 0x4080: "JSRR", 0x4800: "JSR",
+		0xF022: "PUTS", 0xF030: "TRAP", 0x1000: "ADD",
+	} {
+		g := Build(0x3000, []uint16{word}, 0x3000)
+		assert.Equal(t, want, g.Instruction(0x3000).Mnemonic(), "x%04X", word)
+	}
+}
+
+func TestBuild_indirect(t *testing.T) {
+	g := build(t, `
+	.ORIG x3000
+	LEA R1, SUB        ; x3000
+	JSRR R1            ; x3001
+	LD R2, PTR         ; x3002
+	JMP R2             ; x3003
+	JMP R3             ; x3004 unreachable
+DONE	HALT               ; x3005
+SUB	RET                ; x3006
+PTR	.FILL DONE         ; x3007
+	.END
+`)
+	assert.Equal(t, []uint16{0x3000, 0x3002, 0x3005, 0x3006}, starts(g.Blocks))
+	assert.Equal(t, []uint16{0x3006}, starts(g.Subroutines))
+
+	target, ok := g.Target(g.Instruction(0x3001))
+	assert.True(t, ok)
+	assert.Equal(t, uint16(0x3006), target)
+	target, ok = g.Target(g.Instruction(0x3003))
+	assert.True(t, ok)
+	assert.Equal(t, uint16(0x3005), target)
+	_, ok = g.Target(g.Instruction(0x3004))
+	assert.False(t, ok)
+	assert.Equal(t, Jump, g.Block(0x3002).Succs[0].Kind)
+}
+
+func TestInstruction_Format(t *testing.T) {
+	labels := map[uint16]string{0x3000: "START"}
+	name := func(address uint16) (string, bool) {
+		l, ok := labels[address]
+		return l, ok
+	}
+	for word, want := range map[uint16]string{
+		0x1730: "ADD R3, R4, #-16", 0x5242: "AND R1, R1, R2", 0x987F: "NOT R4, R1", 0x0BFF: "BRnp START",
+		0x0000: "NOP", 0x21FF: "LD R0, START", 0xE002: "LEA R0, x3003", 0x6E81: "LDR R7, R2, #1",
+		0xC1C0: "RET", 0xC080: "JMP R2", 0x4FFF: "JSR START", 0x4080: "JSRR R2", 0xF025: "HALT",
+		0xF030: "TRAP x30", 0x8000: "RTI", 0xD123: ".FILL xD123",
+	} {
+		ins := Instruction{Address: 0x3000, Instruction: vm.Decode(word)}
+		assert.Equal(t, want, ins.Format(name), "x%04X", word)
+	}
+	assert.Equal(t, "BRnp x3000", Instruction{Address: 0x3000, Instruction: vm.Decode(0x0BFF)}.String())
+}
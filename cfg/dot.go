@@ -0,0 +1,92 @@
+package cfg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// WriteDOT writes the graph in the DOT language of Graphviz. Blocks are boxes listing their
+// instructions, name labels addresses like in Instruction.Format and may be nil. TRAP
+// instructions point to a node per service routine and jumps through registers which
+// couldn't be resolved point to the node "?".
+func (g *Graph) WriteDOT(w io.Writer, title string, name func(address uint16) (string, bool)) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", quote(title))
+	sb.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	if g.Entry != nil {
+		fmt.Fprintf(&sb, "\tentry [shape=point];\n\tentry -> %s;\n", node(g.Entry.Start))
+	}
+
+	traps := map[uint16]bool{}
+	unknown := false
+	for _, b := range g.Blocks {
+		var label strings.Builder
+		if name != nil {
+			if l, ok := name(b.Start); ok {
+				label.WriteString(l + ":\\l")
+			}
+		}
+		for _, ins := range b.Instructions {
+			fmt.Fprintf(&label, "x%04X  %s\\l", ins.Address, escape(ins.Format(name)))
+		}
+		fmt.Fprintf(&sb, "\t%s [label=\"%s\"];\n", node(b.Start), label.String())
+
+		for _, e := range b.Succs {
+			fmt.Fprintf(&sb, "\t%s -> %s", node(b.Start), node(e.To.Start))
+			switch e.Kind {
+			case Branch:
+				fmt.Fprintf(&sb, " [label=%s]", quote(b.Last().Mnemonic()))
+			case Call:
+				sb.WriteString(" [label=call, style=bold]")
+			case Jump:
+				fmt.Fprintf(&sb, " [label=%s]", quote(b.Last().Format(nil)))
+			}
+			sb.WriteString(";\n")
+		}
+		for _, ins := range b.Instructions {
+			if ins.Op == vm.OP_TRAP {
+				traps[ins.TrapVector()] = true
+				fmt.Fprintf(&sb, "\t%s -> trap_x%02X [style=dashed];\n", node(b.Start), ins.TrapVector())
+			}
+		}
+		if last := b.Last(); last.Indirect() {
+			if _, ok := g.Target(last); !ok {
+				unknown = true
+				fmt.Fprintf(&sb, "\t%s -> unknown [label=%s, style=dashed];\n", node(b.Start), quote(last.Format(nil)))
+			}
+		}
+	}
+
+	vectors := make([]int, 0, len(traps))
+	for v := range traps {
+		vectors = append(vectors, int(v))
+	}
+	sort.Ints(vectors)
+	for _, v := range vectors {
+		fmt.Fprintf(&sb, "\ttrap_x%02X [shape=ellipse, label=%s];\n", v, quote(vm.TrapName(uint16(v))))
+	}
+	if unknown {
+		sb.WriteString("\tunknown [shape=diamond, label=\"?\"];\n")
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// node returns the DOT identifier of the block starting at address.
+func node(address uint16) string {
+	return fmt.Sprintf("x%04X", address)
+}
+
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
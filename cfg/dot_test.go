@@ -0,0 +1,45 @@
+package cfg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph_WriteDOT(t *testing.T) {
+	g := build(t, `
+	.ORIG x3000
+START	LEA R0, MSG
+	PUTS
+	JSR SUB
+	LD R1, PTR
+	JMP R1
+SUB	JMP R5
+MSG	.STRINGZ "a"
+PTR	.FILL START
+	.END
+`)
+	labels := map[uint16]string{0x3000: "START", 0x3005: "SUB"}
+	var out bytes.Buffer
+	assert.Nil(t, g.WriteDOT(&out, "test.obj", func(address uint16) (string, bool) {
+		l, ok := labels[address]
+		return l, ok
+	}))
+	assert.Equal(t, `digraph "test.obj" {
+	node [shape=box, fontname=monospace];
+	entry [shape=point];
+	entry -> x3000;
+	x3000 [label="START:\lx3000  LEA R0, x3006\lx3001  PUTS\lx3002  JSR SUB\l"];
+	x3000 -> x3005 [label=call, style=bold];
+	x3000 -> x3003;
+	x3000 -> trap_x22 [style=dashed];
+	x3003 [label="x3003  LD R1, x3008\lx3004  JMP R1\l"];
+	x3003 -> x3000 [label="JMP R1"];
+	x3005 [label="SUB:\lx3005  JMP R5\l"];
+	x3005 -> unknown [label="JMP R5", style=dashed];
+	trap_x22 [shape=ellipse, label="PUTS"];
+	unknown [shape=diamond, label="?"];
+}
+`, out.String())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/cc"
+)
+
+// compileCommand compiles a program of the C-like language into an object file or into assembly.
+func compileCommand(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	output := flags.String("o", "", "write the output to `file`, defaults to the source with .obj or .asm extension")
+	assembly := flags.Bool("S", false, "write LC-3 assembly instead of an object file")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm compile [-S] [-o file] source.c")
+		os.Exit(2)
+	}
+	source := flags.Arg(0)
+	src, err := ioutil.ReadFile(source) //nolint: gosec
+	if err != nil {
+		log.Fatalf("Can't read source: %v", err)
+	}
+	ext := ".obj"
+	if *assembly {
+		ext = ".asm"
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(source, filepath.Ext(source)) + ext
+	}
+
+	if *assembly {
+		code, err := cc.Compile(source, src)
+		exitOnCompileError(source, err)
+		if err := ioutil.WriteFile(*output, []byte(code), 0o644); err != nil { //nolint: gosec
+			log.Fatalf("Can't write assembly: %v", err)
+		}
+		return
+	}
+	p, err := cc.Build(source, src)
+	exitOnCompileError(source, err)
+	if err := ioutil.WriteFile(*output, p.Object(), 0o644); err != nil { //nolint: gosec
+		log.Fatalf("Can't write object file: %v", err)
+	}
+}
+
+func exitOnCompileError(source string, err error) {
+	if errs, ok := err.(asm.ErrorList); ok {
+		log.Fatalf("Can't compile %s:\n%s", source, errs.Detail())
+	}
+	if err != nil {
+		log.Fatalf("Can't compile %s: %v", source, err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// convertCommand converts an object file between the binary .obj format and the .hex and
+// .bin text formats.
+func convertCommand(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := flags.String("to", "", "output `format`, obj, hex or bin, defaults to the extension of the output")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm convert [--to obj|hex|bin] input output")
+		os.Exit(2)
+	}
+	format := vm.FormatOfPath(flags.Arg(1))
+	if *to != "" {
+		var err error
+		if format, err = vm.ParseObjectFormat(*to); err != nil {
+			log.Fatalf("Can't convert: %v", err)
+		}
+	}
+
+	obj, err := vm.ReadObject(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Can't read object file: %v", err)
+	}
+	b, err := vm.EncodeObject(obj, format)
+	if err != nil {
+		log.Fatalf("Can't convert %s: %v", flags.Arg(0), err)
+	}
+	if err := ioutil.WriteFile(flags.Arg(1), b, 0o644); err != nil { //nolint: gosec
+		log.Fatalf("Can't write object file: %v", err)
+	}
+}
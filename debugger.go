@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/idexter/golang-lc3-vm/cfg"
+	"github.com/idexter/golang-lc3-vm/grade"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+const debugHelp = `Commands:
+  s, step [n]             execute n instructions, 1 by default
+  n, next                 execute an instruction, calls and traps run until they return
+  c, continue             run until a breakpoint or HALT, Ctrl-C interrupts
+  b, break [address]      set a breakpoint, without an address list the breakpoints
+  d, delete address       delete a breakpoint
+  r, regs                 print the registers
+  x, mem address [n]      print n words of memory, 8 by default
+  l, list [address] [n]   disassemble n instructions, 10 from the PC by default
+  set R0-R7|PC|address v  set a register or a word of memory
+  q, quit                 exit the debugger
+Addresses are labels or numbers like x3000, values are numbers like #-1 or x41.
+`
+
+// debugCommand runs a program under an interactive debugger.
+func debugCommand(args []string) {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	input := flags.String("input", "", "type the contents of `file` on the keyboard instead of reading the commands input")
+	start := wordFlag(vm.PC_START)
+	flags.Var(&start, "start", "start the program at `address` instead of x3000")
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm debug [--input file] [--start address] program.obj|source.asm")
+		os.Exit(2)
+	}
+	object, debug := readProgram(paths[0])
+	var keyboard *vm.Keyboard
+	if *input != "" {
+		b, err := ioutil.ReadFile(*input)
+		if err != nil {
+			log.Fatalf("Can't read input: %v", err)
+		}
+		keyboard = vm.NewKeyboard(b)
+	}
+	d, err := newDebugger(object, debug, uint16(start), os.Stdin, os.Stdout, keyboard)
+	if err != nil {
+		log.Fatalf("Can't load program: %v", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			atomic.StoreInt32(&d.interrupted, 1)
+		}
+	}()
+
+	if !d.loop() {
+		os.Exit(1)
+	}
+}
+
+// debugger executes a CPU instruction by instruction.
+type debugger struct {
+	cpu         *vm.LC3CPU
+	in          *bufio.Reader
+	out         io.Writer
+	breakpoints map[uint16]bool
+	interrupted int32 // set on Ctrl-C to stop continue
+}
+
+// newDebugger loads a program which starts at start. Commands are read from in, the
+// program types keyboard or, when it is nil, the lines of in after the commands.
+func newDebugger(object []byte, debug *vm.DebugInfo, start uint16, in io.Reader, out io.Writer, keyboard *vm.Keyboard) (*debugger, error) {
+	d := &debugger{in: bufio.NewReader(in), out: out, breakpoints: map[uint16]bool{}}
+	ram := &vm.LC3RAM{}
+	if keyboard != nil {
+		ram.CheckKey, ram.GetChar = keyboard.CheckKey, keyboard.GetChar
+	} else {
+		ram.CheckKey = func() bool { return d.in.Buffered() > 0 }
+		ram.GetChar = func() uint16 {
+			c, err := d.in.ReadByte()
+			if err != nil {
+				return 0
+			}
+			return uint16(c)
+		}
+	}
+	d.cpu = vm.NewCPU(ram, out)
+	if err := ram.LoadObject(object); err != nil {
+		return nil, err
+	}
+	ram.Debug = debug
+	d.cpu.SetPC(start)
+	d.cpu.SetReg(vm.R_COND, vm.FL_ZRO)
+	return d, nil
+}
+
+// loop reads and executes commands until quit or the end of the input, it reports whether
+// the program halted.
+func (d *debugger) loop() bool {
+	d.where()
+	for {
+		fmt.Fprint(d.out, "(lc3) ")
+		line, err := d.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(d.out)
+			return d.cpu.Halted()
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return d.cpu.Halted()
+		}
+		if err := d.command(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(d.out, "error: %v\n", err)
+		}
+	}
+}
+
+func (d *debugger) command(name string, args []string) error {
+	switch name {
+	case "s", "step":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of instructions: %s", args[0])
+			}
+		}
+		for i := 0; i < n && d.step(); i++ {
+		}
+		d.where()
+	case "n", "next":
+		d.next()
+		d.where()
+	case "c", "continue":
+		d.run(nil)
+		d.where()
+	case "b", "break":
+		if len(args) == 0 {
+			d.listBreakpoints()
+			return nil
+		}
+		a, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+		d.breakpoints[a] = true
+		fmt.Fprintf(d.out, "breakpoint at %s\n", d.cpu.Location(a))
+	case "d", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("delete needs an address")
+		}
+		a, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+		if !d.breakpoints[a] {
+			return fmt.Errorf("no breakpoint at x%04X", a)
+		}
+		delete(d.breakpoints, a)
+	case "r", "regs":
+		d.registers()
+	case "x", "mem":
+		return d.memory(args)
+	case "l", "list":
+		return d.list(args)
+	case "set":
+		return d.set(args)
+	case "h", "help":
+		fmt.Fprint(d.out, debugHelp)
+	default:
+		return fmt.Errorf("unknown command %s, help lists the commands", name)
+	}
+	return nil
+}
+
+// step executes one instruction, it reports whether the program can continue.
+func (d *debugger) step() bool {
+	if d.cpu.Halted() {
+		fmt.Fprintln(d.out, "the program halted")
+		return false
+	}
+	d.cpu.SetInstructionLimit(d.cpu.Instructions() + 1)
+	d.cpu.Resume()
+	return !d.cpu.Halted()
+}
+
+// next executes an instruction, a call runs until it returns to the frame it was made from.
+func (d *debugger) next() {
+	if vm.Decode(d.cpu.Memory().Peek(d.cpu.PC())).Op != vm.OP_JSR {
+		d.step()
+		return
+	}
+	// Recursive calls return to the same address, so count the calls which are active
+	depth := 0
+	h := &vm.Hooks{AfterInstruction: func(_, instr uint16) {
+		switch ins := vm.Decode(instr); {
+		case ins.Op == vm.OP_JSR:
+			depth++
+		case ins.Op == vm.OP_JMP && ins.R1 == vm.R_R7:
+			depth--
+		}
+	}}
+	d.cpu.AddHooks(h)
+	defer d.cpu.RemoveHooks(h)
+	d.run(func(uint16) bool { return depth <= 0 })
+}
+
+// run executes instructions until the PC reaches a breakpoint or until returns true, which
+// may be nil.
+func (d *debugger) run(until func(pc uint16) bool) {
+	atomic.StoreInt32(&d.interrupted, 0)
+	for d.step() {
+		pc := d.cpu.PC()
+		if d.breakpoints[pc] || (until != nil && until(pc)) {
+			return
+		}
+		if atomic.LoadInt32(&d.interrupted) != 0 {
+			fmt.Fprintln(d.out, "interrupted")
+			return
+		}
+	}
+}
+
+// where prints the next instruction.
+func (d *debugger) where() {
+	if d.cpu.Halted() {
+		fmt.Fprintf(d.out, "halted after %d instructions\n", d.cpu.Instructions())
+		return
+	}
+	pc := d.cpu.PC()
+	if debug := d.cpu.RAM.Debug; debug != nil {
+		if _, ok := debug.Line(pc); ok {
+			fmt.Fprintf(d.out, "=> x%04X  %s\n", pc, debug.Location(pc))
+			return
+		}
+	}
+	fmt.Fprintf(d.out, "=> x%04X  %s\n", pc, d.disassemble(pc))
+}
+
+// disassemble formats the word at address as an instruction, or as .FILL when the debug
+// information says it is data.
+func (d *debugger) disassemble(address uint16) string {
+	word := d.cpu.Memory().Peek(address)
+	debug := d.cpu.RAM.Debug
+	if debug != nil && debug.IsData(address) {
+		return fmt.Sprintf(".FILL x%04X", word)
+	}
+	ins := cfg.Instruction{Address: address, Instruction: vm.Decode(word)}
+	return ins.Format(labelsOf(debug))
+}
+
+// address parses a label of the debug information or a number.
+func (d *debugger) address(s string) (uint16, error) {
+	if debug := d.cpu.RAM.Debug; debug != nil {
+		for _, l := range debug.Labels {
+			if strings.EqualFold(l.Name, s) {
+				return l.Address, nil
+			}
+		}
+	}
+	a, err := grade.ParseWord(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address: %s", s)
+	}
+	return a, nil
+}
+
+// count parses an optional number of words.
+func count(args []string, i, n int) (int, error) {
+	if len(args) <= i {
+		return n, nil
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count: %s", args[i])
+	}
+	return n, nil
+}
+
+func (d *debugger) listBreakpoints() {
+	addresses := make([]uint16, 0, len(d.breakpoints))
+	for a := range d.breakpoints {
+		addresses = append(addresses, a)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	for _, a := range addresses {
+		fmt.Fprintf(d.out, "x%04X  %s\n", a, d.disassemble(a))
+	}
+}
+
+func (d *debugger) registers() {
+	s := d.cpu.State()
+	for r, v := range s.Registers {
+		sep := "  "
+		if r%4 == 3 {
+			sep = "\n"
+		}
+		fmt.Fprintf(d.out, "R%d x%04X %6d%s", r, v, int16(v), sep)
+	}
+	fmt.Fprintf(d.out, "PC x%04X  CC %s  instructions %d\n", s.PC, condName(s.Cond), d.cpu.Instructions())
+}
+
+func (d *debugger) memory(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("mem needs an address")
+	}
+	a, err := d.address(args[0])
+	if err != nil {
+		return err
+	}
+	n, err := count(args, 1, dumpWords)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		address := a + uint16(i)
+		w := d.cpu.Memory().Peek(address)
+		fmt.Fprintf(d.out, "x%04X  x%04X %6d\n", address, w, int16(w))
+	}
+	return nil
+}
+
+func (d *debugger) list(args []string) error {
+	a := d.cpu.PC()
+	if len(args) > 0 {
+		var err error
+		if a, err = d.address(args[0]); err != nil {
+			return err
+		}
+	}
+	n, err := count(args, 1, 10)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		address := a + uint16(i)
+		marker := "  "
+		if address == d.cpu.PC() {
+			marker = "=>"
+		}
+		if d.breakpoints[address] {
+			marker = marker[:1] + "*"
+		}
+		label := ""
+		if debug := d.cpu.RAM.Debug; debug != nil {
+			label, _ = debug.Label(address)
+		}
+		fmt.Fprintf(d.out, "%s x%04X  %-8s%s\n", marker, address, label, d.disassemble(address))
+	}
+	return nil
+}
+
+func (d *debugger) set(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("set needs a register or an address and a value")
+	}
+	v, err := grade.ParseWord(args[1])
+	if err != nil {
+		return err
+	}
+	target := strings.ToUpper(args[0])
+	switch {
+	case target == "PC":
+		d.cpu.SetPC(v)
+	case len(target) == 2 && target[0] == 'R' && target[1] >= '0' && target[1] <= '7':
+		d.cpu.SetReg(uint16(target[1]-'0'), v)
+	default:
+		a, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+		d.cpu.Memory().Write(a, v)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// recursion calls REC three times, each call returns to AFTER.
+const recursion = `
+        .ORIG x3000
+        LD R6, STACK
+        AND R1, R1, #0
+        ADD R1, R1, #3
+        JSR REC
+        HALT
+REC     ADD R6, R6, #-1
+        STR R7, R6, #0
+        ADD R1, R1, #-1
+        BRz DONE
+CALL    JSR REC
+AFTER   ADD R2, R2, #1
+DONE    LDR R7, R6, #0
+        ADD R6, R6, #1
+        RET
+STACK   .FILL xFE00
+        .END
+`
+
+// debug runs the commands on a program and returns the debugger and its output.
+func debug(t *testing.T, src, commands string) (*debugger, string) {
+	t.Helper()
+	p, err := asm.Assemble("test.asm", []byte(src))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	var out bytes.Buffer
+	d, err := newDebugger(p.Object(), p.Debug(), vm.PC_START, strings.NewReader(commands), &out, vm.NewKeyboard(nil))
+	assert.Nil(t, err)
+	d.loop()
+	return d, out.String()
+}
+
+func TestDebugger_step(t *testing.T) {
+	d, out := debug(t, recursion, "s 2\nb REC\nc\n")
+	assert.Contains(t, out, "=> x3002  test.asm:5: ADD R1, R1, #3")
+	assert.Contains(t, out, "breakpoint at test.asm:8: ADD R6, R6, #-1")
+	assert.Equal(t, uint16(0x3005), d.cpu.PC())
+	assert.Equal(t, uint16(3), d.cpu.Reg(vm.R_R1))
+
+	d, out = debug(t, recursion, "c\ns\n")
+	assert.True(t, d.cpu.Halted())
+	assert.Contains(t, out, "HALT\nhalted after")
+	assert.Contains(t, out, "the program halted")
+}
+
+func TestDebugger_next(t *testing.T) {
+	// The outermost call returns to AFTER last, in the frame of the first call of REC
+	d, _ := debug(t, recursion, "b CALL\nc\nd CALL\nn\n")
+	assert.Equal(t, uint16(0x300A), d.cpu.PC())
+	assert.Equal(t, uint16(0xFDFF), d.cpu.Reg(vm.R_R6))
+	assert.Equal(t, uint16(1), d.cpu.Reg(vm.R_R2))
+
+	// Other instructions are stepped
+	d, _ = debug(t, recursion, "n\nn\n")
+	assert.Equal(t, uint16(0x3002), d.cpu.PC())
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/cfg"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// disasmCommand prints the instructions and data of a program.
+func disasmCommand(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	output := flags.String("o", "", "write the listing to `file` instead of stdout")
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm disasm [-o file] program.obj|source.asm")
+		os.Exit(2)
+	}
+	object, debug := readProgram(paths[0])
+	g, err := cfg.FromObject(object)
+	if err != nil {
+		log.Fatalf("Can't read program %s: %v", paths[0], err)
+	}
+
+	write := func(w io.Writer) error { return writeListing(w, g, debug) }
+	if *output == "" {
+		if err := write(os.Stdout); err != nil {
+			log.Fatalf("Can't write listing: %v", err)
+		}
+		return
+	}
+	writeFile(*output, write)
+}
+
+// writeListing disassembles every word of a program. Words are data when the debug
+// information says so, or without debug information when no path of the control-flow
+// graph reaches them.
+func writeListing(w io.Writer, g *cfg.Graph, debug *vm.DebugInfo) error {
+	name := labelsOf(debug)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\t\t\t.ORIG x%04X\n", g.Origin)
+	for i, word := range g.Words {
+		address := g.Origin + uint16(i)
+		label := ""
+		if name != nil {
+			label, _ = name(address)
+		}
+		code := g.IsCode(address)
+		if debug != nil {
+			code = !debug.IsData(address)
+		}
+
+		text := fmt.Sprintf(".FILL x%04X", word)
+		if code {
+			text = g.Instruction(address).Format(name)
+		} else if word >= ' ' && word <= '~' {
+			text += fmt.Sprintf("  ; '%c'", rune(word))
+		}
+		fmt.Fprintf(&sb, "x%04X  %04X  %-8s%s\n", address, word, label, text)
+	}
+	sb.WriteString("\t\t\t.END\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
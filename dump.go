@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// dumpWords is the number of words per line of dump.
+const dumpWords = 8
+
+// dumpCommand prints the words of a program in hex with their characters.
+func dumpCommand(args []string) {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	var from wordFlag
+	flags.Var(&from, "from", "start at `address` instead of the origin of the program")
+	count := flags.Int("n", 0, "print at most `n` words, 0 prints the whole program")
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) != 1 || *count < 0 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm dump [--from address] [-n words] program.obj|source.asm")
+		os.Exit(2)
+	}
+	object, _ := readProgram(paths[0])
+	if len(object) < 2 || len(object)%2 != 0 {
+		log.Fatalf("Can't read program %s: invalid object file", paths[0])
+	}
+	origin := binary.BigEndian.Uint16(object)
+	words := make([]uint16, (len(object)-2)/2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(object[2+2*i:])
+	}
+
+	start := 0
+	if flagSet(flags, "from") {
+		start = int(from) - int(origin)
+		if start < 0 || start >= len(words) {
+			log.Fatalf("Address x%04X is outside of the program x%04X-x%04X", uint16(from), origin, int(origin)+len(words)-1)
+		}
+	}
+	words = words[start:]
+	if *count > 0 && *count < len(words) {
+		words = words[:*count]
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(words); i += dumpWords {
+		line := words[i:]
+		if len(line) > dumpWords {
+			line = line[:dumpWords]
+		}
+		fmt.Fprintf(&sb, "x%04X ", int(origin)+start+i)
+		chars := make([]byte, len(line))
+		for j, w := range line {
+			fmt.Fprintf(&sb, " %04X", w)
+			chars[j] = '.'
+			if w >= ' ' && w <= '~' {
+				chars[j] = byte(w)
+			}
+		}
+		fmt.Fprintf(&sb, "%s  %s\n", strings.Repeat("     ", dumpWords-len(line)), chars)
+	}
+	fmt.Print(sb.String())
+}
+
+// flagSet reports whether a flag was given on the command line.
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -1,9 +1,15 @@
 module github.com/idexter/golang-lc3-vm
 
-go 1.13
+go 1.18
 
 require (
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/crypto v0.0.0-20200109152110-61a87790db17
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
 	golang.org/x/sys v0.0.0-20200117145432-59e60aa80a0c // indirect
 )
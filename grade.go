@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/idexter/golang-lc3-vm/grade"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// gradeCommand runs the cases of a spec against a submission, the exit status is 1 when a case fails.
+func gradeCommand(args []string) {
+	flags := flag.NewFlagSet("grade", flag.ExitOnError)
+	summary := flags.String("json", "", "write a JSON summary to `file`, - is standard output")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm grade [--json file] spec.yaml submission.obj")
+		os.Exit(2)
+	}
+
+	b, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Can't read spec: %v", err)
+	}
+	spec, err := grade.ParseSpec(b)
+	if err != nil {
+		log.Fatalf("Can't parse spec: %v", err)
+	}
+	image, err := vm.ReadObject(flags.Arg(1))
+	if err != nil {
+		log.Fatalf("Can't read submission: %v", err)
+	}
+
+	s, err := grade.Grade(spec, image)
+	if err != nil {
+		log.Fatalf("Can't grade submission: %v", err)
+	}
+	if err := s.WriteReport(os.Stdout); err != nil {
+		log.Fatalf("Can't write report: %v", err)
+	}
+	switch *summary {
+	case "":
+	case "-":
+		if err := s.WriteJSON(os.Stdout); err != nil {
+			log.Fatalf("Can't write summary: %v", err)
+		}
+	default:
+		writeFile(*summary, func(w io.Writer) error { return s.WriteJSON(w) })
+	}
+
+	if s.Failed > 0 {
+		os.Exit(1)
+	}
+}
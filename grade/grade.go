@@ -0,0 +1,170 @@
+package grade
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// haltLine is printed by the VM on HALT.
+const haltLine = "HALT\n"
+
+// CaseResult is the outcome of a single case.
+type CaseResult struct {
+	Name         string   `json:"name"`
+	Passed       bool     `json:"passed"`
+	Instructions uint64   `json:"instructions"`
+	Failures     []string `json:"failures,omitempty"`
+}
+
+// Summary is the outcome of a spec.
+type Summary struct {
+	Spec   string       `json:"spec"`
+	Passed int          `json:"passed"`
+	Failed int          `json:"failed"`
+	Cases  []CaseResult `json:"cases"`
+}
+
+// Grade runs every case of spec against the program in the object image.
+func Grade(spec *Spec, image []byte) (*Summary, error) {
+	s := &Summary{Spec: spec.Name}
+	for _, c := range spec.Cases {
+		r, err := runCase(c, image)
+		if err != nil {
+			return nil, err
+		}
+		if r.Passed {
+			s.Passed++
+		} else {
+			s.Failed++
+		}
+		s.Cases = append(s.Cases, r)
+	}
+	return s, nil
+}
+
+// runCase runs the program in a fresh VM and compares the state after HALT.
+func runCase(c Case, image []byte) (CaseResult, error) {
+	var out bytes.Buffer
+	keyboard := vm.NewKeyboard([]byte(c.Input))
+	cpu := vm.NewCPU(&vm.LC3RAM{
+		CheckKey: keyboard.CheckKey,
+		GetChar:  keyboard.GetChar,
+	}, &out)
+	if err := cpu.RAM.LoadObject(image); err != nil {
+		return CaseResult{}, err
+	}
+	for r, v := range c.Registers {
+		cpu.SetReg(uint16(r), uint16(v))
+	}
+	for a, v := range c.Memory {
+		cpu.Memory().Write(uint16(a), uint16(v))
+	}
+	limit := c.MaxInstructions
+	if limit == 0 {
+		limit = DefaultMaxInstructions
+	}
+	cpu.SetInstructionLimit(limit)
+	run := cpu.Run()
+
+	result := CaseResult{Name: c.Name, Instructions: run.Instructions}
+	switch run.Reason {
+	case vm.StopHalt:
+	case vm.StopOutputError:
+		result.Failures = append(result.Failures, fmt.Sprintf("can't write output: %v", run.Err))
+	default:
+		result.Failures = append(result.Failures, fmt.Sprintf("didn't halt within %d instructions", limit))
+	}
+	output := strings.TrimSuffix(out.String(), haltLine)
+	if c.Expect.Output != nil && output != *c.Expect.Output {
+		result.Failures = append(result.Failures, "output differs:\n"+diff(*c.Expect.Output, output))
+	}
+	for _, r := range sortedRegisters(c.Expect.Registers) {
+		if got, want := cpu.Reg(uint16(r)), uint16(c.Expect.Registers[r]); got != want {
+			result.Failures = append(result.Failures, fmt.Sprintf("%v: got x%04X, want x%04X", r, got, want))
+		}
+	}
+	for _, a := range sortedAddresses(c.Expect.Memory) {
+		if got, want := cpu.Memory().Peek(uint16(a)), uint16(c.Expect.Memory[a]); got != want {
+			result.Failures = append(result.Failures, fmt.Sprintf("memory x%04X: got x%04X, want x%04X", a, got, want))
+		}
+	}
+	result.Passed = len(result.Failures) == 0
+	return result, nil
+}
+
+// diff returns a unified diff of the expected and the actual output.
+func diff(want, got string) string {
+	d, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(want),
+		B:        splitLines(got),
+		FromFile: "want",
+		ToFile:   "got",
+		Context:  2,
+	})
+	if d == "" {
+		// Outputs which differ only in the final newline
+		d = fmt.Sprintf("want %q\ngot  %q\n", want, got)
+	}
+	return d
+}
+
+// splitLines splits s after newlines, the last line gets a newline as difflib expects.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+func sortedRegisters(m map[Register]Word) []Register {
+	keys := make([]Register, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func sortedAddresses(m map[Word]Word) []Word {
+	keys := make([]Word, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// WriteReport writes a human readable report with the failures of every case.
+func (s *Summary) WriteReport(w io.Writer) error {
+	for _, c := range s.Cases {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s (%d instructions)\n", status, c.Name, c.Instructions); err != nil {
+			return err
+		}
+		for _, f := range c.Failures {
+			fmt.Fprintf(w, "      %s\n", strings.ReplaceAll(strings.TrimRight(f, "\n"), "\n", "\n      "))
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d/%d cases passed\n", s.Passed, s.Passed+s.Failed)
+	return err
+}
+
+// WriteJSON writes the summary as JSON.
+func (s *Summary) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(s)
+}
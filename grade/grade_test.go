@@ -0,0 +1,124 @@
+package grade
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multiply stores R1 * R2 at x300A and prints "ok".
+var multiply = objectImage(0x3000,
+	0b0101_011_011_1_00000,  // AND R3, R3, #0
+	0b0001_010_010_1_00000,  // ADD R2, R2, #0
+	0b0000_010_000000011,    // BRz DONE
+	0b0001_011_011_0_00_001, // LOOP ADD R3, R3, R1
+	0b0001_010_010_1_11111,  // ADD R2, R2, #-1
+	0b0000_001_111111101,    // BRp LOOP
+	0b0011_011_000000011,    // DONE ST R3, RESULT
+	0b1110_000_000000011,    // LEA R0, MSG
+	0xF022,                  // PUTS
+	0xF025,                  // HALT
+	0,                       // RESULT .FILL #0
+	'o', 'k', '\n', 0,       // MSG .STRINGZ "ok\n"
+)
+
+func objectImage(origin uint16, words ...uint16) []byte {
+	b := make([]byte, 2+2*len(words))
+	binary.BigEndian.PutUint16(b, origin)
+	for i, w := range words {
+		binary.BigEndian.PutUint16(b[2+2*i:], w)
+	}
+	return b
+}
+
+const multiplySpec = `
+name: multiply
+cases:
+  - name: small numbers
+    registers: {R1: 3, R2: 4}
+    expect:
+      output: "ok\n"
+      registers: {R3: 12}
+      memory: {x300A: "#12"}
+  - registers: {R1: "#-2", R2: 0x3}
+    memory: {x300A: 7}
+    expect:
+      registers: {r3: xFFFA, R1: -2}
+  - name: wrong
+    registers: {R1: 2, R2: 2}
+    expect:
+      output: "four\n"
+      registers: {R3: 5}
+      memory: {x300A: 5}
+  - name: too slow
+    registers: {R1: 1, R2: 100}
+    max_instructions: 50
+`
+
+func TestGrade(t *testing.T) {
+	spec, err := ParseSpec([]byte(multiplySpec))
+	assert.Nil(t, err)
+	assert.Equal(t, "case 2", spec.Cases[1].Name)
+
+	s, err := Grade(spec, multiply)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, s.Passed)
+	assert.Equal(t, 2, s.Failed)
+
+	assert.True(t, s.Cases[0].Passed)
+	assert.Equal(t, uint64(19), s.Cases[0].Instructions)
+	assert.True(t, s.Cases[1].Passed, "%v", s.Cases[1].Failures)
+	assert.Equal(t, []string{
+		"output differs:\n--- want\n+++ got\n@@ -1 +1 @@\n-four\n+ok\n",
+		"R3: got x0004, want x0005",
+		"memory x300A: got x0004, want x0005",
+	}, s.Cases[2].Failures)
+	assert.Equal(t, []string{"didn't halt within 50 instructions"}, s.Cases[3].Failures)
+
+	var report bytes.Buffer
+	assert.Nil(t, s.WriteReport(&report))
+	assert.Contains(t, report.String(), "PASS  small numbers (19 instructions)\n")
+	assert.Contains(t, report.String(), "FAIL  wrong (13 instructions)\n      output differs:\n      --- want\n")
+	assert.Contains(t, report.String(), "\n2/4 cases passed\n")
+
+	var summary bytes.Buffer
+	assert.Nil(t, s.WriteJSON(&summary))
+	var decoded Summary
+	assert.Nil(t, json.Unmarshal(summary.Bytes(), &decoded))
+	assert.Equal(t, *s, decoded)
+}
+
+func TestGrade_invalidObject(t *testing.T) {
+	spec, err := ParseSpec([]byte(multiplySpec))
+	assert.Nil(t, err)
+	_, err = Grade(spec, []byte{0x30})
+	assert.NotNil(t, err)
+}
+
+func TestParseSpec(t *testing.T) {
+	for spec, msg := range map[string]string{
+		"name: empty":                             "spec has no cases",
+		"cases: [{registers: {R8: 1}}]":           "invalid register: R8",
+		"cases: [{memory: {x3000: x10000}}]":      "invalid word: x10000",
+		"cases: [{registers: {R1: \"#-32769\"}}]": "invalid word: #-32769",
+		"cases: [{inputs: abc}]":                  "field inputs not found",
+	} {
+		_, err := ParseSpec([]byte(spec))
+		if assert.NotNil(t, err, spec) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
+
+func TestParseWord(t *testing.T) {
+	for s, want := range map[string]uint16{
+		"12": 12, "#-1": 0xFFFF, "x3000": 0x3000, "X00ff": 0xFF, "0x10": 16, "-32768": 0x8000, "65535": 0xFFFF,
+	} {
+		got, err := ParseWord(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+}
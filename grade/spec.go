@@ -0,0 +1,129 @@
+// Package grade checks LC-3 programs against test specs, the way an autograder does.
+package grade
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// DefaultMaxInstructions limits cases which don't set their own limit.
+const DefaultMaxInstructions = 1000000
+
+// Spec is a set of test cases for a single program.
+//
+// A spec is written in YAML, registers are R0 to R7, words are decimal, x or 0x prefixed
+// hex or # prefixed decimal numbers:
+//
+//	name: multiply
+//	cases:
+//	  - name: small numbers
+//	    registers: {R1: 3, R2: 4}
+//	    memory: {x4000: "#-1"}
+//	    input: "y"
+//	    max_instructions: 1000
+//	    expect:
+//	      output: "Done\n"
+//	      registers: {R0: 12}
+//	      memory: {x4001: x000C}
+type Spec struct {
+	Name  string `yaml:"name"`
+	Cases []Case `yaml:"cases"`
+}
+
+// Case is a single run of the program. Memory is set after the program is loaded.
+type Case struct {
+	Name            string            `yaml:"name"`
+	Registers       map[Register]Word `yaml:"registers"`
+	Memory          map[Word]Word     `yaml:"memory"`
+	Input           string            `yaml:"input"`
+	MaxInstructions uint64            `yaml:"max_instructions"`
+	Expect          Expectation       `yaml:"expect"`
+}
+
+// Expectation is the state after HALT, only the given output, registers and memory are checked.
+type Expectation struct {
+	// Output doesn't include the "HALT" line printed by the VM.
+	Output    *string           `yaml:"output"`
+	Registers map[Register]Word `yaml:"registers"`
+	Memory    map[Word]Word     `yaml:"memory"`
+}
+
+// ParseSpec parses a YAML spec.
+func ParseSpec(b []byte) (*Spec, error) {
+	var s Spec
+	if err := yaml.UnmarshalStrict(b, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Cases) == 0 {
+		return nil, fmt.Errorf("spec has no cases")
+	}
+	for i := range s.Cases {
+		if s.Cases[i].Name == "" {
+			s.Cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+	}
+	return &s, nil
+}
+
+// Register is a general purpose register.
+type Register uint16
+
+// UnmarshalYAML parses register names R0 to R7.
+func (r *Register) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(s), "R"))
+	if err != nil || !strings.HasPrefix(strings.ToUpper(s), "R") || n < 0 || n > int(vm.R_R7) {
+		return fmt.Errorf("invalid register: %s", s)
+	}
+	*r = Register(n)
+	return nil
+}
+
+func (r Register) String() string {
+	return fmt.Sprintf("R%d", r)
+}
+
+// Word is a 16 bit value, negative numbers are stored in two's complement.
+type Word uint16
+
+// UnmarshalYAML parses decimal numbers and the hex and decimal notations of LC-3 assembly.
+func (w *Word) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := ParseWord(s)
+	if err != nil {
+		return err
+	}
+	*w = Word(v)
+	return nil
+}
+
+// ParseWord parses decimal numbers, x or 0x prefixed hex numbers and # prefixed decimal numbers.
+func ParseWord(s string) (uint16, error) {
+	t := strings.TrimSpace(s)
+	base := 10
+	switch {
+	case strings.HasPrefix(t, "0x"), strings.HasPrefix(t, "0X"):
+		t, base = t[2:], 16
+	case strings.HasPrefix(t, "x"), strings.HasPrefix(t, "X"):
+		t, base = t[1:], 16
+	case strings.HasPrefix(t, "#"):
+		t = t[1:]
+	}
+
+	v, err := strconv.ParseInt(t, base, 32)
+	if err != nil || v < -0x8000 || v > 0xFFFF {
+		return 0, fmt.Errorf("invalid word: %s", s)
+	}
+	return uint16(v), nil
+}
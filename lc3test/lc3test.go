@@ -0,0 +1,257 @@
+// Package lc3test tests LC-3 programs and subroutine libraries from Go tests.
+//
+//	lc3test.Asm(t, src).
+//		SetReg(vm.R_R1, 3).SetReg(vm.R_R2, 4).
+//		Call("MULT").
+//		ExpectReg(vm.R_R0, 12).ExpectCC("p")
+package lc3test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// ReturnAddress is the fake return address subroutines are called with. It holds a
+// HALT instruction while a subroutine runs, so returning from the subroutine stops the VM.
+const ReturnAddress uint16 = 0xFD00
+
+// DefaultMaxInstructions limits Run and Call, a program which doesn't stop within the
+// limit fails the test.
+const DefaultMaxInstructions = 1000000
+
+// haltLine is printed by the VM on HALT.
+const haltLine = "HALT\n"
+
+// Machine is a VM with a loaded program. Setters prepare the next Run or Call, assertions
+// check the state after it. Failed assertions are reported with t.Errorf and don't stop the test.
+type Machine struct {
+	t        testing.TB
+	CPU      *vm.LC3CPU
+	symbols  map[string]uint16
+	origin   uint16
+	keyboard *vm.Keyboard
+	output   bytes.Buffer
+	limit    uint64
+}
+
+// New creates a machine with empty memory.
+func New(t testing.TB) *Machine {
+	m := &Machine{t: t, symbols: map[string]uint16{}, origin: vm.PC_START, limit: DefaultMaxInstructions}
+	m.keyboard = vm.NewKeyboard(nil)
+	m.CPU = vm.NewCPU(&vm.LC3RAM{
+		CheckKey: func() bool { return m.keyboard.CheckKey() },
+		GetChar:  func() uint16 { return m.keyboard.GetChar() },
+	}, &m.output)
+	// Like Run, Call starts with exactly one condition code set
+	m.CPU.SetReg(vm.R_COND, vm.FL_ZRO)
+	return m
+}
+
+// Asm creates a machine with an assembled program, its labels can be used with Call and Addr.
+func Asm(t testing.TB, src string) *Machine {
+	t.Helper()
+	p, err := asm.Assemble(t.Name()+".asm", []byte(src))
+	if errs, ok := err.(asm.ErrorList); ok {
+		t.Fatalf("can't assemble program:\n%s", errs.Detail())
+	}
+	if err != nil {
+		t.Fatalf("can't assemble program: %v", err)
+	}
+	m := Image(t, p.Object())
+	m.symbols = p.Symbols
+	return m
+}
+
+// Obj creates a machine with a program loaded from an object file.
+func Obj(t testing.TB, path string) *Machine {
+	t.Helper()
+	b, err := vm.ReadObject(path)
+	if err != nil {
+		t.Fatalf("can't read object file: %v", err)
+	}
+	return Image(t, b)
+}
+
+// Image creates a machine with a program loaded from an object image.
+func Image(t testing.TB, image []byte) *Machine {
+	t.Helper()
+	m := New(t)
+	if err := m.CPU.RAM.LoadObject(image); err != nil {
+		t.Fatalf("can't load program: %v", err)
+	}
+	m.origin = uint16(image[0])<<8 | uint16(image[1])
+	return m
+}
+
+// Addr returns the address of a label, unknown labels stop the test.
+func (m *Machine) Addr(label string) uint16 {
+	m.t.Helper()
+	address, ok := m.symbols[label]
+	if !ok {
+		m.t.Fatalf("unknown label %s", label)
+	}
+	return address
+}
+
+// SetReg sets a register before the next run.
+func (m *Machine) SetReg(r, val uint16) *Machine {
+	m.CPU.SetReg(r, val)
+	return m
+}
+
+// SetMem writes consecutive words starting at address.
+func (m *Machine) SetMem(address uint16, words ...uint16) *Machine {
+	m.CPU.Memory().WriteWords(address, words...)
+	return m
+}
+
+// SetString writes a zero terminated string starting at address, the way .STRINGZ does.
+func (m *Machine) SetString(address uint16, s string) *Machine {
+	mem := m.CPU.Memory()
+	for i, c := range []byte(s) {
+		mem.Write(address+uint16(i), uint16(c))
+	}
+	mem.Write(address+uint16(len(s)), 0)
+	return m
+}
+
+// Input sets the keys typed during the next run.
+func (m *Machine) Input(s string) *Machine {
+	m.keyboard = vm.NewKeyboard([]byte(s))
+	return m
+}
+
+// Limit sets the number of instructions a run may execute.
+func (m *Machine) Limit(n uint64) *Machine {
+	m.limit = n
+	return m
+}
+
+// Run runs the program from its origin until HALT.
+func (m *Machine) Run() *Machine {
+	m.t.Helper()
+	m.CPU.StartPosition = m.origin
+	if m.run(m.CPU.Run).Reason != vm.StopHalt {
+		m.t.Errorf("program didn't halt within %d instructions", m.limit)
+	}
+	return m
+}
+
+// Call calls the subroutine at label with R7 set to ReturnAddress and runs it until it returns.
+func (m *Machine) Call(label string) *Machine {
+	m.t.Helper()
+	return m.CallAt(m.Addr(label))
+}
+
+// CallAt calls the subroutine at address, see Call. R7 holds ReturnAddress after the call.
+func (m *Machine) CallAt(address uint16) *Machine {
+	m.t.Helper()
+	mem := m.CPU.Memory()
+	saved := mem.Peek(ReturnAddress)
+	mem.Write(ReturnAddress, vm.OP_TRAP<<12|vm.TRAP_HALT)
+	m.CPU.SetReg(vm.R_R7, ReturnAddress)
+	m.CPU.SetPC(address)
+	result := m.run(m.CPU.Resume)
+	mem.Write(ReturnAddress, saved)
+
+	switch {
+	case result.Reason != vm.StopHalt:
+		m.t.Errorf("subroutine x%04X didn't return within %d instructions", address, m.limit)
+	case m.CPU.PC() != ReturnAddress+1:
+		m.t.Errorf("subroutine x%04X halted at x%04X instead of returning", address, m.CPU.PC()-1)
+	default:
+		// Undo the R7 of the HALT at the return address
+		m.CPU.SetReg(vm.R_R7, ReturnAddress)
+	}
+	return m
+}
+
+// run executes start until HALT or the instruction limit.
+func (m *Machine) run(start func() vm.RunResult) vm.RunResult {
+	m.output.Reset()
+	m.CPU.SetInstructionLimit(m.CPU.Instructions() + m.limit)
+	return start()
+}
+
+// Output returns what the last run printed, without the "HALT" line of the VM.
+func (m *Machine) Output() string {
+	return strings.TrimSuffix(m.output.String(), haltLine)
+}
+
+// ExpectReg checks the value of a register.
+func (m *Machine) ExpectReg(r, want uint16) *Machine {
+	m.t.Helper()
+	if got := m.CPU.Reg(r); got != want {
+		m.t.Errorf("%s: got x%04X (%d), want x%04X (%d)", registerName(r), got, int16(got), want, int16(want))
+	}
+	return m
+}
+
+// ExpectCC checks the condition codes, cc is "n", "z" or "p".
+func (m *Machine) ExpectCC(cc string) *Machine {
+	m.t.Helper()
+	if got := conditionName(m.CPU.Cond()); got != strings.ToLower(cc) {
+		m.t.Errorf("condition codes: got %s, want %s", got, cc)
+	}
+	return m
+}
+
+// ExpectMem checks consecutive words starting at address.
+func (m *Machine) ExpectMem(address uint16, want ...uint16) *Machine {
+	m.t.Helper()
+	for i, w := range want {
+		a := address + uint16(i)
+		if got := m.CPU.Memory().Peek(a); got != w {
+			m.t.Errorf("memory x%04X: got x%04X (%d), want x%04X (%d)", a, got, int16(got), w, int16(w))
+		}
+	}
+	return m
+}
+
+// ExpectString checks a zero terminated string starting at address.
+func (m *Machine) ExpectString(address uint16, want string) *Machine {
+	m.t.Helper()
+	var b strings.Builder
+	for a := address; m.CPU.Memory().Peek(a) != 0 && b.Len() <= len(want); a++ {
+		b.WriteByte(byte(m.CPU.Memory().Peek(a)))
+	}
+	if got := b.String(); got != want {
+		m.t.Errorf("string at x%04X: got %q, want %q", address, got, want)
+	}
+	return m
+}
+
+// ExpectOutput checks what the last run printed.
+func (m *Machine) ExpectOutput(want string) *Machine {
+	m.t.Helper()
+	if got := m.Output(); got != want {
+		m.t.Errorf("output: got %q, want %q", got, want)
+	}
+	return m
+}
+
+func registerName(r uint16) string {
+	switch r {
+	case vm.R_PC:
+		return "PC"
+	case vm.R_COND:
+		return "COND"
+	}
+	return "R" + string(rune('0'+r))
+}
+
+func conditionName(cond uint16) string {
+	switch cond {
+	case vm.FL_NEG:
+		return "n"
+	case vm.FL_ZRO:
+		return "z"
+	case vm.FL_POS:
+		return "p"
+	}
+	return "invalid"
+}
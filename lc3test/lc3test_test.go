@@ -0,0 +1,132 @@
+package lc3test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+const library = `
+        .ORIG x3000
+        LEA R0, MSG
+        PUTS
+        HALT
+MSG     .STRINGZ "library\n"
+
+; MULT sets R0 to R1 * R2, R2 must not be negative
+MULT    AND R0, R0, #0
+        ADD R2, R2, #0
+        BRz MULT_END
+MULT_LOOP
+        ADD R0, R0, R1
+        ADD R2, R2, #-1
+        BRp MULT_LOOP
+MULT_END
+        ADD R0, R0, #0
+        RET
+
+; STRLEN sets R0 to the length of the string at R0
+STRLEN  ADD R1, R0, #0
+        AND R0, R0, #0
+STRLEN_LOOP
+        LDR R2, R1, #0
+        BRz STRLEN_END
+        ADD R0, R0, #1
+        ADD R1, R1, #1
+        BRnzp STRLEN_LOOP
+STRLEN_END
+        ADD R0, R0, #0
+        RET
+
+; ECHO prints the next key, R7 is saved as TRAP overwrites it
+ECHO    ST R7, ECHO_R7
+        GETC
+        OUT
+        LD R7, ECHO_R7
+        RET
+ECHO_R7 .BLKW 1
+
+BROKEN  HALT
+SPIN    BRnzp SPIN
+BUFFER  .BLKW 8
+        .END
+`
+
+func TestMachine_Call(t *testing.T) {
+	m := Asm(t, library)
+
+	m.SetReg(vm.R_R1, 3).SetReg(vm.R_R2, 4).
+		Call("MULT").
+		ExpectReg(vm.R_R0, 12).ExpectCC("p").ExpectReg(vm.R_R7, ReturnAddress)
+	m.SetReg(vm.R_R1, 0xFFFE).SetReg(vm.R_R2, 3).
+		Call("MULT").
+		ExpectReg(vm.R_R0, 0xFFFA).ExpectCC("n")
+
+	m.SetString(m.Addr("BUFFER"), "hello").SetReg(vm.R_R0, m.Addr("BUFFER")).
+		Call("STRLEN").
+		ExpectReg(vm.R_R0, 5).ExpectString(m.Addr("BUFFER"), "hello")
+	m.SetMem(m.Addr("BUFFER"), 0).SetReg(vm.R_R0, m.Addr("BUFFER")).
+		Call("STRLEN").
+		ExpectReg(vm.R_R0, 0).ExpectCC("z").ExpectMem(m.Addr("BUFFER"), 0, 'e')
+
+	m.Input("xy").Call("ECHO").ExpectOutput("x").Call("ECHO").ExpectOutput("y")
+	assert.Equal(t, uint16(0), m.CPU.RAM.Storage[ReturnAddress])
+}
+
+func TestMachine_Call_conditionCodes(t *testing.T) {
+	// The subroutine branches on the condition codes before setting them
+	m := Asm(t, `
+        .ORIG x3000
+ISZERO  BRz ZERO
+        AND R0, R0, #0
+        RET
+ZERO    AND R0, R0, #0
+        ADD R0, R0, #1
+        RET
+        .END
+`)
+	m.Call("ISZERO").ExpectReg(vm.R_R0, 1).ExpectCC("p")
+}
+
+func TestMachine_Run(t *testing.T) {
+	Asm(t, library).Run().ExpectOutput("library\n")
+	Obj(t, "../apps/hello-world.obj").Run().ExpectOutput("Hello World!")
+}
+
+// recorder records failed assertions instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMachine_failures(t *testing.T) {
+	r := &recorder{TB: t}
+	m := Asm(r, library)
+
+	m.SetReg(vm.R_R1, 2).SetReg(vm.R_R2, 2).Call("MULT").
+		ExpectReg(vm.R_R0, 5).ExpectCC("z").ExpectMem(m.Addr("MSG"), 'L').ExpectOutput("?")
+	m.Call("BROKEN")
+	m.Limit(100).Call("SPIN")
+	m.SetString(m.Addr("BUFFER"), "abc").ExpectString(m.Addr("BUFFER"), "ab")
+	m.Limit(2).Run()
+
+	assert.Equal(t, []string{
+		"R0: got x0004 (4), want x0005 (5)",
+		"condition codes: got p, want z",
+		"memory x3003: got x006C (108), want x004C (76)",
+		`output: got "", want "?"`,
+		"subroutine x3023 halted at x3023 instead of returning",
+		"subroutine x3024 didn't return within 100 instructions",
+		`string at x3025: got "abc", want "ab"`,
+		"program didn't halt within 2 instructions",
+	}, r.errors)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/idexter/golang-lc3-vm/link"
+)
+
+// linkCommand links relocatable modules into an object file. Assembly sources are assembled first.
+func linkCommand(args []string) {
+	flags := flag.NewFlagSet("link", flag.ExitOnError)
+	output := flags.String("o", "a.obj", "write the object file to `file`")
+	scriptFile := flags.String("script", "", "place sections as listed in the linker script `file`")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm link [-o out.obj] [--script file] module.rel|source.asm...")
+		os.Exit(2)
+	}
+
+	var script *link.Script
+	if *scriptFile != "" {
+		b, err := ioutil.ReadFile(*scriptFile)
+		if err != nil {
+			log.Fatalf("Can't read linker script: %v", err)
+		}
+		if script, err = link.ParseScript(b); err != nil {
+			log.Fatalf("Can't parse linker script %s: %v", *scriptFile, err)
+		}
+	}
+
+	modules := make([]*link.Module, flags.NArg())
+	for i, path := range flags.Args() {
+		modules[i] = readModule(path)
+	}
+	img, err := link.Link(modules, script)
+	if err != nil {
+		log.Fatalf("Can't link:\n%v", err)
+	}
+	if err := ioutil.WriteFile(*output, img.Object(), 0o644); err != nil { //nolint: gosec
+		log.Fatalf("Can't write object file: %v", err)
+	}
+}
+
+// readModule reads a relocatable module, files ending with .asm are assembled.
+func readModule(path string) *link.Module {
+	b, err := ioutil.ReadFile(path) //nolint: gosec
+	if err != nil {
+		log.Fatalf("Can't read module: %v", err)
+	}
+	if filepath.Ext(path) == ".asm" {
+		return assemble(path, b).Module(path)
+	}
+
+	m := &link.Module{Name: path}
+	if err := m.UnmarshalBinary(b); err != nil {
+		log.Fatalf("Can't read module %s: %v", path, err)
+	}
+	return m
+}
@@ -0,0 +1,274 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Image is a linked program.
+type Image struct {
+	Origin  uint16
+	Words   []uint16
+	Symbols map[string]uint16 // addresses of the exported symbols
+}
+
+// Object returns the image in the object file format, an origin word followed by the words.
+func (img *Image) Object() []byte {
+	b := make([]byte, 2+2*len(img.Words))
+	binary.BigEndian.PutUint16(b, img.Origin)
+	for i, w := range img.Words {
+		binary.BigEndian.PutUint16(b[2+2*i:], w)
+	}
+	return b
+}
+
+// chunk is a section of a module placed in memory.
+type chunk struct {
+	module  *Module
+	section *Section
+	address int
+}
+
+func (c *chunk) String() string {
+	if c.section.Name == "" {
+		return fmt.Sprintf("%s: section x%04X", c.module.Name, c.section.Origin)
+	}
+	return fmt.Sprintf("%s: section %s", c.module.Name, c.section.Name)
+}
+
+// output is a relocatable section of the image, the concatenation of the sections with its name.
+type output struct {
+	name    string
+	chunks  []*chunk
+	size    int
+	address int
+	placed  bool
+}
+
+type linker struct {
+	errors  []string
+	chunks  map[*Module][]*chunk // by section index
+	exports map[string]int
+	owners  map[string]*Module // of the exports
+}
+
+func (l *linker) errorf(format string, args ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+// Link places the sections of the modules according to script, resolves the symbols and
+// patches the relocations. script may be nil to place the sections in the order they
+// appear. The error lists every problem found.
+func Link(modules []*Module, script *Script) (*Image, error) {
+	if script == nil {
+		script = &Script{}
+	}
+	l := &linker{chunks: map[*Module][]*chunk{}, exports: map[string]int{}, owners: map[string]*Module{}}
+	l.place(modules, script)
+	l.checkOverlaps()
+	if len(l.errors) == 0 {
+		l.export(modules)
+	}
+	if len(l.errors) > 0 {
+		return nil, errors.New(strings.Join(l.errors, "\n"))
+	}
+
+	img := l.image()
+	for _, m := range modules {
+		l.relocate(m, img)
+	}
+	if len(l.errors) > 0 {
+		return nil, errors.New(strings.Join(l.errors, "\n"))
+	}
+	return img, nil
+}
+
+// place assigns addresses to the sections of all modules.
+func (l *linker) place(modules []*Module, script *Script) {
+	outputs := map[string]*output{}
+	var order []*output
+	end := -1 // of the highest section placed so far
+	for _, m := range modules {
+		for i := range m.Sections {
+			c := &chunk{module: m, section: &m.Sections[i]}
+			l.chunks[m] = append(l.chunks[m], c)
+			if c.section.Name == "" {
+				c.address = int(c.section.Origin)
+				if e := c.address + len(c.section.Words); e > end {
+					end = e
+				}
+				continue
+			}
+			o, ok := outputs[c.section.Name]
+			if !ok {
+				o = &output{name: c.section.Name}
+				outputs[o.name] = o
+				order = append(order, o)
+			}
+			c.address = o.size
+			o.chunks = append(o.chunks, c)
+			o.size += len(c.section.Words)
+		}
+	}
+
+	next := int(DefaultAddress)
+	for _, p := range script.Placements {
+		o, ok := outputs[p.Section]
+		if !ok {
+			l.errorf("script places section %s which no module has", p.Section)
+			continue
+		}
+		o.address, o.placed = int(p.Address), true
+		if p.Follow {
+			o.address = next
+		}
+		next = o.address + o.size
+		if next > end {
+			end = next
+		}
+	}
+	if end < 0 {
+		end = int(DefaultAddress)
+	}
+	for _, o := range order {
+		if !o.placed {
+			o.address = end
+			end += o.size
+		}
+		for _, c := range o.chunks {
+			c.address += o.address
+		}
+	}
+}
+
+// checkOverlaps reports sections which overlap or exceed the memory.
+func (l *linker) checkOverlaps() {
+	var all []*chunk
+	for _, chunks := range l.chunks {
+		for _, c := range chunks {
+			if len(c.section.Words) > 0 {
+				all = append(all, c)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].address != all[j].address {
+			return all[i].address < all[j].address
+		}
+		return all[i].String() < all[j].String()
+	})
+	for i, c := range all {
+		end := c.address + len(c.section.Words)
+		if end > 0x10000 {
+			l.errorf("%v at x%04X exceeds memory end xFFFF", c, c.address)
+		}
+		if i+1 < len(all) && all[i+1].address < end {
+			l.errorf("%v at x%04X overlaps %v at x%04X", c, c.address, all[i+1], all[i+1].address)
+		}
+	}
+}
+
+// export collects the exported symbols of all modules.
+func (l *linker) export(modules []*Module) {
+	for _, m := range modules {
+		for _, s := range m.Symbols {
+			if !s.Exported {
+				continue
+			}
+			if owner, ok := l.owners[s.Name]; ok {
+				l.errorf("%s: symbol %s is also exported by %s", m.Name, s.Name, owner.Name)
+				continue
+			}
+			l.owners[s.Name] = m
+			l.exports[s.Name] = l.address(m, s)
+		}
+	}
+}
+
+func (l *linker) address(m *Module, s Symbol) int {
+	return l.chunks[m][s.Section].address + int(s.Offset)
+}
+
+// image copies the sections into an image, gaps between sections are filled with zeros.
+func (l *linker) image() *Image {
+	img := &Image{Symbols: map[string]uint16{}}
+	start, end := 0x10000, 0
+	for _, chunks := range l.chunks {
+		for _, c := range chunks {
+			if len(c.section.Words) > 0 {
+				if c.address < start {
+					start = c.address
+				}
+				if e := c.address + len(c.section.Words); e > end {
+					end = e
+				}
+			}
+		}
+	}
+	if start > end {
+		return img
+	}
+
+	img.Origin, img.Words = uint16(start), make([]uint16, end-start)
+	for _, chunks := range l.chunks {
+		for _, c := range chunks {
+			copy(img.Words[c.address-start:], c.section.Words)
+		}
+	}
+	for name, address := range l.exports {
+		img.Symbols[name] = uint16(address)
+	}
+	return img
+}
+
+// relocate patches the relocations of a module.
+func (l *linker) relocate(m *Module, img *Image) {
+	locals := map[string]int{}
+	for _, s := range m.Symbols {
+		locals[s.Name] = l.address(m, s)
+	}
+	imports := map[string]bool{}
+	for _, name := range m.Imports {
+		imports[name] = true
+	}
+
+	for _, r := range m.Relocations {
+		c := l.chunks[m][r.Section]
+		if int(r.Offset) >= len(c.section.Words) {
+			l.errorf("%v: relocation at offset %d is outside of the section", c, r.Offset)
+			continue
+		}
+		target, ok := locals[r.Symbol]
+		if !ok && imports[r.Symbol] {
+			target, ok = l.exports[r.Symbol]
+		}
+		if !ok {
+			l.errorf("%s: undefined symbol %s", m.Name, r.Symbol)
+			continue
+		}
+
+		pc := c.address + int(r.Offset)
+		w := &img.Words[pc-int(img.Origin)]
+		switch r.Kind {
+		case PCOffset9, PCOffset11:
+			bits := uint(9)
+			if r.Kind == PCOffset11 {
+				bits = 11
+			}
+			offset := target - pc - 1
+			if offset < -1<<(bits-1) || offset > 1<<(bits-1)-1 {
+				l.errorf("%s: x%04X: %s is out of range: offset %d doesn't fit %d bits", m.Name, pc, r.Symbol, offset, bits)
+				continue
+			}
+			mask := uint16(1<<bits - 1)
+			*w = *w&^mask | uint16(offset)&mask
+		case Word:
+			*w = uint16(target)
+		default:
+			l.errorf("%s: x%04X: unknown relocation kind %v", m.Name, pc, r.Kind)
+		}
+	}
+}
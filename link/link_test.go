@@ -0,0 +1,135 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testModules is a main module calling a subroutine of a library module. The data section
+// of main holds the address of the subroutine.
+func testModules() []*Module {
+	main := &Module{
+		Name: "main.rel",
+		Sections: []Section{
+			{Name: "text", Words: []uint16{
+				0x4800, // JSR PRINT
+				0x2000, // LD R0, PTR
+				0xF025, // HALT
+			}},
+			{Name: "data", Words: []uint16{0}}, // PTR .FILL PRINT
+		},
+		Symbols: []Symbol{{Name: "MAIN", Section: 0, Exported: true}, {Name: "PTR", Section: 1}},
+		Imports: []string{"PRINT"},
+		Relocations: []Relocation{
+			{Section: 0, Offset: 0, Kind: PCOffset11, Symbol: "PRINT"},
+			{Section: 0, Offset: 1, Kind: PCOffset9, Symbol: "PTR"},
+			{Section: 1, Offset: 0, Kind: Word, Symbol: "PRINT"},
+		},
+	}
+	lib := &Module{
+		Name:     "lib.rel",
+		Sections: []Section{{Name: "text", Words: []uint16{0xF021, 0xC1C0}}}, // PRINT OUT, RET
+		Symbols:  []Symbol{{Name: "PRINT", Section: 0, Exported: true}},
+	}
+	return []*Module{main, lib}
+}
+
+func TestModule_MarshalBinary(t *testing.T) {
+	for _, m := range testModules() {
+		b, err := m.MarshalBinary()
+		assert.Nil(t, err)
+
+		d := &Module{Name: m.Name}
+		assert.Nil(t, d.UnmarshalBinary(b))
+		if len(m.Imports) == 0 {
+			d.Imports, d.Relocations = nil, nil
+		}
+		assert.Equal(t, m, d)
+
+		assert.Equal(t, ErrModuleCorrupted, d.UnmarshalBinary(b[:len(b)-1]))
+		assert.Equal(t, ErrModuleCorrupted, d.UnmarshalBinary(append(b, 0)))
+		b[5] = 2
+		assert.Equal(t, ErrModuleVersion, d.UnmarshalBinary(b))
+	}
+	assert.Equal(t, ErrModuleMagic, (&Module{}).UnmarshalBinary([]byte{0x30, 0x00}))
+}
+
+func TestParseScript(t *testing.T) {
+	s, err := ParseScript([]byte("; layout\ntext\ndata   ; follows text\ntable x4000\nvectors #256\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Placement{
+		{Section: "text", Address: 0x3000},
+		{Section: "data", Follow: true},
+		{Section: "table", Address: 0x4000},
+		{Section: "vectors", Address: 0x100},
+	}, s.Placements)
+
+	for src, msg := range map[string]string{
+		"text x3000 x4000": "line 1: expected a section and an address",
+		"text 3000":        "line 1: invalid address 3000",
+		"text\ntext":       "line 2: section text is placed twice",
+	} {
+		_, err := ParseScript([]byte(src))
+		assert.EqualError(t, err, msg, src)
+	}
+}
+
+func TestLink(t *testing.T) {
+	img, err := Link(testModules(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0x3000), img.Origin)
+	assert.Equal(t, []uint16{0x4802, 0x2003, 0xF025, 0xF021, 0xC1C0, 0x3003}, img.Words)
+	assert.Equal(t, map[string]uint16{"MAIN": 0x3000, "PRINT": 0x3003}, img.Symbols)
+	assert.Equal(t, []byte{0x30, 0x00, 0x48, 0x02}, img.Object()[:4])
+
+	script, err := ParseScript([]byte("data x3000\ntext"))
+	assert.Nil(t, err)
+	img, err = Link(testModules(), script)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0x3004, 0x4802, 0x21FD, 0xF025, 0xF021, 0xC1C0}, img.Words)
+
+	// Absolute sections stay at their origin, relocatable ones follow them
+	modules := testModules()
+	modules[1].Sections[0] = Section{Origin: 0x3000, Words: modules[1].Sections[0].Words}
+	img, err = Link(modules, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0xF021, 0xC1C0, 0x4FFD, 0x2001, 0xF025, 0x3000}, img.Words)
+}
+
+func TestLink_errors(t *testing.T) {
+	far, err := ParseScript([]byte("text x3000\ndata x3200"))
+	assert.Nil(t, err)
+	overlap, err := ParseScript([]byte("text x3000\ndata x3004"))
+	assert.Nil(t, err)
+	unknown, err := ParseScript([]byte("bss x5000"))
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		name    string
+		modules func() []*Module
+		script  *Script
+		msg     string
+	}{
+		{"undefined", func() []*Module { return testModules()[:1] }, nil,
+			"main.rel: undefined symbol PRINT\nmain.rel: undefined symbol PRINT"},
+		{"out of range", testModules, far,
+			"main.rel: x3001: PTR is out of range: offset 510 doesn't fit 9 bits"},
+		{"overlap", testModules, overlap,
+			"lib.rel: section text at x3003 overlaps main.rel: section data at x3004"},
+		{"unknown section", testModules, unknown, "script places section bss which no module has"},
+		{"duplicate export", func() []*Module {
+			m := testModules()
+			m[1].Symbols = append(m[1].Symbols, Symbol{Name: "MAIN", Exported: true})
+			return m
+		}, nil, "lib.rel: symbol MAIN is also exported by main.rel"},
+		{"memory end", func() []*Module {
+			m := testModules()[1:]
+			m[0].Sections[0] = Section{Origin: 0xFFFF, Words: []uint16{1, 2}}
+			return m
+		}, nil, "lib.rel: section xFFFF at xFFFF exceeds memory end xFFFF"},
+	} {
+		_, err := Link(c.modules(), c.script)
+		assert.EqualError(t, err, c.msg, c.name)
+	}
+}
@@ -0,0 +1,235 @@
+// Package link combines relocatable object modules into a plain object file loadable by vm.LC3RAM.
+package link
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ModuleVersion is the version of the module format written by MarshalBinary.
+const ModuleVersion uint16 = 1
+
+var moduleMagic = [4]byte{'L', 'C', '3', 'R'}
+
+// Module errors.
+var (
+	ErrModuleMagic     = errors.New("not an LC-3 relocatable module")
+	ErrModuleVersion   = errors.New("unsupported module version")
+	ErrModuleCorrupted = errors.New("module is corrupted")
+)
+
+// Section is a block of words. Named sections are relocatable, the linker concatenates the
+// sections of all modules with the same name and places them. Sections without a name are
+// absolute and stay at their origin.
+type Section struct {
+	Name   string
+	Origin uint16 // of absolute sections
+	Words  []uint16
+}
+
+// Symbol is a label defined by a module.
+type Symbol struct {
+	Name     string
+	Section  int    // index in Module.Sections
+	Offset   uint16 // from the start of the section
+	Exported bool   // visible to other modules
+}
+
+// RelocationKind is the field of a word which is patched with the address of a symbol.
+type RelocationKind uint8
+
+// Relocation kinds.
+const (
+	PCOffset9  RelocationKind = iota + 1 // bits [8:0], relative to the incremented PC: BR, LD, LDI, LEA, ST, STI
+	PCOffset11                           // bits [10:0], relative to the incremented PC: JSR
+	Word                                 // the whole word holds the address: .FILL label
+)
+
+func (k RelocationKind) String() string {
+	switch k {
+	case PCOffset9:
+		return "PCoffset9"
+	case PCOffset11:
+		return "PCoffset11"
+	case Word:
+		return "word"
+	}
+	return fmt.Sprintf("RelocationKind(%d)", uint8(k))
+}
+
+// Relocation is a reference to a symbol which is resolved by the linker.
+type Relocation struct {
+	Section int    // index in Module.Sections
+	Offset  uint16 // of the patched word from the start of the section
+	Kind    RelocationKind
+	Symbol  string // defined by the module or imported
+}
+
+// Module is a relocatable object module.
+//
+// The binary format starts with the magic "LC3R" and the version, followed by the sections,
+// the symbols, the imports and the relocations. Every list is prefixed by its length, strings
+// by their length in bytes. All numbers are big endian words, except for the 1 byte kind of
+// relocations and the exported flag of symbols.
+type Module struct {
+	Name        string // used in error messages, not encoded
+	Sections    []Section
+	Symbols     []Symbol
+	Imports     []string // symbols of other modules
+	Relocations []Relocation
+}
+
+// MarshalBinary encodes the module.
+func (m *Module) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := &writer{w: &buf}
+	w.write(moduleMagic)
+	w.write(ModuleVersion)
+
+	w.length(len(m.Sections))
+	for _, s := range m.Sections {
+		w.string(s.Name)
+		w.write(s.Origin)
+		w.length(len(s.Words))
+		w.write(s.Words)
+	}
+	w.length(len(m.Symbols))
+	for _, s := range m.Symbols {
+		w.string(s.Name)
+		w.write(uint16(s.Section))
+		w.write(s.Offset)
+		w.write(s.Exported)
+	}
+	w.length(len(m.Imports))
+	for _, name := range m.Imports {
+		w.string(name)
+	}
+	w.length(len(m.Relocations))
+	for _, r := range m.Relocations {
+		w.write(uint16(r.Section))
+		w.write(r.Offset)
+		w.write(r.Kind)
+		w.string(r.Symbol)
+	}
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a module encoded by MarshalBinary.
+func (m *Module) UnmarshalBinary(b []byte) error {
+	if len(b) < len(moduleMagic) || !bytes.Equal(b[:len(moduleMagic)], moduleMagic[:]) {
+		return ErrModuleMagic
+	}
+	r := &reader{r: bytes.NewReader(b[len(moduleMagic):])}
+	var version uint16
+	r.read(&version)
+	if r.err == nil && version != ModuleVersion {
+		return ErrModuleVersion
+	}
+
+	var d Module
+	d.Sections = make([]Section, r.length())
+	for i := range d.Sections {
+		s := &d.Sections[i]
+		s.Name = r.string()
+		r.read(&s.Origin)
+		s.Words = make([]uint16, r.length())
+		r.read(s.Words)
+	}
+	d.Symbols = make([]Symbol, r.length())
+	for i := range d.Symbols {
+		s := &d.Symbols[i]
+		s.Name = r.string()
+		s.Section = r.index(len(d.Sections))
+		r.read(&s.Offset)
+		r.read(&s.Exported)
+	}
+	d.Imports = make([]string, r.length())
+	for i := range d.Imports {
+		d.Imports[i] = r.string()
+	}
+	d.Relocations = make([]Relocation, r.length())
+	for i := range d.Relocations {
+		rel := &d.Relocations[i]
+		rel.Section = r.index(len(d.Sections))
+		r.read(&rel.Offset)
+		r.read(&rel.Kind)
+		rel.Symbol = r.string()
+	}
+
+	if r.err != nil || r.r.Len() > 0 {
+		return ErrModuleCorrupted
+	}
+	d.Name = m.Name
+	*m = d
+	return nil
+}
+
+// writer writes big endian values and keeps the first error.
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (w *writer) write(v interface{}) {
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.BigEndian, v)
+	}
+}
+
+func (w *writer) length(n int) {
+	if n > 0xFFFF && w.err == nil {
+		w.err = fmt.Errorf("list of %d entries is too long for a module", n)
+	}
+	w.write(uint16(n))
+}
+
+func (w *writer) string(s string) {
+	w.length(len(s))
+	w.write([]byte(s))
+}
+
+// reader reads what writer wrote and keeps the first error, values read after an error are zero.
+type reader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *reader) read(v interface{}) {
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.BigEndian, v)
+	}
+}
+
+func (r *reader) length() int {
+	var n uint16
+	r.read(&n)
+	if r.err == nil && int(n) > r.r.Len() {
+		// Every entry takes at least a byte, this stops huge allocations for corrupted lengths
+		r.err = ErrModuleCorrupted
+		return 0
+	}
+	return int(n)
+}
+
+// index reads an index into a list of n entries.
+func (r *reader) index(n int) int {
+	var i uint16
+	r.read(&i)
+	if r.err == nil && int(i) >= n {
+		r.err = ErrModuleCorrupted
+	}
+	return int(i)
+}
+
+func (r *reader) string() string {
+	b := make([]byte, r.length())
+	r.read(b)
+	return string(b)
+}
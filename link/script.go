@@ -0,0 +1,83 @@
+package link
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultAddress is where the first relocatable section is placed when the script doesn't place it.
+const DefaultAddress uint16 = 0x3000
+
+// Placement places a relocatable section.
+type Placement struct {
+	Section string
+	Address uint16
+	Follow  bool // the section follows the previous one instead of starting at Address
+}
+
+// Script places the relocatable sections in the order of its placements. Sections which
+// aren't placed by the script follow the end of the highest section in the order they
+// first appear in the modules.
+type Script struct {
+	Placements []Placement
+}
+
+// ParseScript parses a linker script. Every line names a section and optionally its address,
+// a section without an address follows the previous one. Comments start with a semicolon:
+//
+//	; code at the default start address, data right after it
+//	text x3000
+//	data
+//	; a table at a fixed address
+//	table x4000
+func ParseScript(src []byte) (*Script, error) {
+	s := &Script{}
+	seen := map[string]bool{}
+	for i, line := range strings.Split(string(src), "\n") {
+		if c := strings.IndexByte(line, ';'); c >= 0 {
+			line = line[:c]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a section and an address", i+1)
+		}
+
+		p := Placement{Section: fields[0], Follow: len(fields) == 1}
+		if !p.Follow {
+			address, ok := parseAddress(fields[1])
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid address %s", i+1, fields[1])
+			}
+			p.Address = address
+		} else if len(s.Placements) == 0 {
+			p.Address, p.Follow = DefaultAddress, false
+		}
+		if seen[p.Section] {
+			return nil, fmt.Errorf("line %d: section %s is placed twice", i+1, p.Section)
+		}
+		seen[p.Section] = true
+		s.Placements = append(s.Placements, p)
+	}
+	return s, nil
+}
+
+// parseAddress parses x3000 and 0x3000 hexadecimal and #12288 decimal addresses.
+func parseAddress(s string) (uint16, bool) {
+	base := 16
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		s = s[2:]
+	case strings.HasPrefix(s, "x"), strings.HasPrefix(s, "X"):
+		s = s[1:]
+	case strings.HasPrefix(s, "#"):
+		s, base = s[1:], 10
+	default:
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, base, 16)
+	return uint16(v), err == nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/idexter/golang-lc3-vm/cfg"
+	"github.com/idexter/golang-lc3-vm/lint"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// lintCommand prints likely bugs of a program and exits with status 1 when it finds any.
+func lintCommand(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: golang-lc3-vm lint program.obj|source.asm")
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+	object, debug := readProgram(path)
+
+	g, err := cfg.FromObject(object)
+	if err != nil {
+		log.Fatalf("Can't read program %s: %v", path, err)
+	}
+	findings := lint.Lint(g, debug)
+	for _, f := range findings {
+		fmt.Printf("%s: %s (%s)\n", debug.Location(f.Address), f.Msg, f.Check)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// readProgram reads an object file in any format and its debug information, files ending
+// with .asm are assembled.
+func readProgram(path string) ([]byte, *vm.DebugInfo) {
+	if filepath.Ext(path) == ".asm" {
+		src, err := ioutil.ReadFile(path) //nolint: gosec
+		if err != nil {
+			log.Fatalf("Can't read program: %v", err)
+		}
+		p := assemble(path, src)
+		if len(p.Relocations) > 0 {
+			log.Fatalf("%s refers to relocatable sections or other modules, link it first", path)
+		}
+		return p.Object(), p.Debug()
+	}
+
+	b, err := vm.ReadObject(path)
+	if err != nil {
+		log.Fatalf("Can't read program: %v", err)
+	}
+	debug, err := vm.LoadDebugInfo(path, b)
+	if err != nil {
+		log.Fatalf("Can't load debug information: %v", err)
+	}
+	return b, debug
+}
+
+// labelsOf returns the labels of the debug information for disassembling, it is nil without debug information.
+func labelsOf(debug *vm.DebugInfo) func(uint16) (string, bool) {
+	if debug == nil {
+		return nil
+	}
+	return debug.Label
+}
@@ -0,0 +1,341 @@
+// Package lint looks for common bugs in LC-3 programs by analyzing their control-flow graph.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/idexter/golang-lc3-vm/cfg"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// Checks reported in findings.
+const (
+	Uninitialized  = "uninitialized"   // a register is read before it is written
+	ReturnAddress  = "return-address"  // RET after R7 was overwritten by a call
+	ConditionCodes = "condition-codes" // BR tests condition codes the previous instruction didn't set
+	JumpIntoData   = "jump-into-data"  // BR or JSR targets data or leaves the program
+	StoreIntoCode  = "store-into-code" // ST or STI overwrites an instruction
+)
+
+// Finding is a likely bug at an instruction.
+type Finding struct {
+	Address uint16
+	Check   string
+	Msg     string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("x%04X: %s (%s)", f.Address, f.Msg, f.Check)
+}
+
+// allRegisters is the set of R0-R7.
+const allRegisters = 0xFF
+
+// Lint checks the graph of a program, debug information is optional and tells data apart
+// from instructions. Findings are ordered by address.
+func Lint(g *cfg.Graph, debug *vm.DebugInfo) []Finding {
+	l := &linter{g: g, debug: debug, data: map[uint16]bool{}}
+	l.uninitialized()
+	l.returnAddress()
+	l.conditionCodes()
+	l.jumps()
+	l.stores()
+	sort.SliceStable(l.findings, func(i, j int) bool { return l.findings[i].Address < l.findings[j].Address })
+	return l.findings
+}
+
+type linter struct {
+	g        *cfg.Graph
+	debug    *vm.DebugInfo
+	data     map[uint16]bool // addresses loaded, stored or taken by instructions
+	findings []Finding
+}
+
+func (l *linter) report(ins cfg.Instruction, check, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{Address: ins.Address, Check: check, Msg: fmt.Sprintf(format, args...)})
+}
+
+// flow computes the state at the start of each block by iterating transfer until nothing
+// changes. Blocks are entered with the states of roots and merged over Next and Branch
+// edges, calls are left to the analysis of the subroutine. Blocks without a state aren't reached.
+func flow(g *cfg.Graph, roots map[*cfg.Block]int, merge func(x, y int) int, transfer func(b *cfg.Block, in int) int) map[*cfg.Block]int {
+	in := map[*cfg.Block]int{}
+	for b, state := range roots {
+		in[b] = state
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range g.Blocks {
+			state, ok := in[b]
+			if !ok {
+				continue
+			}
+			out := transfer(b, state)
+			for _, e := range b.Succs {
+				if e.Kind == cfg.Call {
+					continue
+				}
+				next, seen := in[e.To]
+				if seen {
+					out = merge(next, out)
+				}
+				if !seen || next != out {
+					in[e.To] = out
+					changed = true
+				}
+			}
+		}
+	}
+	return in
+}
+
+// reads returns the registers an instruction reads, AND Rx, Rx, #0 only clears Rx.
+func reads(ins cfg.Instruction) int {
+	switch ins.Op {
+	case vm.OP_ADD, vm.OP_AND:
+		if ins.Op == vm.OP_AND && ins.Imm && ins.Offset == 0 {
+			return 0
+		}
+		if ins.Imm {
+			return 1 << ins.R1
+		}
+		return 1<<ins.R1 | 1<<ins.R2
+	case vm.OP_NOT, vm.OP_LDR, vm.OP_JMP:
+		return 1 << ins.R1
+	case vm.OP_JSR:
+		if !ins.Imm {
+			return 1 << ins.R1
+		}
+	case vm.OP_ST, vm.OP_STI:
+		return 1 << ins.R0
+	case vm.OP_STR:
+		return 1<<ins.R0 | 1<<ins.R1
+	case vm.OP_TRAP:
+		switch ins.TrapVector() {
+		case vm.TRAP_OUT, vm.TRAP_PUTS, vm.TRAP_PUTSP:
+			return 1 << vm.R_R0
+		}
+	}
+	return 0
+}
+
+// writes returns the registers an instruction writes.
+func writes(ins cfg.Instruction) int {
+	switch ins.Op {
+	case vm.OP_ADD, vm.OP_AND, vm.OP_NOT, vm.OP_LD, vm.OP_LDI, vm.OP_LDR, vm.OP_LEA:
+		return 1 << ins.R0
+	case vm.OP_JSR:
+		return 1 << vm.R_R7
+	case vm.OP_TRAP:
+		switch ins.TrapVector() {
+		case vm.TRAP_GETC, vm.TRAP_IN:
+			return 1<<vm.R_R0 | 1<<vm.R_R7
+		}
+		return 1 << vm.R_R7
+	}
+	return 0
+}
+
+// uninitialized finds registers which are read before they are written. The program
+// starts without registers, subroutines take their arguments in any register and are
+// assumed to return results in any register.
+func (l *linter) uninitialized() {
+	roots := map[*cfg.Block]int{}
+	for _, b := range l.g.Subroutines {
+		roots[b] = allRegisters
+	}
+	if l.g.Entry != nil {
+		roots[l.g.Entry] = 0
+	}
+	defined := func(b *cfg.Block, in int, check func(cfg.Instruction, int)) int {
+		for _, ins := range b.Instructions {
+			if check != nil {
+				check(ins, reads(ins)&^in)
+			}
+			in |= writes(ins)
+			if ins.Op == vm.OP_JSR {
+				in = allRegisters
+			}
+		}
+		return in
+	}
+	in := flow(l.g, roots, func(x, y int) int { return x & y }, func(b *cfg.Block, in int) int { return defined(b, in, nil) })
+
+	for _, b := range l.g.Blocks {
+		state, ok := in[b]
+		if !ok {
+			continue
+		}
+		defined(b, state, func(ins cfg.Instruction, undefined int) {
+			for r := vm.R_R0; r <= vm.R_R7; r++ {
+				if undefined&(1<<r) != 0 {
+					l.report(ins, Uninitialized, "%s reads R%d before it is written", ins.Mnemonic(), r)
+				}
+			}
+		})
+	}
+}
+
+// returnAddress finds subroutines which return after a call overwrote R7. The state is
+// the address of the call plus one, or 0 while R7 holds the return address.
+func (l *linter) returnAddress() {
+	roots := map[*cfg.Block]int{}
+	for _, b := range l.g.Subroutines {
+		roots[b] = 0
+	}
+	track := func(b *cfg.Block, in int, check func(cfg.Instruction, int)) int {
+		for _, ins := range b.Instructions {
+			if ins.Op == vm.OP_JMP && ins.R1 == vm.R_R7 && check != nil {
+				check(ins, in)
+			}
+			switch {
+			case ins.Op == vm.OP_JSR || ins.Op == vm.OP_TRAP:
+				in = int(ins.Address) + 1
+			case writes(ins)&(1<<vm.R_R7) == 0:
+			case ins.Op == vm.OP_LD || ins.Op == vm.OP_LDI || ins.Op == vm.OP_LDR:
+				// Restored from where it was saved
+				in = 0
+			default:
+				in = int(ins.Address) + 1
+			}
+		}
+		return in
+	}
+	merge := func(x, y int) int {
+		if x > y {
+			return x
+		}
+		return y
+	}
+	in := flow(l.g, roots, merge, func(b *cfg.Block, in int) int { return track(b, in, nil) })
+
+	for _, b := range l.g.Blocks {
+		state, ok := in[b]
+		if !ok {
+			continue
+		}
+		track(b, state, func(ins cfg.Instruction, clobbered int) {
+			if clobbered != 0 {
+				by := l.g.Instruction(uint16(clobbered - 1))
+				l.report(ins, ReturnAddress, "RET after %s at x%04X overwrote R7, save and restore R7 around it",
+					by.Mnemonic(), by.Address)
+			}
+		})
+	}
+}
+
+// setsConditionCodes reports whether an instruction updates the condition codes.
+func setsConditionCodes(ins cfg.Instruction) bool {
+	switch ins.Op {
+	case vm.OP_ADD, vm.OP_AND, vm.OP_NOT, vm.OP_LD, vm.OP_LDI, vm.OP_LDR, vm.OP_LEA:
+		return true
+	}
+	return false
+}
+
+// conditionCodes finds conditional branches on condition codes which weren't set by the
+// instruction before them, earlier branches are skipped. The state is the address plus one
+// of the instruction which didn't set them, -1 at the program start and 0 when they are set.
+func (l *linter) conditionCodes() {
+	roots := map[*cfg.Block]int{}
+	for _, b := range l.g.Subroutines {
+		// Set by the caller, if anything
+		roots[b] = 0
+	}
+	if l.g.Entry != nil {
+		roots[l.g.Entry] = -1
+	}
+	track := func(b *cfg.Block, in int, check func(cfg.Instruction, int)) int {
+		for _, ins := range b.Instructions {
+			switch {
+			case ins.Op == vm.OP_BR:
+				if check != nil && ins.NZP != 0 && ins.Continues() {
+					check(ins, in)
+				}
+			case setsConditionCodes(ins), ins.Op == vm.OP_JSR:
+				// Subroutines may set them for their caller
+				in = 0
+			default:
+				in = int(ins.Address) + 1
+			}
+		}
+		return in
+	}
+	merge := func(x, y int) int {
+		if x == 0 || (y != 0 && y < x) {
+			return y
+		}
+		return x
+	}
+	in := flow(l.g, roots, merge, func(b *cfg.Block, in int) int { return track(b, in, nil) })
+
+	for _, b := range l.g.Blocks {
+		state, ok := in[b]
+		if !ok {
+			continue
+		}
+		track(b, state, func(ins cfg.Instruction, unset int) {
+			switch {
+			case unset < 0:
+				l.report(ins, ConditionCodes, "%s tests condition codes no instruction set", ins.Mnemonic())
+			case unset > 0:
+				by := l.g.Instruction(uint16(unset - 1))
+				l.report(ins, ConditionCodes, "%s tests condition codes %s at x%04X doesn't set",
+					ins.Mnemonic(), by.Mnemonic(), by.Address)
+			}
+		})
+	}
+}
+
+// instructions calls f for the reachable instructions in address order.
+func (l *linter) instructions(f func(ins cfg.Instruction)) {
+	for _, b := range l.g.Blocks {
+		for _, ins := range b.Instructions {
+			f(ins)
+		}
+	}
+}
+
+// jumps finds targets of BR, JSR and resolved JMP and JSRR which are data or outside of
+// the program. Data are the regions of the debug information and the words other
+// instructions load, store or take the address of.
+func (l *linter) jumps() {
+	l.instructions(func(ins cfg.Instruction) {
+		switch ins.Op {
+		case vm.OP_LD, vm.OP_LDI, vm.OP_ST, vm.OP_STI, vm.OP_LEA:
+			l.data[ins.Address+1+ins.Offset] = true
+		}
+	})
+	l.instructions(func(ins cfg.Instruction) {
+		target, ok := l.g.Target(ins)
+		switch {
+		case !ok:
+		case !l.g.Contains(target):
+			l.report(ins, JumpIntoData, "%s jumps to x%04X outside of the program", ins.Mnemonic(), target)
+		case l.data[target] || (l.debug != nil && l.debug.IsData(target)):
+			l.report(ins, JumpIntoData, "%s jumps into data at x%04X", ins.Mnemonic(), target)
+		}
+	})
+}
+
+// stores finds ST and STI which write into reachable instructions. STI is followed
+// through its pointer when the pointer is part of the program.
+func (l *linter) stores() {
+	l.instructions(func(ins cfg.Instruction) {
+		address := ins.Address + 1 + ins.Offset
+		switch ins.Op {
+		case vm.OP_ST:
+		case vm.OP_STI:
+			if !l.g.Contains(address) {
+				return
+			}
+			address = l.g.Word(address)
+		default:
+			return
+		}
+		if l.g.IsCode(address) {
+			l.report(ins, StoreIntoCode, "%s writes into code at x%04X", ins.Mnemonic(), address)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/cfg"
+)
+
+func lint(t *testing.T, src string) []string {
+	t.Helper()
+	p, err := asm.Assemble("test.asm", []byte(src))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	g, err := cfg.FromObject(p.Object())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	var findings []string
+	for _, f := range Lint(g, p.Debug()) {
+		findings = append(findings, f.String())
+	}
+	return findings
+}
+
+func TestLint_clean(t *testing.T) {
+	assert.Empty(t, lint(t, `
+	.ORIG x3000
+	AND R1, R1, #0
+	LD R2, COUNT
+LOOP	JSR PRINT
+	ADD R1, R1, #1
+	ADD R2, R2, #-1
+	BRp LOOP
+	HALT
+PRINT	ST R7, SAVE7
+	LEA R0, MSG
+	PUTS
+	LD R7, SAVE7
+	RET
+COUNT	.FILL 3
+SAVE7	.BLKW 1
+MSG	.STRINGZ "hi"
+	.END
+`))
+}
+
+func TestLint_uninitialized(t *testing.T) {
+	assert.Equal(t, []string{
+		"x3000: ADD reads R1 before it is written (uninitialized)",
+		"x3003: ADD reads R3 before it is written (uninitialized)",
+	}, lint(t, `
+	.ORIG x3000
+	ADD R2, R1, #1
+	BRz SKIP
+	AND R3, R3, #0
+SKIP	ADD R4, R3, R2
+	HALT
+	.END
+`))
+}
+
+func TestLint_returnAddress(t *testing.T) {
+	assert.Equal(t, []string{
+		"x3004: RET after PUTS at x3003 overwrote R7, save and restore R7 around it (return-address)",
+	}, lint(t, `
+	.ORIG x3000
+	JSR PRINT
+	HALT
+PRINT	LEA R0, MSG
+	PUTS
+	RET
+MSG	.STRINGZ "hi"
+	.END
+`))
+}
+
+func TestLint_conditionCodes(t *testing.T) {
+	assert.Equal(t, []string{
+		"x3000: BRz tests condition codes no instruction set (condition-codes)",
+		"x3003: BRp tests condition codes ST at x3002 doesn't set (condition-codes)",
+	}, lint(t, `
+	.ORIG x3000
+	BRz DONE
+	AND R0, R0, #0
+	ST R0, VALUE
+	BRp DONE
+DONE	HALT
+VALUE	.BLKW 1
+	.END
+`))
+}
+
+func TestLint_jumpIntoData(t *testing.T) {
+	assert.Equal(t, []string{
+		"x3001: BRz jumps into data at x3004 (jump-into-data)",
+		"x3002: JSR jumps to x3100 outside of the program (jump-into-data)",
+	}, lint(t, `
+	.ORIG x3000
+	LD R0, VALUE
+	BRz VALUE
+	JSR #253
+	HALT
+VALUE	.FILL x1234
+	.END
+`))
+}
+
+func TestLint_storeIntoCode(t *testing.T) {
+	assert.Equal(t, []string{
+		"x3001: ST writes into code at x3000 (store-into-code)",
+		"x3002: STI writes into code at x3003 (store-into-code)",
+	}, lint(t, `
+	.ORIG x3000
+START	AND R0, R0, #0
+	ST R0, START
+	STI R0, PTR
+	HALT
+PTR	.FILL x3003
+	.END
+`))
+}
@@ -2,23 +2,90 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
-
-	"github.com/idexter/golang-lc3-vm/vm"
+	"path/filepath"
+	"strings"
 )
 
+const usage = `Usage: golang-lc3-vm command [flags] [arguments]
+       golang-lc3-vm program.obj
+
+Commands:
+  run      run a program
+  trace    run a program and write every executed instruction to stderr
+  debug    run a program under an interactive debugger
+  apps     list and run the programs built into the binary
+  asm      assemble a source file
+  link     link modules into an object file
+  compile  compile a C-like program
+  disasm   disassemble a program
+  dump     print the words of a program in hex
+  convert  convert object files between the obj, hex and bin formats
+  lint     report likely bugs of a program
+  cfg      print the control-flow graph of a program
+  grade    run the test cases of a spec against a program
+
+Run "golang-lc3-vm command --help" for the flags of a command.
+`
+
 func main() {
 	args := os.Args[1:]
 	if len(args) == 0 {
-		fmt.Println("Missing argument!")
-		return
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
 
-	lc3 := vm.NewCPU(&vm.LC3RAM{
-		CheckKey: vm.CheckKeyPressed,
-		GetChar:  vm.GetCharFromStdin,
-	}, os.Stdout)
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+	case "run":
+		runCommand(args[1:])
+	case "trace":
+		traceCommand(args[1:])
+	case "debug":
+		debugCommand(args[1:])
+	case "disasm":
+		disasmCommand(args[1:])
+	case "dump":
+		dumpCommand(args[1:])
+	case "grade":
+		gradeCommand(args[1:])
+	case "asm":
+		asmCommand(args[1:])
+	case "link":
+		linkCommand(args[1:])
+	case "lint":
+		lintCommand(args[1:])
+	case "cfg":
+		cfgCommand(args[1:])
+	case "compile":
+		compileCommand(args[1:])
+	case "convert":
+		convertCommand(args[1:])
+	case "apps":
+		appsCommand(args[1:])
+	default:
+		// "golang-lc3-vm program.obj" is a shortcut for "golang-lc3-vm run program.obj"
+		if !isProgram(args[0]) {
+			fmt.Fprintf(os.Stderr, "Unknown command %s\n\n", args[0])
+			printUsage(os.Stderr)
+			os.Exit(2)
+		}
+		runCommand(args)
+	}
+}
+
+// isProgram reports whether the first argument of the shortcut is a program or a flag of
+// run rather than a mistyped command: it has an extension or exists.
+func isProgram(arg string) bool {
+	if strings.HasPrefix(arg, "-") || filepath.Ext(arg) != "" {
+		return true
+	}
+	_, err := os.Stat(arg)
+	return err == nil
+}
 
-	lc3.RAM.Load(args[0])
-	lc3.Run()
+func printUsage(w io.Writer) {
+	_, _ = io.WriteString(w, usage)
 }
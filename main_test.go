@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isProgram(t *testing.T) {
+	assert.True(t, isProgram("missing.obj"))
+	assert.True(t, isProgram("--engine"))
+	assert.True(t, isProgram("apps"))
+	assert.False(t, isProgram("rn"))
+	assert.False(t, isProgram("compiel"))
+}
@@ -0,0 +1,126 @@
+// Package pool runs many LC-3 programs concurrently, each one in its own isolated VM.
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+var (
+	// ErrInstructionLimit is returned for programs which didn't halt within their instruction limit.
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+	// ErrTimeout is returned for programs which didn't halt within their timeout.
+	ErrTimeout = errors.New("timeout exceeded")
+)
+
+// Job is a program to run.
+type Job struct {
+	Name  string
+	Image []byte // object file contents
+	Input []byte // keys typed while the program runs
+	// MaxInstructions and Timeout limit the execution, zero values mean no limit.
+	MaxInstructions uint64
+	Timeout         time.Duration
+	Engine          vm.Engine
+}
+
+// Result is the outcome of a Job.
+type Result struct {
+	Name         string
+	Output       []byte
+	Instructions uint64
+	Duration     time.Duration
+	// Err is nil when the program halted.
+	Err error
+}
+
+// Run executes jobs using at most workers goroutines and returns their results in the
+// order of jobs. Jobs which didn't start before ctx is done fail with the error of ctx.
+func Run(ctx context.Context, jobs []Job, workers int) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]Result, len(jobs))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				results[j] = runJob(ctx, jobs[j])
+			}
+		}()
+	}
+	for j := range jobs {
+		next <- j
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// runJob executes a single job in a fresh VM.
+func runJob(ctx context.Context, job Job) Result {
+	result := Result{Name: job.Name}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	var out bytes.Buffer
+	keyboard := vm.NewKeyboard(job.Input)
+	cpu := vm.NewCPU(&vm.LC3RAM{
+		CheckKey: keyboard.CheckKey,
+		GetChar:  keyboard.GetChar,
+	}, &out)
+	cpu.SetEngine(job.Engine)
+	cpu.SetInstructionLimit(job.MaxInstructions)
+	if err := cpu.RAM.LoadObject(job.Image); err != nil {
+		result.Err = err
+		return result
+	}
+
+	jobCtx := ctx
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-jobCtx.Done():
+			cpu.Stop()
+		case <-done:
+		}
+	}()
+
+	run := cpu.Run()
+	close(done)
+	<-stopped
+
+	result.Output = out.Bytes()
+	result.Instructions = run.Instructions
+	result.Duration = run.Duration
+	switch {
+	case run.Reason == vm.StopHalt:
+	case run.Reason == vm.StopInstructionLimit:
+		result.Err = ErrInstructionLimit
+	case run.Reason == vm.StopOutputError:
+		result.Err = run.Err
+	case ctx.Err() != nil:
+		result.Err = ctx.Err()
+	default:
+		result.Err = ErrTimeout
+	}
+	return result
+}
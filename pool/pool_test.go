@@ -0,0 +1,85 @@
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+func objectImage(words ...uint16) []byte {
+	b := make([]byte, 2+2*len(words))
+	binary.BigEndian.PutUint16(b, vm.PC_START)
+	for i, w := range words {
+		binary.BigEndian.PutUint16(b[2+2*i:], w)
+	}
+	return b
+}
+
+// echo prints its input until the keyboard runs out of keys.
+var echo = objectImage(
+	0xF020,                 // LOOP GETC
+	0b0001_000_000_1_00000, // ADD R0, R0, #0
+	0b0000_010_000000010,   // BRz DONE
+	0xF021,                 // OUT
+	0b0000_111_111111011,   // BRnzp LOOP
+	0xF025,                 // DONE HALT
+)
+
+var spin = objectImage(
+	0b0000_111_111111111, // BRnzp #-1
+)
+
+func TestRun(t *testing.T) {
+	var jobs []Job
+	for i := 0; i < 64; i++ {
+		jobs = append(jobs, Job{
+			Name:   fmt.Sprint(i),
+			Image:  echo,
+			Input:  []byte(fmt.Sprintf("job %d", i)),
+			Engine: vm.Engine(i % 3),
+		})
+	}
+
+	results := Run(context.Background(), jobs, 8)
+	assert.Len(t, results, len(jobs))
+	for i, r := range results {
+		assert.Nil(t, r.Err)
+		assert.Equal(t, fmt.Sprint(i), r.Name)
+		assert.Equal(t, fmt.Sprintf("job %dHALT\n", i), string(r.Output))
+		assert.NotZero(t, r.Instructions)
+	}
+}
+
+func TestRun_limits(t *testing.T) {
+	results := Run(context.Background(), []Job{
+		{Name: "limit", Image: spin, MaxInstructions: 1000},
+		{Name: "timeout", Image: spin, Timeout: 10 * time.Millisecond, Engine: vm.EngineThreaded},
+		{Name: "invalid", Image: []byte{0x30}},
+		{Name: "halt", Image: echo, MaxInstructions: 1000},
+	}, 4)
+
+	assert.Equal(t, ErrInstructionLimit, results[0].Err)
+	assert.Equal(t, uint64(1000), results[0].Instructions)
+	assert.Equal(t, ErrTimeout, results[1].Err)
+	assert.Equal(t, vm.ErrObjectTooShort, results[2].Err)
+	assert.Nil(t, results[3].Err)
+}
+
+func TestRun_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	results := Run(ctx, []Job{{Image: spin}, {Image: spin}, {Image: echo}}, 1)
+	for _, r := range results {
+		assert.Equal(t, context.Canceled, r.Err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/idexter/golang-lc3-vm/grade"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// profileTop is the number of addresses and subroutines in the profile report.
+const profileTop = 20
+
+// runCommand loads a program or resumes a snapshot and runs it.
+func runCommand(args []string) {
+	runProgram("run", args, diskFS{}, func(name string) string { return name })
+}
+
+// diskFS opens files by their paths, unlike os.DirFS it accepts absolute and relative paths.
+type diskFS struct{}
+
+func (diskFS) Open(name string) (fs.File, error) {
+	return os.Open(name) //nolint: gosec
+}
+
+// runProgram runs a program of fsys, resolve maps the program argument to its name in fsys.
+func runProgram(command string, args []string, fsys fs.FS, resolve func(string) string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	saveOnExit := flags.String("save-on-exit", "", "save a machine snapshot to `file` when the program stops")
+	resume := flags.String("resume", "", "resume the machine from a snapshot `file` instead of loading a program")
+	record := flags.String("record", "", "record keyboard input to a replay `file`")
+	replay := flags.String("replay", "", "feed keyboard input from a replay `file` instead of the terminal")
+	profile := flags.String("profile", "", "write a text report of hot addresses and subroutines to `file`")
+	pprof := flags.String("pprof", "", "write a profile for \"go tool pprof\" to `file`")
+	coverage := flags.String("coverage", "", "write a coverage report of the program to `file`")
+	coverageFormat := flags.String("coverage-format", "html", "coverage report `format`: html or lcov")
+	stats := flags.Bool("stats", false, "print statistics of the run to standard error")
+	engineName := flags.String("engine", "interpreter", "execution `engine`: interpreter, cached or threaded")
+	start := wordFlag(vm.PC_START)
+	flags.Var(&start, "start", "start the program at `address` instead of x3000")
+	maxInstructions := flags.Uint64("max-instructions", 0, "stop after `n` instructions, 0 is unlimited")
+	input := flags.String("input", "", "type the contents of `file` on the keyboard instead of reading the terminal")
+	output := flags.String("output", "", "write the output of the program to `file` instead of stdout")
+	trace := flags.String("trace", "", "write every executed instruction and the registers it changed to `file`, - is stderr")
+	quiet := flags.Bool("quiet", false, "don't print the HALT line when the program halts")
+	flags.BoolVar(quiet, "q", false, "shorthand for --quiet")
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) > 1 || (len(paths) == 0 && *resume == "") {
+		fmt.Fprintf(os.Stderr, "Usage: golang-lc3-vm %s [flags] program.obj\n", command)
+		os.Exit(2)
+	}
+	engine, err := vm.ParseEngine(*engineName)
+	if err != nil {
+		log.Fatalf("Can't select engine: %v", err)
+	}
+	if *coverageFormat != "html" && *coverageFormat != "lcov" {
+		// Checked before the run, which may take long
+		log.Fatalf("Unknown coverage format: %s", *coverageFormat)
+	}
+
+	ram := &vm.LC3RAM{}
+	if *input != "" {
+		b, err := ioutil.ReadFile(*input)
+		if err != nil {
+			log.Fatalf("Can't read input: %v", err)
+		}
+		keyboard := vm.NewKeyboard(b)
+		ram.CheckKey, ram.GetChar = keyboard.CheckKey, keyboard.GetChar
+	} else {
+		stdin := vm.NewTerminal(os.Stdin)
+		ram.CheckKey, ram.GetChar = stdin.CheckKey, stdin.GetChar
+	}
+	out := io.Writer(os.Stdout)
+	var outFile *os.File
+	if *output != "" {
+		if outFile, err = os.Create(*output); err != nil {
+			log.Fatalf("Can't create output: %v", err)
+		}
+		out = outFile
+	}
+	lc3 := vm.NewCPU(ram, out)
+	lc3.SetEngine(engine)
+	lc3.StartPosition = uint16(start)
+	lc3.SetInstructionLimit(*maxInstructions)
+	lc3.SetQuiet(*quiet)
+
+	var program string
+	if len(paths) > 0 {
+		program = resolve(paths[0])
+	}
+	switch {
+	case *resume != "":
+		b, err := ioutil.ReadFile(*resume)
+		if err != nil {
+			log.Fatalf("Can't read snapshot: %v", err)
+		}
+		if err := lc3.Restore(b); err != nil {
+			log.Fatalf("Can't restore snapshot: %v", err)
+		}
+	default:
+		if err := lc3.RAM.LoadFS(fsys, program); err != nil {
+			log.Fatalf("Can't load program: %v", err)
+		}
+	}
+
+	var recorder *vm.InputRecorder
+	if *record != "" {
+		recorder = lc3.RecordInput()
+	}
+	var replayer *vm.InputReplayer
+	if *replay != "" {
+		replayer = lc3.ReplayInput(readReplay(*replay))
+	}
+
+	var coverer *vm.Coverage
+	if *coverage != "" {
+		if program == "" {
+			log.Fatalf("Coverage needs the program object file")
+		}
+		coverer = lc3.StartCoverage()
+	}
+
+	var profiler *vm.Profile
+	if *profile != "" || *pprof != "" {
+		profiler = lc3.StartProfile()
+	}
+
+	var tracer *tracer
+	if *trace != "" {
+		tracer = startTrace(lc3, *trace)
+	}
+
+	if *saveOnExit != "" || *record != "" {
+		// Stop the CPU on interrupt, so that its state and input can still be saved
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			lc3.Stop()
+		}()
+	}
+
+	lc3.CollectStats(*stats)
+	var result vm.RunResult
+	if *resume != "" {
+		result = lc3.Resume()
+	} else {
+		result = lc3.Run()
+	}
+	if *stats {
+		if err := result.WriteSummary(os.Stderr); err != nil {
+			log.Fatalf("Can't write statistics: %v", err)
+		}
+	}
+
+	if replayer != nil && replayer.Err() != nil {
+		log.Printf("warning, run diverged from the recording: %v", replayer.Err())
+	}
+	if recorder != nil {
+		writeReplay(*record, recorder.Events)
+	}
+	if *profile != "" {
+		writeFile(*profile, func(w io.Writer) error { return profiler.WriteReport(w, profileTop) })
+	}
+	if *pprof != "" {
+		writeFile(*pprof, profiler.WritePprof)
+	}
+	if coverer != nil {
+		writeCoverage(*coverage, *coverageFormat, coverer, fsys, program, lc3.RAM.Debug)
+	}
+
+	if *saveOnExit != "" {
+		b, err := lc3.Snapshot()
+		if err != nil {
+			log.Fatalf("Can't take snapshot: %v", err)
+		}
+		if err := ioutil.WriteFile(*saveOnExit, b, 0600); err != nil {
+			log.Fatalf("Can't write snapshot: %v", err)
+		}
+	}
+	if tracer != nil {
+		tracer.close()
+	}
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			log.Fatalf("Can't write output: %v", err)
+		}
+	}
+
+	if result.Reason == vm.StopOutputError {
+		log.Fatalf("Can't write output: %v", result.Err)
+	}
+	// The exit status tells scripts whether the program finished
+	if !lc3.Halted() {
+		if result.Reason == vm.StopInstructionLimit {
+			log.Printf("Instruction limit reached at %s", lc3.Location(result.PC))
+		}
+		os.Exit(1)
+	}
+}
+
+// wordFlag is a flag holding an address or another word, like x3000, 0x3000 or 12288.
+type wordFlag uint16
+
+func (f *wordFlag) String() string {
+	return fmt.Sprintf("x%04X", uint16(*f))
+}
+
+func (f *wordFlag) Set(s string) error {
+	w, err := grade.ParseWord(s)
+	*f = wordFlag(w)
+	return err
+}
+
+func readReplay(path string) []vm.InputEvent {
+	f, err := os.Open(path) //nolint: gosec
+	if err != nil {
+		log.Fatalf("Can't open replay: %v", err)
+	}
+	defer f.Close()
+
+	events, err := vm.ReadReplay(f)
+	if err != nil {
+		log.Fatalf("Can't read replay: %v", err)
+	}
+	return events
+}
+
+// writeCoverage writes the coverage of the program loaded from fsys. It is reported per
+// source line with debug information, otherwise each word of the object file is a line.
+func writeCoverage(path, format string, c *vm.Coverage, fsys fs.FS, program string, debug *vm.DebugInfo) {
+	b, err := vm.ReadObjectFS(fsys, program)
+	if err != nil || len(b) < 2 {
+		log.Fatalf("Can't read program: %v", err)
+	}
+	o := vm.CoverageOptions{
+		Name:  program,
+		Start: binary.BigEndian.Uint16(b),
+		Size:  (len(b) - 2) / 2,
+	}
+	if debug != nil {
+		o.Source = debug
+	}
+
+	switch format {
+	case "html":
+		writeFile(path, func(w io.Writer) error { return c.WriteHTML(w, o) })
+	case "lcov":
+		writeFile(path, func(w io.Writer) error { return c.WriteLcov(w, o) })
+	default:
+		log.Fatalf("Unknown coverage format: %s", format)
+	}
+}
+
+func writeReplay(path string, events []vm.InputEvent) {
+	writeFile(path, func(w io.Writer) error { return vm.WriteReplay(w, events) })
+}
+
+// writeFile creates a file and fills it with write.
+func writeFile(path string, write func(w io.Writer) error) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Can't create %s: %v", path, err)
+	}
+	if err := write(f); err != nil {
+		log.Fatalf("Can't write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Can't write %s: %v", path, err)
+	}
+}
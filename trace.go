@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/cfg"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// traceCommand runs a program and writes every executed instruction to stderr, it takes
+// the flags of run.
+func traceCommand(args []string) {
+	runProgram("trace", append([]string{"--trace=-"}, args...), diskFS{}, func(name string) string { return name })
+}
+
+// tracer writes a line per executed instruction: its source location, or its address and
+// disassembly without debug information, and the registers it changed.
+type tracer struct {
+	w      *bufio.Writer
+	file   *os.File // nil when the trace isn't written to a file of its own
+	before vm.State
+}
+
+// startTrace traces the instructions of lc3 into path, - is stderr.
+func startTrace(lc3 *vm.LC3CPU, path string) *tracer {
+	if path == "-" {
+		return newTracer(lc3, os.Stderr)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Can't create trace: %v", err)
+	}
+	t := newTracer(lc3, f)
+	t.file = f
+	return t
+}
+
+// newTracer traces the instructions of lc3 into w.
+func newTracer(lc3 *vm.LC3CPU, w io.Writer) *tracer {
+	t := &tracer{w: bufio.NewWriter(w)}
+	lc3.AddHooks(&vm.Hooks{
+		BeforeInstruction: func(_, _ uint16) {
+			t.before = lc3.State()
+		},
+		AfterInstruction: func(pc, instr uint16) {
+			t.write(traceLocation(lc3.RAM.Debug, pc, instr), lc3.State())
+		},
+	})
+	return t
+}
+
+// traceLocation describes an executed instruction as "prog.asm:42: ADD R1, R1, #-1" when
+// the debug information has its statement, otherwise as "x3000  ADD R1, R1, #-1".
+func traceLocation(debug *vm.DebugInfo, pc, instr uint16) string {
+	if debug != nil {
+		if _, ok := debug.Line(pc); ok {
+			return debug.Location(pc)
+		}
+	}
+	ins := cfg.Instruction{Address: pc, Instruction: vm.Decode(instr)}
+	return fmt.Sprintf("x%04X  %s", pc, ins.Format(labelsOf(debug)))
+}
+
+func (t *tracer) write(location string, after vm.State) {
+	var changes []string
+	for r, v := range after.Registers {
+		if v != t.before.Registers[r] {
+			changes = append(changes, fmt.Sprintf("R%d=x%04X", r, v))
+		}
+	}
+	if after.Cond != t.before.Cond {
+		changes = append(changes, "CC="+condName(after.Cond))
+	}
+	line := strings.TrimRight(fmt.Sprintf("%-31s %s", location, strings.Join(changes, " ")), " ")
+	if _, err := fmt.Fprintln(t.w, line); err != nil {
+		log.Fatalf("Can't write trace: %v", err)
+	}
+}
+
+// close flushes the trace.
+func (t *tracer) close() {
+	if err := t.w.Flush(); err != nil {
+		log.Fatalf("Can't write trace: %v", err)
+	}
+	if t.file != nil {
+		if err := t.file.Close(); err != nil {
+			log.Fatalf("Can't write trace: %v", err)
+		}
+	}
+}
+
+// condName formats condition codes as n, z or p.
+func condName(cond uint16) string {
+	var sb strings.Builder
+	for _, c := range []struct {
+		flag uint16
+		name string
+	}{{vm.FL_NEG, "n"}, {vm.FL_ZRO, "z"}, {vm.FL_POS, "p"}} {
+		if cond&c.flag != 0 {
+			sb.WriteString(c.name)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/idexter/golang-lc3-vm/asm"
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+func TestTracer(t *testing.T) {
+	p, err := asm.Assemble("prog.asm", []byte(`
+        .ORIG x3000
+        AND R1, R1, #0
+        ADD R1, R1, #-1
+        HALT
+        .END
+`))
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		debug *vm.DebugInfo
+		want  []string
+	}{
+		{p.Debug(), []string{
+			"prog.asm:3: AND R1, R1, #0",
+			"prog.asm:4: ADD R1, R1, #-1     R1=xFFFF CC=n",
+			"prog.asm:5: HALT                R7=x3003",
+		}},
+		{nil, []string{
+			"x3000  AND R1, R1, #0",
+			"x3001  ADD R1, R1, #-1          R1=xFFFF CC=n",
+			"x3002  HALT                     R7=x3003",
+		}},
+	} {
+		var out, trace bytes.Buffer
+		lc3 := vm.NewCPU(&vm.LC3RAM{CheckKey: vm.NewKeyboard(nil).CheckKey}, &out)
+		assert.Nil(t, lc3.RAM.LoadObject(p.Object()))
+		lc3.RAM.Debug = c.debug
+		tracer := newTracer(lc3, &trace)
+		lc3.Run()
+		tracer.close()
+
+		assert.Equal(t, strings.Join(c.want, "\n")+"\n", trace.String())
+	}
+}
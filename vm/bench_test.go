@@ -0,0 +1,185 @@
+package vm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// benchProgram is an LC-3 program loaded at PC_START which runs until HALT.
+type benchProgram struct {
+	name  string
+	words []uint16
+}
+
+var benchPrograms = []benchProgram{
+	{
+		// Tight arithmetic loop, 10000 iterations
+		name: "arithmetic",
+		words: []uint16{
+			0b0010_001_000000110,    // LD R1, COUNT
+			0b0001_000_000_0_00_010, // LOOP ADD R0, R0, R2
+			0b0001_011_011_1_00001,  // ADD R3, R3, #1
+			0b0101_100_000_0_00_011, // AND R4, R0, R3
+			0b0001_001_001_1_11111,  // ADD R1, R1, #-1
+			0b0000_001_111111011,    // BRp LOOP
+			0xF025,                  // HALT
+			10000,                   // COUNT .FILL #10000
+		},
+	},
+	{
+		// Copies 1000 words starting at the program itself to x5000
+		name: "memcopy",
+		words: []uint16{
+			0b0010_000_000001001,   // LD R0, SRC
+			0b0010_001_000001001,   // LD R1, DST
+			0b0010_010_000001001,   // LD R2, COUNT
+			0b0110_011_000_000000,  // LOOP LDR R3, R0, #0
+			0b0111_011_001_000000,  // STR R3, R1, #0
+			0b0001_000_000_1_00001, // ADD R0, R0, #1
+			0b0001_001_001_1_00001, // ADD R1, R1, #1
+			0b0001_010_010_1_11111, // ADD R2, R2, #-1
+			0b0000_001_111111010,   // BRp LOOP
+			0xF025,                 // HALT
+			0x3000,                 // SRC .FILL x3000
+			0x5000,                 // DST .FILL x5000
+			1000,                   // COUNT .FILL #1000
+		},
+	},
+	{
+		// Recursive Fibonacci, R1 = FIB(15), arguments and return addresses are saved on the R6 stack
+		name: "recursion",
+		words: []uint16{
+			0b0010_110_000011001,    // LD R6, STACK
+			0b0010_000_000010111,    // LD R0, N
+			0b0100_1_00000000001,    // JSR FIB
+			0xF025,                  // HALT
+			0b0001_110_110_1_11111,  // FIB ADD R6, R6, #-1
+			0b0111_111_110_000000,   // STR R7, R6, #0
+			0b0001_001_000_1_11110,  // ADD R1, R0, #-2
+			0b0000_011_000000010,    // BRzp RECURSE
+			0b0001_001_000_1_00000,  // ADD R1, R0, #0
+			0b0000_111_000001100,    // BRnzp DONE
+			0b0001_110_110_1_11111,  // RECURSE ADD R6, R6, #-1
+			0b0111_000_110_000000,   // STR R0, R6, #0
+			0b0001_000_000_1_11111,  // ADD R0, R0, #-1
+			0b0100_1_11111110110,    // JSR FIB
+			0b0110_000_110_000000,   // LDR R0, R6, #0
+			0b0001_110_110_1_11111,  // ADD R6, R6, #-1
+			0b0111_001_110_000000,   // STR R1, R6, #0
+			0b0001_000_000_1_11110,  // ADD R0, R0, #-2
+			0b0100_1_11111110001,    // JSR FIB
+			0b0110_010_110_000000,   // LDR R2, R6, #0
+			0b0001_001_001_0_00_010, // ADD R1, R1, R2
+			0b0001_110_110_1_00010,  // ADD R6, R6, #2
+			0b0110_111_110_000000,   // DONE LDR R7, R6, #0
+			0b0001_110_110_1_00001,  // ADD R6, R6, #1
+			0b1100_000_111_000000,   // RET
+			15,                      // N .FILL #15
+			0x6000,                  // STACK .FILL x6000
+		},
+	},
+	{
+		// Prints a string 100 times with PUTS
+		name: "puts",
+		words: append([]uint16{
+			0b0010_001_000000101,   // LD R1, COUNT
+			0b1110_000_000000101,   // LOOP LEA R0, MSG
+			0xF022,                 // PUTS
+			0b0001_001_001_1_11111, // ADD R1, R1, #-1
+			0b0000_001_111111100,   // BRp LOOP
+			0xF025,                 // HALT
+			100,                    // COUNT .FILL #100
+		}, stringz("Hello, LC-3!\n")...), // MSG .STRINGZ
+	},
+}
+
+// stringz encodes a string the way .STRINGZ does, one character per word and a terminating zero.
+func stringz(s string) []uint16 {
+	words := make([]uint16, 0, len(s)+1)
+	for _, c := range []byte(s) {
+		words = append(words, uint16(c))
+	}
+	return append(words, 0)
+}
+
+func newBenchCPU(p benchProgram, engine Engine) *LC3CPU {
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, ioutil.Discard)
+	vm.SetEngine(engine)
+	for i, w := range p.words {
+		vm.RAM.Write(PC_START+uint16(i), w)
+	}
+	return vm
+}
+
+func TestBenchPrograms(t *testing.T) {
+	var out bytes.Buffer
+	results := map[string]func(vm *LC3CPU){
+		"arithmetic": func(vm *LC3CPU) {
+			assert.Equal(t, uint16(0), vm.registers[R_R1])
+			assert.Equal(t, uint16(10000), vm.registers[R_R3])
+		},
+		"memcopy": func(vm *LC3CPU) {
+			assert.Equal(t, vm.RAM.Storage[0x3000:0x3000+1000], vm.RAM.Storage[0x5000:0x5000+1000])
+			assert.Equal(t, uint16(0xF025), vm.RAM.Storage[0x5009])
+		},
+		"recursion": func(vm *LC3CPU) {
+			assert.Equal(t, uint16(610), vm.registers[R_R1])
+			assert.Equal(t, uint16(0x6000), vm.registers[R_R6])
+		},
+		"puts": func(vm *LC3CPU) {
+			assert.Equal(t, 100*len("Hello, LC-3!\n")+len("HALT\n"), out.Len())
+		},
+	}
+
+	for _, p := range benchPrograms {
+		for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+			out.Reset()
+			vm := newBenchCPU(p, engine)
+			vm.output = &out
+			vm.Run()
+			results[p.name](vm)
+		}
+	}
+}
+
+// benchmarkProgram runs a program until HALT per iteration.
+func benchmarkProgram(b *testing.B, p benchProgram, engine Engine) {
+	vm := newBenchCPU(p, engine)
+
+	start := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm.Run()
+	}
+	b.ReportMetric(float64(vm.instructions)/time.Since(start).Seconds(), "instructions/s")
+	b.ReportMetric(float64(vm.instructions)/float64(b.N), "instructions/op")
+}
+
+func benchmarkPrograms(b *testing.B, name string) {
+	for _, p := range benchPrograms {
+		if p.name == name {
+			for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+				engine := engine
+				b.Run(engine.String(), func(b *testing.B) { benchmarkProgram(b, p, engine) })
+			}
+			return
+		}
+	}
+	b.Fatalf("unknown program %s", name)
+}
+
+func BenchmarkLC3CPU_arithmetic(b *testing.B) { benchmarkPrograms(b, "arithmetic") }
+
+func BenchmarkLC3CPU_memcopy(b *testing.B) { benchmarkPrograms(b, "memcopy") }
+
+func BenchmarkLC3CPU_recursion(b *testing.B) { benchmarkPrograms(b, "recursion") }
+
+func BenchmarkLC3CPU_puts(b *testing.B) { benchmarkPrograms(b, "puts") }
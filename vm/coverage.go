@@ -0,0 +1,189 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SourceMap resolves addresses to the source code they were assembled from.
+type SourceMap interface {
+	// Source returns the file and line of an instruction, ok is false for addresses without code.
+	Source(address uint16) (file string, line int, ok bool)
+}
+
+// BranchCoverage counts both directions of a conditional branch.
+type BranchCoverage struct {
+	Taken    uint64
+	NotTaken uint64
+}
+
+// Coverage counts executions per address and directions of conditional branches.
+type Coverage struct {
+	Hits     [MaxMemorySize]uint64
+	Branches map[uint16]*BranchCoverage // by address of the BR instruction
+
+	ram   *LC3RAM // used to find branches which were never executed
+	hooks *Hooks
+}
+
+// StartCoverage enables coverage collection.
+func (v *LC3CPU) StartCoverage() *Coverage {
+	v.StopCoverage()
+	c := &Coverage{Branches: map[uint16]*BranchCoverage{}, ram: v.RAM}
+	c.hooks = &Hooks{AfterInstruction: func(pc, instr uint16) { c.record(pc, instr, v.registers[R_COND]) }}
+	v.AddHooks(c.hooks)
+	v.coverage = c
+	return c
+}
+
+// StopCoverage disables coverage collection.
+func (v *LC3CPU) StopCoverage() {
+	if v.coverage != nil {
+		v.RemoveHooks(v.coverage.hooks)
+		v.coverage = nil
+	}
+}
+
+// record accounts instruction instr at pc executed with condition codes cond.
+func (c *Coverage) record(pc, instr, cond uint16) {
+	c.Hits[pc]++
+	if !isConditionalBranch(instr) {
+		return
+	}
+	b, ok := c.Branches[pc]
+	if !ok {
+		b = &BranchCoverage{}
+		c.Branches[pc] = b
+	}
+	if (instr>>9)&cond != 0 {
+		b.Taken++
+	} else {
+		b.NotTaken++
+	}
+}
+
+// isConditionalBranch reports whether instr is a BR with two directions. BR without
+// flags never jumps and BRnzp always does.
+func isConditionalBranch(instr uint16) bool {
+	nzp := (instr >> 9) & 0x7
+	return instr>>12 == OP_BR && nzp != 0 && nzp != FL_NEG|FL_ZRO|FL_POS
+}
+
+// CoverageOptions describe the program a coverage report is written for.
+type CoverageOptions struct {
+	// Name is used as the file name when there is no source map.
+	Name string
+	// Start is the first address of the program and Size its length in words.
+	Start uint16
+	Size  int
+	// Source is optional, without it every program address is reported as a line of Name.
+	Source SourceMap
+}
+
+// coverageLine is a single line of a coverage report.
+type coverageLine struct {
+	Line      int
+	Address   uint16 // first address of the line
+	Hits      uint64
+	Branches  []BranchCoverage
+	Executed  bool
+	Partially bool // some branch direction was never taken
+}
+
+// coverageFile is a source file of a coverage report.
+type coverageFile struct {
+	Name  string
+	Lines []*coverageLine
+}
+
+// files groups program addresses into source lines. Lines are hit as often as their
+// most executed address.
+func (c *Coverage) files(o CoverageOptions) []*coverageFile {
+	byName := map[string]map[int]*coverageLine{}
+	for i := 0; i < o.Size; i++ {
+		address := o.Start + uint16(i)
+		name, line := o.Name, i+1
+		if o.Source != nil {
+			var ok bool
+			if name, line, ok = o.Source.Source(address); !ok {
+				continue
+			}
+		}
+
+		lines, ok := byName[name]
+		if !ok {
+			lines = map[int]*coverageLine{}
+			byName[name] = lines
+		}
+		l, ok := lines[line]
+		if !ok {
+			l = &coverageLine{Line: line, Address: address}
+			lines[line] = l
+		}
+		if c.Hits[address] > l.Hits {
+			l.Hits = c.Hits[address]
+		}
+		l.Executed = l.Hits > 0
+		if b, ok := c.Branches[address]; ok {
+			l.Branches = append(l.Branches, *b)
+			l.Partially = l.Partially || b.Taken == 0 || b.NotTaken == 0
+		} else if isConditionalBranch(c.ram.Storage[address]) {
+			l.Branches = append(l.Branches, BranchCoverage{})
+			l.Partially = true
+		}
+	}
+
+	files := make([]*coverageFile, 0, len(byName))
+	for name, lines := range byName {
+		f := &coverageFile{Name: name}
+		for _, l := range lines {
+			f.Lines = append(f.Lines, l)
+		}
+		sort.Slice(f.Lines, func(i, j int) bool { return f.Lines[i].Line < f.Lines[j].Line })
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// WriteLcov writes the coverage in the lcov tracefile format.
+func (c *Coverage) WriteLcov(w io.Writer, o CoverageOptions) error {
+	for _, f := range c.files(o) {
+		if _, err := fmt.Fprintf(w, "TN:\nSF:%s\n", f.Name); err != nil {
+			return err
+		}
+		var linesHit, branches, branchesHit int
+		for _, l := range f.Lines {
+			for i, b := range l.Branches {
+				taken, notTaken := "-", "-"
+				if l.Executed {
+					taken, notTaken = fmt.Sprint(b.Taken), fmt.Sprint(b.NotTaken)
+				}
+				fmt.Fprintf(w, "BRDA:%d,%d,0,%s\nBRDA:%d,%d,1,%s\n", l.Line, i, taken, l.Line, i, notTaken)
+				branches += 2
+				branchesHit += countNonZero(b.Taken, b.NotTaken)
+			}
+			fmt.Fprintf(w, "DA:%d,%d\n", l.Line, l.Hits)
+			if l.Executed {
+				linesHit++
+			}
+		}
+		_, err := fmt.Fprintf(w, "BRF:%d\nBRH:%d\nLF:%d\nLH:%d\nend_of_record\n",
+			branches, branchesHit, len(f.Lines), linesHit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countNonZero(values ...uint64) int {
+	n := 0
+	for _, v := range values {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
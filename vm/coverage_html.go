@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LC-3 coverage</title>
+<style>
+body { font-family: sans-serif; }
+table.source { border-collapse: collapse; font-family: monospace; }
+table.source td { padding: 0 8px; white-space: pre; }
+td.num { text-align: right; color: #888; }
+tr.hit { background: #d4f7d4; }
+tr.miss { background: #f7d4d4; }
+tr.partial { background: #f7f0c4; }
+</style>
+</head>
+<body>
+<h1>LC-3 coverage</h1>
+<table>
+<tr><th>File</th><th>Lines</th><th>Branches</th></tr>
+{{range .}}<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Lines}}</td><td>{{.Branches}}</td></tr>
+{{end}}</table>
+{{range .}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<table class="source">
+{{range .Rows}}<tr class="{{.Class}}"><td class="num">{{.Line}}</td><td class="num">{{.Hits}}</td><td>{{.Branches}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+type coverageHTMLFile struct {
+	Name     string
+	Lines    string
+	Branches string
+	Rows     []coverageHTMLRow
+}
+
+type coverageHTMLRow struct {
+	Line     int
+	Hits     string
+	Class    string
+	Branches string
+	Text     string
+}
+
+// WriteHTML writes a self-contained HTML coverage report. With a source map the source
+// files are read from disk, lines of files which can't be read are shown without text.
+func (c *Coverage) WriteHTML(w io.Writer, o CoverageOptions) error {
+	var files []coverageHTMLFile
+	for _, f := range c.files(o) {
+		var text []string
+		if o.Source != nil {
+			if b, err := ioutil.ReadFile(f.Name); err == nil {
+				text = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+			}
+		}
+		files = append(files, c.htmlFile(f, text))
+	}
+	return coverageTemplate.Execute(w, files)
+}
+
+// htmlFile renders the source lines of f, without text only the covered lines are shown.
+func (c *Coverage) htmlFile(f *coverageFile, text []string) coverageHTMLFile {
+	var linesHit, branches, branchesHit int
+	byLine := map[int]*coverageLine{}
+	for _, l := range f.Lines {
+		byLine[l.Line] = l
+		if l.Executed {
+			linesHit++
+		}
+		for _, b := range l.Branches {
+			branches += 2
+			branchesHit += countNonZero(b.Taken, b.NotTaken)
+		}
+	}
+
+	result := coverageHTMLFile{
+		Name:     f.Name,
+		Lines:    fmt.Sprintf("%d/%d", linesHit, len(f.Lines)),
+		Branches: fmt.Sprintf("%d/%d", branchesHit, branches),
+	}
+	row := func(n int, l *coverageLine, text string) {
+		r := coverageHTMLRow{Line: n, Text: text}
+		if l != nil {
+			r.Hits = fmt.Sprint(l.Hits)
+			r.Class = "miss"
+			if l.Executed {
+				r.Class = "hit"
+				if l.Partially {
+					r.Class = "partial"
+				}
+			}
+			for _, b := range l.Branches {
+				r.Branches += fmt.Sprintf("[%d taken, %d not taken] ", b.Taken, b.NotTaken)
+			}
+		}
+		result.Rows = append(result.Rows, r)
+	}
+
+	if text == nil {
+		for _, l := range f.Lines {
+			row(l.Line, l, fmt.Sprintf("x%04X: x%04X", l.Address, c.ram.Storage[l.Address]))
+		}
+		return result
+	}
+	// Source files may be shorter than the source map says when they changed after assembling
+	last := len(text)
+	if n := len(f.Lines); n > 0 && f.Lines[n-1].Line > last {
+		last = f.Lines[n-1].Line
+	}
+	for n := 1; n <= last; n++ {
+		var t string
+		if n <= len(text) {
+			t = text[n-1]
+		}
+		row(n, byLine[n], t)
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lineMap maps addresses to lines of a single file.
+type lineMap struct {
+	file  string
+	lines map[uint16]int
+}
+
+func (m lineMap) Source(address uint16) (string, int, bool) {
+	line, ok := m.lines[address]
+	return m.file, line, ok
+}
+
+func TestLC3CPU_StartCoverage(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	loadMultiplyProgram(vm)
+
+	c := vm.StartCoverage()
+	vm.Run()
+	vm.StopCoverage()
+
+	assert.Equal(t, uint64(4), c.Hits[0x3006])
+	assert.Equal(t, uint64(0), c.Hits[0x3005])
+	assert.Equal(t, map[uint16]*BranchCoverage{0x3008: {Taken: 2, NotTaken: 2}}, c.Branches)
+
+	var lcov bytes.Buffer
+	assert.Nil(t, c.WriteLcov(&lcov, CoverageOptions{Name: "mul.obj", Start: 0x3000, Size: 10}))
+	assert.Equal(t, `TN:
+SF:mul.obj
+DA:1,1
+DA:2,1
+DA:3,1
+DA:4,1
+DA:5,1
+DA:6,0
+DA:7,4
+DA:8,4
+BRDA:9,0,0,2
+BRDA:9,0,1,2
+DA:9,4
+DA:10,2
+BRF:2
+BRH:2
+LF:10
+LH:9
+end_of_record
+`, lcov.String())
+}
+
+func TestCoverage_WriteHTML(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	loadMultiplyProgram(vm)
+	// Skip the multiplication, so that the subroutine is never executed
+	vm.RAM.Write(0x3002, 0b0000_010_000000000) // BRz #0
+	vm.RAM.Write(0x3003, 0b0000_111_000000000) // BRnzp #0
+
+	c := vm.StartCoverage()
+	vm.Run()
+
+	source := filepath.Join(t.TempDir(), "mul.asm")
+	assert.Nil(t, ioutil.WriteFile(source, []byte("; multiply\nAND R0, R0, #0\nBRz SKIP\nSKIP HALT\n"), 0600))
+	o := CoverageOptions{
+		Start:  0x3000,
+		Size:   10,
+		Source: lineMap{file: source, lines: map[uint16]int{0x3000: 2, 0x3002: 3, 0x3004: 4, 0x3008: 5}},
+	}
+
+	var html bytes.Buffer
+	assert.Nil(t, c.WriteHTML(&html, o))
+	assert.Contains(t, html.String(), `<td>; multiply</td>`)
+	assert.Contains(t, html.String(), `<tr class="partial"><td class="num">3</td><td class="num">1</td>`+
+		`<td>[0 taken, 1 not taken] </td><td>BRz SKIP</td></tr>`)
+	assert.Contains(t, html.String(), `<tr class="miss"><td class="num">5</td><td class="num">0</td>`+
+		`<td>[0 taken, 0 not taken] </td><td></td></tr>`)
+	assert.Contains(t, html.String(), `<td>3/4</td><td>1/4</td>`)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync/atomic"
+	"time"
 )
 
 // Registers
@@ -57,6 +59,19 @@ type LC3CPU struct {
 	currentInstruction uint16
 	currentOperation   uint16
 	isRunning          bool
+	stopRequested      int32  // set by Stop, possibly from another goroutine
+	instructions       uint64 // number of executed instructions including the current one
+	limit              uint64 // instructions after which Resume stops, 0 is unlimited
+	halted             bool
+	quiet              bool  // HALT doesn't print its message
+	outputErr          error // stopped the CPU with StopOutputError
+	hooks              hookList
+	profile            *Profile
+	coverage           *Coverage
+	stats              *Stats
+	engine             Engine
+	decodeCache        *[MaxMemorySize]cachedInstruction
+	code               *codeCache
 	StartPosition      uint16
 	output             io.Writer
 }
@@ -70,81 +85,165 @@ func NewCPU(ram *LC3RAM, output io.Writer) *LC3CPU {
 	}
 }
 
-// Reset resets CPU to initial state.
+// Reset resets CPU to initial state. Memory is cleared, the devices of the RAM are kept.
 func (v *LC3CPU) Reset() {
 	v.registers = [R_COUNT]uint16{}
-	v.RAM = &LC3RAM{
-		CheckKey: CheckKeyPressed,
-		GetChar:  GetCharFromStdin,
-	}
+	v.RAM.Storage = [MaxMemorySize]uint16{}
 	v.currentInstruction = 0
 	v.currentOperation = 0
+	v.instructions = 0
 	v.isRunning = false
+	v.halted = false
+	v.outputErr = nil
+	atomic.StoreInt32(&v.stopRequested, 0)
+	v.SetEngine(v.engine)
 }
 
 // Run runs CPU.
-func (v *LC3CPU) Run() {
+func (v *LC3CPU) Run() RunResult {
 	// Set the PC to starting position
 	// 0x3000 is the default
 	v.registers[R_PC] = v.StartPosition
+	// Condition codes always hold exactly one of N, Z or P
+	v.registers[R_COND] = FL_ZRO
+	return v.Resume()
+}
+
+// Resume continues execution from the current PC without resetting any state.
+func (v *LC3CPU) Resume() RunResult {
+	start, executed := time.Now(), v.instructions
+	if v.stats != nil {
+		v.stats.reset()
+	}
+	result := RunResult{Reason: StopHalt, Engine: v.engine}
+	if v.hooks != nil {
+		result.Engine = EngineInterpreter
+	}
+
 	v.isRunning = true
+	v.halted = false
 	for v.isRunning {
-		// Fetch
-		v.currentInstruction = v.RAM.Read(v.registers[R_PC])
-		if v.registers[R_PC] < MaxMemorySize {
-			v.registers[R_PC]++
+		if atomic.LoadInt32(&v.stopRequested) != 0 {
+			atomic.StoreInt32(&v.stopRequested, 0)
+			v.isRunning = false
+			result.Reason = StopRequested
+			break
 		}
-		v.currentOperation = v.currentInstruction >> 12
-
-		switch v.currentOperation {
-		case OP_ADD:
-			v.add()
-		case OP_AND:
-			v.and()
-		case OP_NOT:
-			v.not()
-		case OP_BR:
-			v.branch()
-		case OP_JMP:
-			v.jump()
-		case OP_JSR:
-			v.jumpRegister()
-		case OP_LD:
-			v.load()
-		case OP_LDI:
-			v.ldi()
-		case OP_LDR:
-			v.loadRegister()
-		case OP_LEA:
-			v.loadEffectiveAddress()
-		case OP_ST:
-			v.store()
-		case OP_STI:
-			v.storeIndirect()
-		case OP_STR:
-			v.storeRegister()
-		case OP_TRAP:
-			switch v.currentInstruction & 0xFF {
-			case TRAP_GETC:
-				v.trapGetc()
-			case TRAP_OUT:
-				v.trapOut()
-			case TRAP_PUTS:
-				v.trapPuts()
-			case TRAP_IN:
-				v.trapIn()
-			case TRAP_PUTSP:
-				v.trapPutsp()
-			case TRAP_HALT:
-				v.trapHalt()
-			}
-		case OP_RES:
-		case OP_RTI:
-		default:
-			log.Printf("BAD OPCODE: %016b\n", v.currentOperation)
+		if v.limitReached() {
 			v.isRunning = false
+			result.Reason = StopInstructionLimit
+			break
+		}
+		switch {
+		case v.code != nil:
+			v.runBlock()
+		case v.decodeCache != nil:
+			v.runCached()
+		default:
+			v.step()
 		}
 	}
+
+	if v.outputErr != nil {
+		result.Reason, result.Err = StopOutputError, v.outputErr
+		v.outputErr = nil
+	}
+	result.PC = v.registers[R_PC]
+	result.Instructions = v.instructions - executed
+	result.Duration = time.Since(start)
+	if v.stats != nil {
+		stats := *v.stats
+		result.Stats = &stats
+	}
+	return result
+}
+
+// Stop asks a running CPU to stop before the next instruction. It is safe to call from another goroutine.
+func (v *LC3CPU) Stop() {
+	atomic.StoreInt32(&v.stopRequested, 1)
+}
+
+// SetInstructionLimit stops Resume once n instructions were executed in total, 0 removes the limit.
+func (v *LC3CPU) SetInstructionLimit(n uint64) {
+	v.limit = n
+}
+
+func (v *LC3CPU) limitReached() bool {
+	return v.limit != 0 && v.instructions >= v.limit
+}
+
+// SetQuiet suppresses the "HALT" line the HALT trap prints.
+func (v *LC3CPU) SetQuiet(quiet bool) {
+	v.quiet = quiet
+}
+
+// Instructions returns the number of instructions executed since the last Reset.
+func (v *LC3CPU) Instructions() uint64 {
+	return v.instructions
+}
+
+// Halted reports whether the program stopped with the HALT trap.
+func (v *LC3CPU) Halted() bool {
+	return v.halted
+}
+
+// step fetches, decodes and executes a single instruction.
+func (v *LC3CPU) step() {
+	// Fetch
+	pc := v.registers[R_PC]
+	v.currentInstruction = v.RAM.fetch(pc)
+	// PC wraps around to x0000 after xFFFF
+	v.registers[R_PC]++
+	v.currentOperation = v.currentInstruction >> 12
+	v.instructions++
+	if v.hooks != nil {
+		v.hooks.beforeInstruction(pc, v.currentInstruction)
+	}
+
+	v.execute()
+
+	if v.hooks != nil {
+		v.hooks.afterInstruction(pc, v.currentInstruction)
+	}
+}
+
+// execute decodes and executes the current instruction.
+func (v *LC3CPU) execute() {
+	switch v.currentOperation {
+	case OP_ADD:
+		v.add()
+	case OP_AND:
+		v.and()
+	case OP_NOT:
+		v.not()
+	case OP_BR:
+		v.branch()
+	case OP_JMP:
+		v.jump()
+	case OP_JSR:
+		v.jumpRegister()
+	case OP_LD:
+		v.load()
+	case OP_LDI:
+		v.ldi()
+	case OP_LDR:
+		v.loadRegister()
+	case OP_LEA:
+		v.loadEffectiveAddress()
+	case OP_ST:
+		v.store()
+	case OP_STI:
+		v.storeIndirect()
+	case OP_STR:
+		v.storeRegister()
+	case OP_TRAP:
+		v.trap()
+	case OP_RES:
+	case OP_RTI:
+	default:
+		log.Printf("BAD OPCODE at %s: %016b\n", v.Location(v.registers[R_PC]-1), v.currentOperation)
+		v.isRunning = false
+	}
 }
 
 func (v *LC3CPU) updateFlags(r uint16) {
@@ -220,11 +319,14 @@ func (v *LC3CPU) jumpRegister() {
 	longPcOffset := signExtend(v.currentInstruction&0x7ff, 11)
 	longFlag := (v.currentInstruction >> 11) & 1
 
+	// BaseR has to be read before R7 is overwritten, otherwise JSRR R7 jumps to itself
+	target := v.registers[r1]
+
 	v.registers[R_R7] = v.registers[R_PC]
 	if longFlag == 1 {
 		v.registers[R_PC] += longPcOffset /* JSR */
 	} else {
-		v.registers[R_PC] = v.registers[r1] /* JSRR */
+		v.registers[R_PC] = target /* JSRR */
 	}
 }
 
@@ -288,36 +390,60 @@ const (
 	TRAP_HALT  = 0x25 // halt the program
 )
 
+func (v *LC3CPU) trap() {
+	// TRAP saves the return address in R7 like the trap service routines of the real machine
+	v.registers[R_R7] = v.registers[R_PC]
+
+	vector := v.currentInstruction & 0xFF
+	if v.hooks != nil {
+		v.hooks.trapEnter(vector)
+	}
+
+	switch vector {
+	case TRAP_GETC:
+		v.trapGetc()
+	case TRAP_OUT:
+		v.trapOut()
+	case TRAP_PUTS:
+		v.trapPuts()
+	case TRAP_IN:
+		v.trapIn()
+	case TRAP_PUTSP:
+		v.trapPutsp()
+	case TRAP_HALT:
+		v.trapHalt()
+	}
+
+	if v.hooks != nil {
+		v.hooks.trapExit(vector)
+	}
+}
+
 func (v *LC3CPU) trapGetc() {
 	// read a single ASCII char
 	v.registers[R_R0] = v.RAM.GetChar()
 }
 
 func (v *LC3CPU) trapOut() {
-	if _, err := fmt.Fprintf(v.output, "%c", v.registers[R_R0]); err != nil {
-		log.Fatalf("Can't write to device: %#v", v.output)
-	}
+	v.write("%c", v.registers[R_R0])
 }
 
 func (v *LC3CPU) trapPuts() {
-	for i := v.registers[R_R0]; v.RAM.Storage[i] != 0x0000; i++ {
-		if _, err := fmt.Fprintf(v.output, "%c", v.RAM.Storage[i]); err != nil {
-			log.Fatalf("Can't write to device: %#v", v.output)
+	for i := v.registers[R_R0]; ; i++ {
+		c := v.RAM.Read(i)
+		if c == 0x0000 || !v.write("%c", c) {
+			break
 		}
 	}
 }
 
 func (v *LC3CPU) trapIn() {
-	if _, err := fmt.Fprintf(v.output, "Input a character: "); err != nil {
-		log.Fatalf("Can't write to device: %#v", v.output)
+	if !v.write("Input a character: ") {
+		return
 	}
 
 	c := v.RAM.GetChar()
-
-	if _, err := fmt.Fprintf(v.output, "%c", c); err != nil {
-		log.Fatalf("Can't write to device: %#v", v.output)
-	}
-
+	v.write("%c", c)
 	v.registers[R_R0] = c
 }
 
@@ -325,21 +451,38 @@ func (v *LC3CPU) trapPutsp() {
 	// one char per byte (two bytes per word)
 	// here we need to swap back to
 	// big endian format
-	for i := v.registers[R_R0]; v.RAM.Storage[i] > 0; i++ {
-		ch1 := v.RAM.Storage[i] & 0xFF
-		fmt.Fprintf(v.output, "%c", ch1)
-		ch2 := v.RAM.Storage[i] >> 8
-		if ch2 > 0 {
-			fmt.Fprintf(v.output, "%c", ch2)
+	for i := v.registers[R_R0]; ; i++ {
+		c := v.RAM.Read(i)
+		if c == 0x0000 || !v.write("%c", c&0xFF) {
+			break
+		}
+		ch2 := c >> 8
+		if ch2 > 0 && !v.write("%c", ch2) {
+			break
 		}
 	}
 }
 
 func (v *LC3CPU) trapHalt() {
-	if _, err := fmt.Fprintln(v.output, "HALT"); err != nil {
-		log.Fatalf("Can't write to device: %#v", v.output)
+	if !v.quiet {
+		v.write("HALT\n")
 	}
 	v.isRunning = false
+	v.halted = true
+	if v.hooks != nil {
+		v.hooks.halt()
+	}
+}
+
+// write prints the output of a trap. An error stops the CPU with StopOutputError, write
+// reports whether the output was written.
+func (v *LC3CPU) write(format string, a ...interface{}) bool {
+	if _, err := fmt.Fprintf(v.output, format, a...); err != nil {
+		v.outputErr = err
+		v.isRunning = false
+		return false
+	}
+	return true
 }
 
 func signExtend(x uint16, bitCount int) uint16 {
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"testing"
 
@@ -426,12 +427,98 @@ func TestLC3CPU_trapHalt(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "HALT\n", l)
 	assert.False(t, vm.isRunning)
+	assert.True(t, vm.Halted())
 
 	vm.Reset()
 
 	vm.output = nil
 }
 
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("device full")
+}
+
+func TestLC3CPU_outputError(t *testing.T) {
+	for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+		vm := NewCPU(&LC3RAM{
+			CheckKey: KeyPressedMock(false),
+			GetChar:  GetTestChar,
+		}, failingWriter{})
+		vm.SetEngine(engine)
+		vm.RAM.Write(0x3000, 0b0001_000_000_1_00001) // ADD R0, R0, #1
+		vm.RAM.Write(0x3001, 0xF021)                 // OUT
+		vm.RAM.Write(0x3002, 0xF025)                 // HALT
+
+		result := vm.Run()
+		assert.Equal(t, StopOutputError, result.Reason, "%v", engine)
+		assert.EqualError(t, result.Err, "device full", "%v", engine)
+		assert.Equal(t, uint16(0x3002), result.PC, "%v", engine)
+		assert.Equal(t, uint64(2), result.Instructions, "%v", engine)
+		assert.False(t, vm.Halted(), "%v", engine)
+
+		// The error is reported once, resuming continues after the failed trap
+		vm.SetQuiet(true)
+		result = vm.Resume()
+		assert.Equal(t, StopHalt, result.Reason, "%v", engine)
+		assert.Nil(t, result.Err, "%v", engine)
+	}
+}
+
+func TestLC3CPU_SetQuiet(t *testing.T) {
+	var out bytes.Buffer
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	vm.SetQuiet(true)
+	vm.trapHalt()
+
+	assert.Empty(t, out.String())
+	assert.True(t, vm.Halted())
+}
+
+func TestLC3CPU_Reset(t *testing.T) {
+	keyboard := NewKeyboard([]byte("a"))
+	vm := NewCPU(&LC3RAM{
+		CheckKey: keyboard.CheckKey,
+		GetChar:  keyboard.GetChar,
+	}, &bytes.Buffer{})
+	vm.RAM.Write(0x3000, 0xF020) // GETC
+	vm.RAM.Write(0x3001, 0xF025) // HALT
+	vm.Run()
+	assert.Equal(t, uint16('a'), vm.registers[R_R0])
+
+	ram := vm.RAM
+	vm.Reset()
+	// The CPU keeps its own devices instead of switching to the terminal
+	assert.Same(t, ram, vm.RAM)
+	assert.Equal(t, [MaxMemorySize]uint16{}, vm.RAM.Storage)
+	assert.Equal(t, [R_COUNT]uint16{}, vm.registers)
+	assert.False(t, vm.Halted())
+	assert.Zero(t, vm.Instructions())
+}
+
+func TestLC3CPU_SetInstructionLimit(t *testing.T) {
+	for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+		vm := NewCPU(&LC3RAM{
+			CheckKey: KeyPressedMock(false),
+			GetChar:  GetTestChar,
+		}, &bytes.Buffer{})
+		vm.SetEngine(engine)
+		vm.RAM.Write(0x3000, 0b0001_000_000_1_00001) // ADD R0, R0, #1
+		vm.RAM.Write(0x3001, 0b0000_111_111111110)   // BRnzp x3000
+		vm.SetInstructionLimit(11)
+		vm.Run()
+
+		assert.Equal(t, uint64(11), vm.Instructions(), "%v", engine)
+		assert.Equal(t, uint16(6), vm.registers[R_R0], "%v", engine)
+		assert.False(t, vm.Halted(), "%v", engine)
+	}
+}
+
 func Test_signExtend(t *testing.T) {
 	assert.Equal(t, uint16(0b1111_1111_1111_1111), signExtend(0b11111, 5))
 	assert.Equal(t, uint16(0b0000_0000_0000_1111), signExtend(0b01111, 5))
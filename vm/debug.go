@@ -0,0 +1,167 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DebugInfoVersion is the version of the debug information format written by WriteJSON.
+const DebugInfoVersion = 1
+
+// ErrDebugInfoVersion is returned for debug information of an unsupported version.
+var ErrDebugInfoVersion = errors.New("unsupported debug information version")
+
+// DebugInfo maps the addresses of a program to the source it was assembled from. It is
+// stored as JSON in a sidecar file next to the object file, see DebugInfoPath.
+type DebugInfo struct {
+	Version int           `json:"version"`
+	Object  uint32        `json:"object_crc32"` // CRC-32 of the object file the information belongs to
+	Files   []string      `json:"files"`
+	Lines   []DebugLine   `json:"lines"` // ordered by address
+	Labels  []DebugLabel  `json:"labels"`
+	Data    []DebugRegion `json:"data"` // words which hold data instead of instructions
+}
+
+// DebugLine is a statement which was assembled into Size words starting at Address.
+type DebugLine struct {
+	Address uint16 `json:"address"`
+	Size    int    `json:"size"`
+	File    int    `json:"file"` // index in DebugInfo.Files
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Text    string `json:"text"` // the statement without label and comment
+}
+
+// DebugLabel is the address of a label.
+type DebugLabel struct {
+	Name    string `json:"name"`
+	Address uint16 `json:"address"`
+}
+
+// DebugRegion is a block of data words, Kind is the directive which reserved it.
+type DebugRegion struct {
+	Address uint16 `json:"address"`
+	Size    int    `json:"size"`
+	Kind    string `json:"kind"`
+}
+
+// DebugInfoPath returns the path of the debug information of an object file, prog.obj has prog.dbg.
+func DebugInfoPath(program string) string {
+	return strings.TrimSuffix(program, filepath.Ext(program)) + ".dbg"
+}
+
+// ReadDebugInfo decodes debug information written by WriteJSON.
+func ReadDebugInfo(r io.Reader) (*DebugInfo, error) {
+	var d DebugInfo
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, err
+	}
+	if d.Version != DebugInfoVersion {
+		return nil, ErrDebugInfoVersion
+	}
+	for _, l := range d.Lines {
+		if l.File < 0 || l.File >= len(d.Files) {
+			return nil, fmt.Errorf("line %d at x%04X refers to unknown file %d", l.Line, l.Address, l.File)
+		}
+	}
+	sort.SliceStable(d.Lines, func(i, j int) bool { return d.Lines[i].Address < d.Lines[j].Address })
+	return &d, nil
+}
+
+// WriteJSON encodes the debug information.
+func (d *DebugInfo) WriteJSON(w io.Writer) error {
+	d.Version = DebugInfoVersion
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	return e.Encode(d)
+}
+
+// Line returns the statement which occupies address.
+func (d *DebugInfo) Line(address uint16) (DebugLine, bool) {
+	// The last line starting at or before address
+	i := sort.Search(len(d.Lines), func(i int) bool { return d.Lines[i].Address > address }) - 1
+	if i < 0 || int(address) >= int(d.Lines[i].Address)+d.Lines[i].Size {
+		return DebugLine{}, false
+	}
+	return d.Lines[i], true
+}
+
+// IsData reports whether address belongs to a data region.
+func (d *DebugInfo) IsData(address uint16) bool {
+	for _, r := range d.Data {
+		if address >= r.Address && int(address) < int(r.Address)+r.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// Source implements SourceMap, data words have no source.
+func (d *DebugInfo) Source(address uint16) (string, int, bool) {
+	l, ok := d.Line(address)
+	if !ok || d.IsData(address) {
+		return "", 0, false
+	}
+	return d.Files[l.File], l.Line, true
+}
+
+// Label returns the name of the label at address.
+func (d *DebugInfo) Label(address uint16) (string, bool) {
+	for _, l := range d.Labels {
+		if l.Address == address {
+			return l.Name, true
+		}
+	}
+	return "", false
+}
+
+// Location describes address as "prog.asm:42: ADD R1, R1, #-1", addresses without a
+// statement are formatted as hex.
+func (d *DebugInfo) Location(address uint16) string {
+	if d != nil {
+		if l, ok := d.Line(address); ok {
+			return fmt.Sprintf("%s:%d: %s", d.Files[l.File], l.Line, l.Text)
+		}
+	}
+	return fmt.Sprintf("x%04X", address)
+}
+
+// LoadDebugInfo reads the debug information of the object file at path. It returns nil
+// when there is none or when it belongs to another version of the object file.
+func LoadDebugInfo(path string, object []byte) (*DebugInfo, error) {
+	f, err := os.Open(DebugInfoPath(path)) //nolint: gosec
+	return readDebugInfoFile(f, err, object)
+}
+
+// LoadDebugInfoFS is LoadDebugInfo for an object file of a file system.
+func LoadDebugInfoFS(fsys fs.FS, name string, object []byte) (*DebugInfo, error) {
+	f, err := fsys.Open(DebugInfoPath(name))
+	return readDebugInfoFile(f, err, object)
+}
+
+func readDebugInfoFile(f io.ReadCloser, err error, object []byte) (*DebugInfo, error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, err := ReadDebugInfo(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't read debug information: %w", err)
+	}
+	if d.Object != crc32.ChecksumIEEE(object) {
+		return nil, nil
+	}
+	return d, nil
+}
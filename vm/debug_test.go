@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDebugInfo = DebugInfo{
+	Files: []string{"prog.asm", "lib.asm"},
+	Lines: []DebugLine{
+		{Address: 0x3000, Size: 1, File: 0, Line: 2, Column: 9, Text: "LEA R0, MSG"},
+		{Address: 0x3001, Size: 1, File: 1, Line: 7, Column: 9, Text: "PUTS"},
+		{Address: 0x3002, Size: 4, File: 0, Line: 4, Column: 5, Text: `.STRINGZ "abc"`},
+	},
+	Labels: []DebugLabel{{Name: "MSG", Address: 0x3002}},
+	Data:   []DebugRegion{{Address: 0x3002, Size: 4, Kind: ".STRINGZ"}},
+}
+
+func TestDebugInfo_Location(t *testing.T) {
+	d := testDebugInfo
+	assert.Equal(t, "prog.asm:2: LEA R0, MSG", d.Location(0x3000))
+	assert.Equal(t, "lib.asm:7: PUTS", d.Location(0x3001))
+	assert.Equal(t, `prog.asm:4: .STRINGZ "abc"`, d.Location(0x3005))
+	assert.Equal(t, "x3006", d.Location(0x3006))
+	assert.Equal(t, "x2FFF", d.Location(0x2FFF))
+	assert.Equal(t, "x3000", (*DebugInfo)(nil).Location(0x3000))
+
+	file, line, ok := d.Source(0x3001)
+	assert.True(t, ok)
+	assert.Equal(t, "lib.asm", file)
+	assert.Equal(t, 7, line)
+	_, _, ok = d.Source(0x3003)
+	assert.False(t, ok)
+
+	label, ok := d.Label(0x3002)
+	assert.True(t, ok)
+	assert.Equal(t, "MSG", label)
+}
+
+func TestReadDebugInfo(t *testing.T) {
+	var buf bytes.Buffer
+	d := testDebugInfo
+	assert.Nil(t, d.WriteJSON(&buf))
+	read, err := ReadDebugInfo(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, &d, read)
+
+	_, err = ReadDebugInfo(bytes.NewReader([]byte(`{"version": 2}`)))
+	assert.Equal(t, ErrDebugInfoVersion, err)
+	_, err = ReadDebugInfo(bytes.NewReader([]byte(`{"version": 1, "lines": [{"file": 1}]}`)))
+	assert.EqualError(t, err, "line 0 at x0000 refers to unknown file 1")
+}
+
+func TestLC3RAM_Load_debugInfo(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "prog.obj")
+	object := []byte{0x30, 0x00, 0xE0, 0x01, 0xF0, 0x22}
+	assert.Nil(t, ioutil.WriteFile(program, object, 0o600))
+
+	var out bytes.Buffer
+	cpu := NewCPU(&LC3RAM{CheckKey: KeyPressedMock(false), GetChar: GetTestChar}, &out)
+	assert.Nil(t, cpu.RAM.Load(program))
+	assert.Nil(t, cpu.RAM.Debug)
+	assert.Equal(t, "x3001", cpu.Location(0x3001))
+
+	// Debug information of another version of the program is ignored
+	d := testDebugInfo
+	var buf bytes.Buffer
+	assert.Nil(t, d.WriteJSON(&buf))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "prog.dbg"), buf.Bytes(), 0o600))
+	assert.Nil(t, cpu.RAM.Load(program))
+	assert.Nil(t, cpu.RAM.Debug)
+
+	d.Object = crc32.ChecksumIEEE(object)
+	buf.Reset()
+	assert.Nil(t, d.WriteJSON(&buf))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "prog.dbg"), buf.Bytes(), 0o600))
+	assert.Nil(t, cpu.RAM.Load(program))
+	assert.Equal(t, "lib.asm:7: PUTS", cpu.Location(0x3001))
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "prog.dbg"), []byte("{"), 0o600))
+	assert.NotNil(t, cpu.RAM.Load(program))
+}
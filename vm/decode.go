@@ -0,0 +1,162 @@
+package vm
+
+// decodedInstruction holds the fields of an instruction word, so that they are extracted only once.
+type decodedInstruction struct {
+	op     uint16
+	r0     uint16 // DR, or SR of the stores
+	r1     uint16 // SR1 or BaseR
+	r2     uint16 // SR2
+	imm    bool   // immediate mode of ADD and AND, PC relative mode of JSR
+	offset uint16 // sign extended imm5, offset6, PCoffset9 or PCoffset11
+	nzp    uint16 // condition flags of BR
+}
+
+// decode extracts all fields of an instruction word.
+func decode(instr uint16) decodedInstruction {
+	d := decodedInstruction{
+		op:  instr >> 12,
+		r0:  (instr >> 9) & 0x7,
+		r1:  (instr >> 6) & 0x7,
+		r2:  instr & 0x7,
+		nzp: (instr >> 9) & 0x7,
+	}
+
+	switch d.op {
+	case OP_ADD, OP_AND:
+		d.imm = (instr>>5)&0x1 == 0x1
+		d.offset = signExtend(instr&0x1F, 5)
+	case OP_LDR, OP_STR:
+		d.offset = signExtend(instr&0x3F, 6)
+	case OP_JSR:
+		d.imm = (instr>>11)&0x1 == 0x1
+		d.offset = signExtend(instr&0x7FF, 11)
+	case OP_BR, OP_LD, OP_LDI, OP_LEA, OP_ST, OP_STI:
+		d.offset = signExtend(instr&0x1FF, 9)
+	}
+	return d
+}
+
+// Instruction is an instruction word decoded by the rules of the CPU.
+type Instruction struct {
+	Word   uint16
+	Op     uint16
+	R0     uint16 // DR, or SR of the stores
+	R1     uint16 // SR1 or BaseR
+	R2     uint16 // SR2
+	Imm    bool   // immediate mode of ADD and AND, PC relative mode of JSR
+	Offset uint16 // sign extended imm5, offset6, PCoffset9 or PCoffset11
+	NZP    uint16 // condition flags of BR
+}
+
+// Decode decodes an instruction word the way the CPU executes it.
+func Decode(word uint16) Instruction {
+	d := decode(word)
+	return Instruction{Word: word, Op: d.op, R0: d.r0, R1: d.r1, R2: d.r2, Imm: d.imm, Offset: d.offset, NZP: d.nzp}
+}
+
+// TrapVector returns the vector of a TRAP instruction.
+func (i Instruction) TrapVector() uint16 {
+	return i.Word & 0xFF
+}
+
+// cachedImm marks the immediate forms of ADD and AND and the PC relative form of JSR
+// in the opcode of a cache entry, so that a single switch selects the operation.
+const cachedImm = 0x10
+
+// cachedInstruction is a decode cache entry. The zero value is the decoded word x0000.
+type cachedInstruction struct {
+	word       uint16 // the word the entry was decoded from
+	offset     uint16
+	op         uint16 // opcode, or'ed with cachedImm
+	r0, r1, r2 uint8  // r0 holds the condition flags of BR
+}
+
+func cacheEntry(word uint16) cachedInstruction {
+	d := decode(word)
+	e := cachedInstruction{word: word, offset: d.offset, op: d.op, r0: uint8(d.r0), r1: uint8(d.r1), r2: uint8(d.r2)}
+	if d.imm {
+		e.op |= cachedImm
+	}
+	return e
+}
+
+// cachedBatch is the number of instructions runCached executes between the checks of
+// stop requests.
+const cachedBatch = 256
+
+// runCached executes instructions from the decode cache. It returns to Resume after a
+// batch, a trap or an instruction which has to be executed by step: instructions fetched
+// from memory mapped devices and all instructions of a CPU with hooks.
+func (v *LC3CPU) runCached() {
+	n := uint64(cachedBatch)
+	if v.limit != 0 && v.limit-v.instructions < n {
+		n = v.limit - v.instructions
+	}
+	r, mem, cache := &v.registers, &v.RAM.Storage, v.decodeCache
+
+	for ; n > 0; n-- {
+		pc := r[R_PC]
+		if pc >= MR_KBSR || v.hooks != nil {
+			v.step()
+			return
+		}
+		// Comparing the word finds entries made stale by any write, also to Storage
+		e := &cache[pc]
+		if e.word != mem[pc] {
+			*e = cacheEntry(mem[pc])
+		}
+		r[R_PC] = pc + 1
+		v.instructions++
+
+		switch e.op {
+		case OP_ADD:
+			r[e.r0] = r[e.r1] + r[e.r2]
+			v.updateFlags(uint16(e.r0))
+		case OP_ADD | cachedImm:
+			r[e.r0] = r[e.r1] + e.offset
+			v.updateFlags(uint16(e.r0))
+		case OP_AND:
+			r[e.r0] = r[e.r1] & r[e.r2]
+			v.updateFlags(uint16(e.r0))
+		case OP_AND | cachedImm:
+			r[e.r0] = r[e.r1] & e.offset
+			v.updateFlags(uint16(e.r0))
+		case OP_NOT:
+			r[e.r0] = ^r[e.r1]
+			v.updateFlags(uint16(e.r0))
+		case OP_BR:
+			if uint16(e.r0)&r[R_COND] != 0 {
+				r[R_PC] += e.offset
+			}
+		case OP_JMP:
+			r[R_PC] = r[e.r1]
+		case OP_JSR:
+			r[R_PC], r[R_R7] = r[e.r1], pc+1
+		case OP_JSR | cachedImm:
+			r[R_R7] = pc + 1
+			r[R_PC] += e.offset
+		case OP_LD:
+			r[e.r0] = v.RAM.Read(pc + 1 + e.offset)
+			v.updateFlags(uint16(e.r0))
+		case OP_LDI:
+			r[e.r0] = v.RAM.Read(v.RAM.Read(pc + 1 + e.offset))
+			v.updateFlags(uint16(e.r0))
+		case OP_LDR:
+			r[e.r0] = v.RAM.Read(r[e.r1] + e.offset)
+			v.updateFlags(uint16(e.r0))
+		case OP_LEA:
+			r[e.r0] = pc + 1 + e.offset
+			v.updateFlags(uint16(e.r0))
+		case OP_ST:
+			v.RAM.Write(pc+1+e.offset, r[e.r0])
+		case OP_STI:
+			v.RAM.Write(v.RAM.Read(pc+1+e.offset), r[e.r0])
+		case OP_STR:
+			v.RAM.Write(r[e.r1]+e.offset, r[e.r0])
+		case OP_TRAP:
+			v.currentInstruction, v.currentOperation = e.word, OP_TRAP
+			v.trap()
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLC3CPU_SetEngine_decodeCache(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	vm.SetEngine(EngineDecodeCache)
+
+	// The second iteration executes an instruction which was overwritten by the first one
+	vm.RAM.Write(0x3000, 0b0010_001_000000101)   // LD R1, x3006
+	vm.RAM.Write(0x3001, 0b0001_000_000_1_00001) // ADD R0, R0, #1
+	vm.RAM.Write(0x3002, 0b0011_001_111111110)   // ST R1, x3001
+	vm.RAM.Write(0x3003, 0b0001_010_010_1_11111) // ADD R2, R2, #-1
+	vm.RAM.Write(0x3004, 0b0000_001_111111100)   // BRp x3001
+	vm.RAM.Write(0x3005, 0xF025)                 // HALT
+	vm.RAM.Write(0x3006, 0b0001_000_000_1_00101) // ADD R0, R0, #5
+	vm.registers[R_R2] = 2
+	vm.Run()
+
+	assert.Equal(t, uint16(6), vm.registers[R_R0])
+
+	// Direct writes to the storage invalidate cached entries as well
+	vm.RAM.Storage[0x3001] = 0b0001_000_000_1_00010 // ADD R0, R0, #2
+	vm.registers[R_R0] = 0
+	vm.registers[R_R2] = 1
+	vm.registers[R_PC] = 0x3001
+	vm.Resume()
+
+	assert.Equal(t, uint16(2), vm.registers[R_R0])
+
+	vm.SetEngine(EngineInterpreter)
+	assert.Nil(t, vm.decodeCache)
+}
+
+func Test_decode(t *testing.T) {
+	d := decode(0b0001_011_100_1_10000) // ADD R3, R4, #-16
+	assert.Equal(t, OP_ADD, d.op)
+	assert.Equal(t, R_R3, d.r0)
+	assert.Equal(t, R_R4, d.r1)
+	assert.True(t, d.imm)
+	assert.Equal(t, uint16(0xFFF0), d.offset)
+
+	d = decode(0b0100_1_10000000000) // JSR #-1024
+	assert.True(t, d.imm)
+	assert.Equal(t, uint16(0xFC00), d.offset)
+
+	d = decode(0b0000_101_000000111) // BRnp #7
+	assert.Equal(t, FL_NEG|FL_POS, d.nzp)
+	assert.Equal(t, uint16(7), d.offset)
+}
+
+func TestDecode(t *testing.T) {
+	i := Decode(0b0001_011_100_1_10000) // ADD R3, R4, #-16
+	assert.Equal(t, uint16(0x1730), i.Word)
+	assert.Equal(t, OP_ADD, i.Op)
+	assert.Equal(t, R_R3, i.R0)
+	assert.Equal(t, R_R4, i.R1)
+	assert.True(t, i.Imm)
+	assert.Equal(t, uint16(0xFFF0), i.Offset)
+
+	assert.Equal(t, uint16(TRAP_PUTS), Decode(0xF022).TrapVector())
+}
+
+// benchmarkApp executes one instruction of an app per iteration, keys are pressed all
+// the time. The other engines execute a whole block or batch per iteration.
+func benchmarkApp(b *testing.B, path string, engine Engine) {
+	image, err := ioutil.ReadFile(path) //nolint: gosec
+	if err != nil {
+		b.Fatal(err)
+	}
+	keys := []byte("wasd")
+	pressed := 0
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(true),
+		GetChar: func() uint16 {
+			pressed++
+			return uint16(keys[pressed%len(keys)])
+		},
+	}, ioutil.Discard)
+	vm.SetEngine(engine)
+	if err := vm.RAM.LoadObject(image); err != nil {
+		b.Fatal(err)
+	}
+
+	start := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !vm.isRunning {
+			vm.registers[R_PC] = vm.StartPosition
+			vm.registers[R_COND] = FL_ZRO
+			vm.isRunning = true
+		}
+		switch engine {
+		case EngineThreaded:
+			vm.runBlock()
+		case EngineDecodeCache:
+			vm.runCached()
+		default:
+			vm.step()
+		}
+	}
+	b.ReportMetric(float64(vm.instructions)/time.Since(start).Seconds(), "instructions/s")
+}
+
+func BenchmarkLC3CPU_engines(b *testing.B) {
+	for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+		engine := engine
+		b.Run(engine.String(), func(b *testing.B) { benchmarkApp(b, "../apps/2048.obj", engine) })
+	}
+}
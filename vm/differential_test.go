@@ -0,0 +1,277 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// diffCase describes a single program executed by both LC3CPU and refMachine.
+type diffCase struct {
+	image []byte    // object image, origin word followed by data
+	regs  [8]uint16 // initial values of R0-R7
+	input []byte    // scripted key presses
+	steps int       // instruction budget
+	// engine executes the program on LC3CPU
+	engine Engine
+}
+
+// divergence is the first point where LC3CPU and refMachine disagree.
+type divergence struct {
+	step   int
+	pc     uint16
+	instr  uint16
+	reason string
+}
+
+func (d *divergence) String() string {
+	return fmt.Sprintf("step %d, x%04X: x%04X: %s", d.step, d.pc, d.instr, d.reason)
+}
+
+func (c diffCase) String() string {
+	var b strings.Builder
+	origin := binary.BigEndian.Uint16(c.image)
+	for i := 2; i+1 < len(c.image); i += 2 {
+		fmt.Fprintf(&b, "x%04X: x%04X\n", origin, binary.BigEndian.Uint16(c.image[i:]))
+		origin++
+	}
+	for r, v := range c.regs {
+		fmt.Fprintf(&b, "R%d=x%04X ", r, v)
+	}
+	fmt.Fprintf(&b, "input=%q engine=%v", c.input, c.engine)
+	return b.String()
+}
+
+// runDifferential executes c on both machines in lockstep and compares their state
+// after every instruction. The other engines are compared after every block or batch,
+// as they are executed at once. It returns nil when both traces are identical.
+func runDifferential(c diffCase) *divergence {
+	var out bytes.Buffer
+	cpuInput := &scriptedInput{data: c.input}
+	cpu := NewCPU(&LC3RAM{
+		CheckKey: cpuInput.ready,
+		GetChar:  cpuInput.next,
+	}, &out)
+	cpu.SetEngine(c.engine)
+	ref := newRefMachine(&scriptedInput{data: c.input})
+
+	origin := binary.BigEndian.Uint16(c.image)
+	for i := 2; i+1 < len(c.image); i += 2 {
+		cpu.RAM.Write(origin, binary.BigEndian.Uint16(c.image[i:]))
+		origin++
+	}
+	ref.load(c.image)
+
+	copy(cpu.registers[:R_PC], c.regs[:])
+	copy(ref.reg[:], c.regs[:])
+	cpu.registers[R_PC] = cpu.StartPosition
+	cpu.registers[R_COND] = FL_ZRO
+	cpu.isRunning = true
+
+	for step := 0; step < c.steps && cpu.isRunning; {
+		pc, instr := ref.pc, ref.mem[ref.pc]
+		cpuWritten, refWritten := out.Len(), ref.out.Len()
+
+		executed := cpu.instructions
+		switch c.engine {
+		case EngineThreaded:
+			cpu.runBlock()
+		case EngineDecodeCache:
+			cpu.runCached()
+		default:
+			cpu.step()
+		}
+		var written []int
+		for n := cpu.instructions - executed; n > 0; n-- {
+			ref.step()
+			if ref.lastWrite >= 0 {
+				written = append(written, ref.lastWrite)
+			}
+		}
+
+		reason := compareStep(cpu, ref, written, out.Bytes()[cpuWritten:], ref.out.Bytes()[refWritten:])
+		if reason != "" {
+			return &divergence{step: step, pc: pc, instr: instr, reason: reason}
+		}
+		step += int(cpu.instructions - executed)
+	}
+
+	for addr := range ref.mem {
+		if cpu.RAM.Storage[addr] != ref.mem[addr] {
+			return &divergence{step: c.steps, reason: fmt.Sprintf("memory x%04X: got x%04X, want x%04X",
+				addr, cpu.RAM.Storage[addr], ref.mem[addr])}
+		}
+	}
+	return nil
+}
+
+// compareStep compares the state visible after one instruction or block, written are
+// the addresses stored to, got and want are the characters printed meanwhile.
+func compareStep(cpu *LC3CPU, ref *refMachine, written []int, got, want []byte) string {
+	for r := R_R0; r <= R_R7; r++ {
+		if cpu.registers[r] != ref.reg[r] {
+			return fmt.Sprintf("R%d: got x%04X, want x%04X", r, cpu.registers[r], ref.reg[r])
+		}
+	}
+	if cpu.registers[R_PC] != ref.pc {
+		return fmt.Sprintf("PC: got x%04X, want x%04X", cpu.registers[R_PC], ref.pc)
+	}
+	if cpu.registers[R_COND] != ref.cond {
+		return fmt.Sprintf("COND: got %03b, want %03b", cpu.registers[R_COND], ref.cond)
+	}
+	if cpu.isRunning == ref.halted {
+		return fmt.Sprintf("running: got %v, want %v", cpu.isRunning, !ref.halted)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Sprintf("output: got %q, want %q", got, want)
+	}
+	for _, a := range written {
+		if cpu.RAM.Storage[a] != ref.mem[a] {
+			return fmt.Sprintf("memory x%04X: got x%04X, want x%04X", a, cpu.RAM.Storage[a], ref.mem[a])
+		}
+	}
+	return ""
+}
+
+// shrink reduces a failing case to a minimal one for which fails still reports true.
+func shrink(c diffCase, fails func(diffCase) bool) diffCase {
+	origin := binary.BigEndian.Uint16(c.image)
+	words := make([]uint16, 0, len(c.image)/2)
+	for i := 2; i+1 < len(c.image); i += 2 {
+		words = append(words, binary.BigEndian.Uint16(c.image[i:]))
+	}
+
+	try := func(w []uint16, regs [8]uint16, input []byte) bool {
+		candidate := c
+		candidate.image, candidate.regs, candidate.input = objectImage(origin, w), regs, input
+		if !fails(candidate) {
+			return false
+		}
+		c, words = candidate, w
+		return true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		// Drop single instructions
+		for i := len(words) - 1; i >= 0; i-- {
+			w := append(append([]uint16{}, words[:i]...), words[i+1:]...)
+			changed = try(w, c.regs, c.input) || changed
+		}
+		// Replace instructions by NOP
+		for i := range words {
+			if words[i] != 0 {
+				w := append([]uint16{}, words...)
+				w[i] = 0
+				changed = try(w, c.regs, c.input) || changed
+			}
+		}
+		// Clear initial registers
+		for r := range c.regs {
+			if c.regs[r] != 0 {
+				regs := c.regs
+				regs[r] = 0
+				changed = try(words, regs, c.input) || changed
+			}
+		}
+		// Drop key presses
+		for i := len(c.input) - 1; i >= 0; i-- {
+			input := append(append([]byte{}, c.input[:i]...), c.input[i+1:]...)
+			changed = try(words, c.regs, input) || changed
+		}
+	}
+	return c
+}
+
+var diffTrapVectors = []uint16{TRAP_GETC, TRAP_OUT, TRAP_PUTS, TRAP_IN, TRAP_PUTSP, TRAP_HALT}
+
+// randomCase generates a random instruction stream. Registers are biased towards the
+// program itself and the keyboard registers so that loads, stores and jumps hit
+// interesting addresses.
+func randomCase(r *rand.Rand) diffCase {
+	words := make([]uint16, 16+r.Intn(48))
+	for i := range words {
+		words[i] = uint16(r.Intn(1 << 16))
+		if words[i]>>12 == OP_TRAP {
+			// Mostly valid vectors, HALT is rare so that programs run for a while
+			vector := diffTrapVectors[r.Intn(len(diffTrapVectors)-1)]
+			if r.Intn(8) == 0 {
+				vector = uint16(r.Intn(0x100))
+			}
+			words[i] = OP_TRAP<<12 | vector
+		}
+	}
+
+	var regs [8]uint16
+	for i := range regs {
+		switch r.Intn(4) {
+		case 0:
+			regs[i] = uint16(r.Intn(1 << 16))
+		case 1:
+			regs[i] = PC_START + uint16(r.Intn(len(words)))
+		case 2:
+			regs[i] = MR_KBSR + uint16(r.Intn(3))
+		}
+	}
+
+	input := make([]byte, r.Intn(8))
+	r.Read(input)
+	return diffCase{image: objectImage(PC_START, words), regs: regs, input: input, steps: 256}
+}
+
+func TestDifferential_randomPrograms(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		c := randomCase(r)
+		c.engine = Engine(i % 3)
+		if d := runDifferential(c); d != nil {
+			minimal := shrink(c, func(c diffCase) bool { return runDifferential(c) != nil })
+			t.Fatalf("case %d diverges: %s\nminimal program:\n%s\nfirst divergence: %s",
+				i, d, minimal, runDifferential(minimal))
+		}
+	}
+}
+
+func TestDifferential_apps(t *testing.T) {
+	apps, err := filepath.Glob("../apps/*.obj")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, apps)
+
+	for _, app := range apps {
+		image, err := ioutil.ReadFile(app) //nolint: gosec
+		assert.Nil(t, err)
+
+		for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+			d := runDifferential(diffCase{
+				image:  image,
+				input:  []byte("wasdwwaassddy\nq"),
+				steps:  200000,
+				engine: engine,
+			})
+			assert.Nil(t, d, "%s, %v: %s", app, engine, d)
+		}
+	}
+}
+
+func TestDifferential_shrink(t *testing.T) {
+	c := diffCase{
+		image: objectImage(PC_START, []uint16{0x1234, 0xF021, 0xBEEF, 0x0000, 0x5555}),
+		regs:  [8]uint16{1, 2, 3, 4, 5, 6, 7, 8},
+		input: []byte("abc"),
+		steps: 16,
+	}
+	minimal := shrink(c, func(c diffCase) bool {
+		return bytes.Contains(c.image, []byte{0xBE, 0xEF})
+	})
+
+	assert.Equal(t, objectImage(PC_START, []uint16{0xBEEF}), minimal.image)
+	assert.Equal(t, [8]uint16{}, minimal.regs)
+	assert.Empty(t, minimal.input)
+}
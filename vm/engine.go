@@ -0,0 +1,229 @@
+package vm
+
+import "fmt"
+
+// Engine selects how LC3CPU executes instructions. All engines produce identical results.
+type Engine int
+
+// Execution engines.
+const (
+	// EngineInterpreter fetches and decodes every instruction on every execution.
+	EngineInterpreter Engine = iota
+	// EngineDecodeCache caches decoded instruction fields per address and executes them
+	// in batches.
+	EngineDecodeCache
+	// EngineThreaded translates straight-line runs of instructions into chains of Go closures.
+	EngineThreaded
+)
+
+var engineNames = map[Engine]string{
+	EngineInterpreter: "interpreter",
+	EngineDecodeCache: "cached",
+	EngineThreaded:    "threaded",
+}
+
+func (e Engine) String() string {
+	if name, ok := engineNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Engine(%d)", int(e))
+}
+
+// ParseEngine returns the engine with the given name.
+func ParseEngine(name string) (Engine, error) {
+	for e, n := range engineNames {
+		if n == name {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown engine: %s", name)
+}
+
+// SetEngine selects the execution engine. Caches of the previous engine are dropped.
+// Hooks observe every instruction, a CPU with hooks, for example installed by CollectStats,
+// StartProfile or StartCoverage, executes all instructions with the interpreter.
+func (v *LC3CPU) SetEngine(e Engine) {
+	v.engine = e
+	v.decodeCache = nil
+	v.code = nil
+
+	switch e {
+	case EngineDecodeCache:
+		v.decodeCache = &[MaxMemorySize]cachedInstruction{}
+	case EngineThreaded:
+		v.code = &codeCache{}
+	}
+}
+
+// maxBlockLength limits the number of instructions translated into a single block.
+const maxBlockLength = 32
+
+// blockBatch is the number of instructions runBlock executes between the checks of stop
+// requests.
+const blockBatch = 256
+
+// block is a translated straight-line run of instructions. Only its last instruction may change the PC.
+type block struct {
+	ops []operation
+}
+
+// operation is a translated instruction.
+type operation struct {
+	word uint16 // the word the operation was translated from
+	run  func(v *LC3CPU)
+}
+
+// codeCache holds translated blocks by their start address.
+type codeCache struct {
+	blocks [MaxMemorySize]*block
+}
+
+// runBlock executes chained blocks starting at the current PC until a batch of
+// instructions was executed, a trap or an instruction which has to be executed by step:
+// instructions fetched from memory mapped devices and all instructions of a CPU with hooks.
+func (v *LC3CPU) runBlock() {
+	budget := uint64(blockBatch)
+	if v.limit != 0 && v.limit-v.instructions < budget {
+		budget = v.limit - v.instructions
+	}
+	mem := &v.RAM.Storage
+
+chain:
+	for executed := uint64(0); ; {
+		pc := v.registers[R_PC]
+		if pc >= MR_KBSR || v.hooks != nil {
+			v.step()
+			return
+		}
+		b := v.code.blocks[pc]
+		if b == nil {
+			b = v.translate(pc)
+		}
+		if executed+uint64(len(b.ops)) > budget {
+			if executed == 0 {
+				v.step()
+			}
+			return
+		}
+
+		// Operations don't read the PC, only the last one may change it
+		v.registers[R_PC] = pc + uint16(len(b.ops))
+		for i, op := range b.ops {
+			// Comparing the word finds blocks made stale by any write, also to Storage
+			// and by a store of the block itself
+			if mem[pc+uint16(i)] != op.word {
+				v.code.blocks[pc] = nil
+				v.registers[R_PC] = pc + uint16(i)
+				executed += uint64(i)
+				continue chain
+			}
+			v.instructions++
+			op.run(v)
+		}
+		if !v.isRunning {
+			return
+		}
+		executed += uint64(len(b.ops))
+	}
+}
+
+// translate builds the block starting at start and registers it in the code cache.
+func (v *LC3CPU) translate(start uint16) *block {
+	b := &block{}
+	for pc := start; pc < MR_KBSR && len(b.ops) < maxBlockLength; pc++ {
+		instr := v.RAM.Storage[pc]
+		b.ops = append(b.ops, operation{word: instr, run: compile(instr, pc)})
+
+		switch instr >> 12 {
+		case OP_BR, OP_JMP, OP_JSR, OP_TRAP, OP_RTI, OP_RES:
+			v.code.blocks[start] = b
+			return b
+		}
+	}
+	v.code.blocks[start] = b
+	return b
+}
+
+// compile translates the instruction at pc into a closure with all operands and
+// PC relative addresses bound.
+func compile(instr, pc uint16) func(v *LC3CPU) {
+	d := decode(instr)
+	next := pc + 1
+	r0, r1, r2, offset := d.r0, d.r1, d.r2, d.offset
+
+	switch d.op {
+	case OP_ADD:
+		if d.imm {
+			return func(v *LC3CPU) { v.registers[r0] = v.registers[r1] + offset; v.updateFlags(r0) }
+		}
+		return func(v *LC3CPU) { v.registers[r0] = v.registers[r1] + v.registers[r2]; v.updateFlags(r0) }
+	case OP_AND:
+		if d.imm {
+			return func(v *LC3CPU) { v.registers[r0] = v.registers[r1] & offset; v.updateFlags(r0) }
+		}
+		return func(v *LC3CPU) { v.registers[r0] = v.registers[r1] & v.registers[r2]; v.updateFlags(r0) }
+	case OP_NOT:
+		return func(v *LC3CPU) { v.registers[r0] = ^v.registers[r1]; v.updateFlags(r0) }
+	case OP_BR:
+		return compileBranch(d.nzp, next+offset)
+	case OP_JMP:
+		return func(v *LC3CPU) { v.registers[R_PC] = v.registers[r1] }
+	case OP_JSR:
+		if d.imm {
+			target := next + offset
+			return func(v *LC3CPU) { v.registers[R_R7] = next; v.registers[R_PC] = target }
+		}
+		return func(v *LC3CPU) {
+			target := v.registers[r1]
+			v.registers[R_R7] = next
+			v.registers[R_PC] = target
+		}
+	case OP_TRAP:
+		return func(v *LC3CPU) {
+			v.currentInstruction, v.currentOperation = instr, OP_TRAP
+			v.trap()
+		}
+	default:
+		return compileMemory(d, next)
+	}
+}
+
+func compileBranch(nzp, target uint16) func(v *LC3CPU) {
+	switch nzp {
+	case 0:
+		return func(v *LC3CPU) {}
+	case FL_NEG | FL_ZRO | FL_POS:
+		return func(v *LC3CPU) { v.registers[R_PC] = target }
+	}
+	return func(v *LC3CPU) {
+		if nzp&v.registers[R_COND] != 0 {
+			v.registers[R_PC] = target
+		}
+	}
+}
+
+// compileMemory translates loads, stores, LEA and the unused opcodes.
+func compileMemory(d decodedInstruction, next uint16) func(v *LC3CPU) {
+	r0, r1, offset := d.r0, d.r1, d.offset
+	address := next + offset
+
+	switch d.op {
+	case OP_LD:
+		return func(v *LC3CPU) { v.registers[r0] = v.RAM.Read(address); v.updateFlags(r0) }
+	case OP_LDI:
+		return func(v *LC3CPU) { v.registers[r0] = v.RAM.Read(v.RAM.Read(address)); v.updateFlags(r0) }
+	case OP_LDR:
+		return func(v *LC3CPU) { v.registers[r0] = v.RAM.Read(v.registers[r1] + offset); v.updateFlags(r0) }
+	case OP_LEA:
+		return func(v *LC3CPU) { v.registers[r0] = address; v.updateFlags(r0) }
+	case OP_ST:
+		return func(v *LC3CPU) { v.RAM.Write(address, v.registers[r0]) }
+	case OP_STI:
+		return func(v *LC3CPU) { v.RAM.Write(v.RAM.Read(address), v.registers[r0]) }
+	case OP_STR:
+		return func(v *LC3CPU) { v.RAM.Write(v.registers[r1]+offset, v.registers[r0]) }
+
+	}
+	// RTI and the reserved opcode
+	return func(v *LC3CPU) {}
+}
@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newThreadedCPU(words ...uint16) *LC3CPU {
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &bytes.Buffer{})
+	vm.SetEngine(EngineThreaded)
+	for i, w := range words {
+		vm.RAM.Write(PC_START+uint16(i), w)
+	}
+	return vm
+}
+
+func TestParseEngine(t *testing.T) {
+	for _, e := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+		parsed, err := ParseEngine(e.String())
+		assert.Nil(t, err)
+		assert.Equal(t, e, parsed)
+	}
+
+	_, err := ParseEngine("jit")
+	assert.EqualError(t, err, "unknown engine: jit")
+	assert.Equal(t, "Engine(7)", Engine(7).String())
+}
+
+func TestLC3CPU_SetEngine_threaded(t *testing.T) {
+	vm := newThreadedCPU(
+		0b0001_000_000_1_00001, // ADD R0, R0, #1
+		0b0001_001_000_1_00001, // ADD R1, R0, #1
+		0b0000_111_000000001,   // BRnzp x3004
+		0b0001_000_000_1_01111, // ADD R0, R0, #15
+		0xF025,                 // HALT
+	)
+	assert.Equal(t, EngineThreaded, vm.Run().Engine)
+
+	assert.Equal(t, uint16(1), vm.registers[R_R0])
+	assert.Equal(t, uint16(2), vm.registers[R_R1])
+	assert.Equal(t, uint64(4), vm.instructions)
+
+	// Hooks make the engine fall back to the interpreter
+	vm.CollectStats(true)
+	assert.Equal(t, EngineInterpreter, vm.Run().Engine)
+	vm.CollectStats(false)
+	assert.NotNil(t, vm.code.blocks[0x3000])
+	assert.NotNil(t, vm.code.blocks[0x3004])
+	assert.Nil(t, vm.code.blocks[0x3003])
+
+	vm.SetEngine(EngineDecodeCache)
+	assert.Nil(t, vm.code)
+}
+
+func TestLC3CPU_runBlock_selfModifying(t *testing.T) {
+	// The store rewrites the next instruction of the block being executed
+	vm := newThreadedCPU(
+		0b0010_001_000000011,   // LD R1, x3004
+		0b0011_001_000000000,   // ST R1, x3002
+		0b0001_000_000_1_00001, // ADD R0, R0, #1
+		0xF025,                 // HALT
+		0b0001_000_000_1_00101, // ADD R0, R0, #5
+	)
+	vm.Run()
+	assert.Equal(t, uint16(5), vm.registers[R_R0])
+
+	// The second iteration executes a block which was rewritten by the first one
+	vm = newThreadedCPU(
+		0b0010_001_000000111,   // LD R1, x3008
+		0b0000_111_000000000,   // BRnzp LOOP
+		0b0001_000_000_1_00001, // LOOP ADD R0, R0, #1
+		0b0001_010_010_1_11111, // ADD R2, R2, #-1
+		0b0000_010_000000010,   // BRz DONE
+		0b0011_001_111111100,   // ST R1, LOOP
+		0b0000_111_111111011,   // BRnzp LOOP
+		0xF025,                 // DONE HALT
+		0b0001_000_000_1_00101, // ADD R0, R0, #5
+	)
+	vm.registers[R_R2] = 2
+	vm.Run()
+	assert.Equal(t, uint16(6), vm.registers[R_R0])
+}
+
+func TestLC3CPU_runBlock_stale(t *testing.T) {
+	vm := newThreadedCPU(
+		0b0001_000_000_1_00001, // ADD R0, R0, #1
+		0xF025,                 // HALT
+	)
+	vm.Run()
+	assert.Equal(t, uint16(1), vm.registers[R_R0])
+
+	vm.RAM.Write(0x3000, 0b0001_000_000_1_00010) // ADD R0, R0, #2
+	vm.Run()
+	assert.Equal(t, uint16(3), vm.registers[R_R0])
+
+	// Direct writes to the storage make blocks stale as well
+	vm.RAM.Storage[0x3000] = 0b0001_000_000_1_00100 // ADD R0, R0, #4
+	vm.Run()
+	assert.Equal(t, uint16(7), vm.registers[R_R0])
+	assert.Equal(t, uint16(0b0001_000_000_1_00100), vm.code.blocks[0x3000].ops[0].word)
+
+	// Restoring a snapshot replaces the whole memory
+	snapshot, err := vm.Snapshot()
+	assert.Nil(t, err)
+	assert.Nil(t, vm.Restore(snapshot))
+	assert.Nil(t, vm.code.blocks[0x3000])
+}
+
+func TestLC3CPU_Stop_engines(t *testing.T) {
+	// Chained blocks and batches still notice stop requests
+	for _, engine := range []Engine{EngineDecodeCache, EngineThreaded} {
+		vm := newThreadedCPU(0b0000_111_111111111) // BRnzp #-1
+		vm.SetEngine(engine)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			vm.Stop()
+		}()
+
+		result := vm.Run()
+		assert.Equal(t, StopRequested, result.Reason, "%v", engine)
+		assert.Equal(t, PC_START, result.PC, "%v", engine)
+		assert.Equal(t, result.Instructions, vm.Instructions(), "%v", engine)
+	}
+}
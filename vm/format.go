@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ObjectFormat is an encoding of object files.
+type ObjectFormat int
+
+// Object file formats. Besides the binary format, lc3tools and PennSim use text files
+// with the origin and then one word per line, as 4 hex digits or as 16 binary digits.
+const (
+	FormatObj ObjectFormat = iota // big-endian words
+	FormatHex                     // "3000"
+	FormatBin                     // "0011000000000000"
+)
+
+func (f ObjectFormat) String() string {
+	switch f {
+	case FormatObj:
+		return "obj"
+	case FormatHex:
+		return "hex"
+	case FormatBin:
+		return "bin"
+	}
+	return fmt.Sprintf("ObjectFormat(%d)", int(f))
+}
+
+// ParseObjectFormat parses the names returned by ObjectFormat.String.
+func ParseObjectFormat(s string) (ObjectFormat, error) {
+	for _, f := range []ObjectFormat{FormatObj, FormatHex, FormatBin} {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown object format %q", s)
+}
+
+// FormatOfPath returns the format of an object file by its extension, .hex and .bin are
+// text, everything else is binary.
+func FormatOfPath(path string) ObjectFormat {
+	f, err := ParseObjectFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return FormatObj
+	}
+	return f
+}
+
+// DetectObjectFormat guesses the format of an object file from its contents. Files whose
+// lines all hold 16 binary or 4 hex digits are text, anything else is binary.
+func DetectObjectFormat(b []byte) ObjectFormat {
+	lines := textLines(b)
+	if len(lines) == 0 {
+		return FormatObj
+	}
+	for _, f := range []ObjectFormat{FormatBin, FormatHex} {
+		matches := true
+		for _, l := range lines {
+			if _, err := parseTextWord(l.text, f); err != nil {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return f
+		}
+	}
+	return FormatObj
+}
+
+// ReadObject reads an object file in any format and returns it in the binary format. Text
+// formats are recognized by the extension .hex or .bin, or by their contents.
+func ReadObject(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path) //nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("can't read file: %w", err)
+	}
+	return decodeFile(path, b)
+}
+
+// ReadObjectFS is ReadObject for a file of a file system.
+func ReadObjectFS(fsys fs.FS, name string) ([]byte, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("can't read file: %w", err)
+	}
+	return decodeFile(name, b)
+}
+
+func decodeFile(name string, b []byte) ([]byte, error) {
+	f := FormatOfPath(name)
+	if f == FormatObj {
+		f = DetectObjectFormat(b)
+	}
+	return DecodeObject(b, f)
+}
+
+// DecodeObject converts an object file in format f to the binary format.
+func DecodeObject(b []byte, f ObjectFormat) ([]byte, error) {
+	if f == FormatObj {
+		return b, nil
+	}
+	lines := textLines(b)
+	if len(lines) == 0 {
+		return nil, ErrObjectTooShort
+	}
+	if len(lines) > MaxMemorySize+1 {
+		return nil, ErrObjectTooLarge
+	}
+	obj := make([]byte, 2*len(lines))
+	for i, l := range lines {
+		w, err := parseTextWord(l.text, f)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.n, err)
+		}
+		binary.BigEndian.PutUint16(obj[2*i:], w)
+	}
+	if int(binary.BigEndian.Uint16(obj))+len(lines)-1 > MaxMemorySize {
+		return nil, ErrObjectTooLarge
+	}
+	return obj, nil
+}
+
+// EncodeObject converts a binary object file to format f.
+func EncodeObject(obj []byte, f ObjectFormat) ([]byte, error) {
+	if len(obj) < 2 {
+		return nil, ErrObjectTooShort
+	}
+	if len(obj)%2 != 0 {
+		return nil, ErrObjectOddLength
+	}
+	if f == FormatObj {
+		return obj, nil
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(obj); i += 2 {
+		w := binary.BigEndian.Uint16(obj[i:])
+		if f == FormatHex {
+			fmt.Fprintf(&b, "%04X\n", w)
+		} else {
+			fmt.Fprintf(&b, "%016b\n", w)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// textLine is a non-empty line of a text object file.
+type textLine struct {
+	n    int
+	text string
+}
+
+// textLines returns the non-empty lines of a text object file, comments after ; are dropped.
+func textLines(b []byte) []textLine {
+	var lines []textLine
+	for i, l := range strings.Split(string(b), "\n") {
+		if c := strings.IndexByte(l, ';'); c >= 0 {
+			l = l[:c]
+		}
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, textLine{n: i + 1, text: l})
+		}
+	}
+	return lines
+}
+
+func parseTextWord(s string, f ObjectFormat) (uint16, error) {
+	digits, base := 4, 16
+	if f == FormatBin {
+		digits, base = 16, 2
+	}
+	if len(s) != digits {
+		return 0, fmt.Errorf("%q isn't a word of %d %s digits", s, digits, f)
+	}
+	w, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a word of %d %s digits", s, digits, f)
+	}
+	return uint16(w), nil
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var formatTestObject = []byte{0x30, 0x00, 0xE0, 0x02, 0xF0, 0x25}
+
+func TestEncodeObject(t *testing.T) {
+	b, err := EncodeObject(formatTestObject, FormatHex)
+	assert.Nil(t, err)
+	assert.Equal(t, "3000\nE002\nF025\n", string(b))
+
+	b, err = EncodeObject(formatTestObject, FormatBin)
+	assert.Nil(t, err)
+	assert.Equal(t, "0011000000000000\n1110000000000010\n1111000000100101\n", string(b))
+
+	_, err = EncodeObject([]byte{0x30, 0x00, 0x12}, FormatHex)
+	assert.Equal(t, ErrObjectOddLength, err)
+}
+
+func TestDecodeObject(t *testing.T) {
+	b, err := DecodeObject([]byte("3000 ; origin\n\ne002\r\nF025"), FormatHex)
+	assert.Nil(t, err)
+	assert.Equal(t, formatTestObject, b)
+
+	b, err = DecodeObject([]byte("0011000000000000\n1110000000000010\n1111000000100101\n"), FormatBin)
+	assert.Nil(t, err)
+	assert.Equal(t, formatTestObject, b)
+
+	_, err = DecodeObject([]byte("3000\nE00\n"), FormatHex)
+	assert.EqualError(t, err, `line 2: "E00" isn't a word of 4 hex digits`)
+	_, err = DecodeObject([]byte("\n"), FormatBin)
+	assert.Equal(t, ErrObjectTooShort, err)
+	_, err = DecodeObject([]byte("FFFF\n1234\n5678\n"), FormatHex)
+	assert.Equal(t, ErrObjectTooLarge, err)
+}
+
+func TestDetectObjectFormat(t *testing.T) {
+	assert.Equal(t, FormatHex, DetectObjectFormat([]byte("3000\nE002\n")))
+	assert.Equal(t, FormatBin, DetectObjectFormat([]byte("0011000000000000\n")))
+	assert.Equal(t, FormatObj, DetectObjectFormat(formatTestObject))
+	assert.Equal(t, FormatObj, DetectObjectFormat(nil))
+
+	assert.Equal(t, FormatHex, FormatOfPath("prog.HEX"))
+	assert.Equal(t, FormatBin, FormatOfPath("dir/prog.bin"))
+	assert.Equal(t, FormatObj, FormatOfPath("prog.obj"))
+
+	_, err := ParseObjectFormat("elf")
+	assert.NotNil(t, err)
+}
+
+func TestLC3RAM_Load_textFormats(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"prog.hex": "3000\nE002\nF025\n",
+		"prog.bin": "0011000000000000\n1110000000000010\n1111000000100101\n",
+		"hex.obj":  "3000\nE002\nF025\n", // detected by contents
+	} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0o644))
+
+		m := &LC3RAM{}
+		assert.Nil(t, m.Load(path), name)
+		assert.Equal(t, uint16(0xE002), m.Storage[0x3000], name)
+		assert.Equal(t, uint16(0xF025), m.Storage[0x3001], name)
+	}
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fuzzBudget bounds the number of instructions executed per fuzz input.
+const fuzzBudget = 1000
+
+// runFuzzed executes at most fuzzBudget instructions and checks CPU invariants after each one.
+func runFuzzed(t *testing.T, cpu *LC3CPU) {
+	cpu.registers[R_PC] = cpu.StartPosition
+	cpu.registers[R_COND] = FL_ZRO
+	cpu.isRunning = true
+
+	for i := 0; i < fuzzBudget && cpu.isRunning; i++ {
+		cpu.step()
+
+		switch cpu.registers[R_COND] {
+		case FL_NEG, FL_ZRO, FL_POS:
+		default:
+			t.Fatalf("R_COND must be exactly one of N, Z, P, got %03b after x%04X",
+				cpu.registers[R_COND], cpu.currentInstruction)
+		}
+	}
+}
+
+func newFuzzCPU(input []byte) *LC3CPU {
+	in := &scriptedInput{data: input}
+	return NewCPU(&LC3RAM{
+		CheckKey: in.ready,
+		GetChar:  in.next,
+	}, &bytes.Buffer{})
+}
+
+func FuzzLC3RAM_LoadObject(f *testing.F) {
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m := &LC3RAM{}
+		if err := m.LoadObject(b); err != nil {
+			return
+		}
+
+		origin := binary.BigEndian.Uint16(b)
+		for i := 2; i < len(b); i += 2 {
+			if m.Storage[origin] != binary.BigEndian.Uint16(b[i:]) {
+				t.Fatalf("word %d is not loaded at x%04X", i/2-1, origin)
+			}
+			origin++
+		}
+	})
+}
+
+func FuzzLC3CPU_instructions(f *testing.F) {
+	f.Fuzz(func(t *testing.T, program []byte, input []byte) {
+		cpu := newFuzzCPU(input)
+		for i := 0; i+1 < len(program); i += 2 {
+			cpu.RAM.Write(PC_START+uint16(i/2), binary.BigEndian.Uint16(program[i:]))
+		}
+		runFuzzed(t, cpu)
+	})
+}
+
+func FuzzLC3CPU_memoryImage(f *testing.F) {
+	f.Fuzz(func(t *testing.T, origin uint16, image []byte, start uint16, input []byte) {
+		cpu := newFuzzCPU(input)
+		// The image wraps around the end of the memory
+		address := origin
+		for i := 0; i+1 < len(image); i += 2 {
+			cpu.RAM.Write(address, binary.BigEndian.Uint16(image[i:]))
+			address++
+		}
+		cpu.StartPosition = start
+		runFuzzed(t, cpu)
+	})
+}
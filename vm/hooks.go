@@ -0,0 +1,110 @@
+package vm
+
+// Hooks observe the execution of a CPU. Callbacks which are nil are skipped, a CPU without
+// hooks doesn't pay for them. Hooks run on the goroutine executing the CPU.
+type Hooks struct {
+	// BeforeInstruction is called after instr was fetched from pc, AfterInstruction after it was executed.
+	BeforeInstruction func(pc, instr uint16)
+	AfterInstruction  func(pc, instr uint16)
+	// MemoryRead and MemoryWrite are called for data accesses of instructions and trap
+	// routines, instruction fetches are reported by BeforeInstruction. device is true for
+	// the memory mapped device registers.
+	MemoryRead  func(address, value uint16, device bool)
+	MemoryWrite func(address, value uint16, device bool)
+	// TrapEnter and TrapExit are called around the service routine of a TRAP instruction.
+	TrapEnter func(vector uint16)
+	TrapExit  func(vector uint16)
+	// Interrupt is called when an interrupt is accepted. The VM has no interrupting
+	// devices yet, so it is never called.
+	Interrupt func(vector uint16)
+	// Halt is called when the program halts with the HALT trap.
+	Halt func()
+}
+
+// hookList dispatches events to all registered hooks.
+type hookList []*Hooks
+
+// AddHooks registers h, the callbacks are called in the order the hooks were added.
+func (v *LC3CPU) AddHooks(h *Hooks) {
+	v.setHooks(append(append(hookList{}, v.hooks...), h))
+}
+
+// RemoveHooks unregisters h.
+func (v *LC3CPU) RemoveHooks(h *Hooks) {
+	var hooks hookList
+	for _, o := range v.hooks {
+		if o != h {
+			hooks = append(hooks, o)
+		}
+	}
+	v.setHooks(hooks)
+}
+
+func (v *LC3CPU) setHooks(hooks hookList) {
+	if len(hooks) == 0 {
+		hooks = nil
+	}
+	v.hooks = hooks
+	v.RAM.hooks = hooks
+}
+
+// isDevice reports whether address belongs to the device register page.
+func isDevice(address uint16) bool {
+	return address >= MR_KBSR
+}
+
+func (l hookList) beforeInstruction(pc, instr uint16) {
+	for _, h := range l {
+		if h.BeforeInstruction != nil {
+			h.BeforeInstruction(pc, instr)
+		}
+	}
+}
+
+func (l hookList) afterInstruction(pc, instr uint16) {
+	for _, h := range l {
+		if h.AfterInstruction != nil {
+			h.AfterInstruction(pc, instr)
+		}
+	}
+}
+
+func (l hookList) memoryRead(address, value uint16) {
+	for _, h := range l {
+		if h.MemoryRead != nil {
+			h.MemoryRead(address, value, isDevice(address))
+		}
+	}
+}
+
+func (l hookList) memoryWrite(address, value uint16) {
+	for _, h := range l {
+		if h.MemoryWrite != nil {
+			h.MemoryWrite(address, value, isDevice(address))
+		}
+	}
+}
+
+func (l hookList) trapEnter(vector uint16) {
+	for _, h := range l {
+		if h.TrapEnter != nil {
+			h.TrapEnter(vector)
+		}
+	}
+}
+
+func (l hookList) trapExit(vector uint16) {
+	for _, h := range l {
+		if h.TrapExit != nil {
+			h.TrapExit(vector)
+		}
+	}
+}
+
+func (l hookList) halt() {
+	for _, h := range l {
+		if h.Halt != nil {
+			h.Halt()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLC3CPU_AddHooks(t *testing.T) {
+	for _, engine := range []Engine{EngineInterpreter, EngineDecodeCache, EngineThreaded} {
+		vm := NewCPU(&LC3RAM{
+			CheckKey: KeyPressedMock(true),
+			GetChar:  GetTestChar,
+		}, &bytes.Buffer{})
+		vm.SetEngine(engine)
+		vm.RAM.Write(0x3000, 0b1010_000_000000010) // LDI R0, KBSR
+		vm.RAM.Write(0x3001, 0b0011_000_000000010) // ST R0, x3004
+		vm.RAM.Write(0x3002, 0xF025)               // HALT
+		vm.RAM.Write(0x3003, MR_KBSR)
+
+		var events []string
+		record := func(format string, args ...interface{}) {
+			events = append(events, fmt.Sprintf(format, args...))
+		}
+		hooks := &Hooks{
+			BeforeInstruction: func(pc, instr uint16) { record("before x%04X x%04X", pc, instr) },
+			AfterInstruction:  func(pc, instr uint16) { record("after x%04X", pc) },
+			MemoryRead:        func(a, v uint16, device bool) { record("read x%04X x%04X %v", a, v, device) },
+			MemoryWrite:       func(a, v uint16, device bool) { record("write x%04X x%04X %v", a, v, device) },
+			TrapEnter:         func(vector uint16) { record("trap x%02X", vector) },
+			TrapExit:          func(vector uint16) { record("trap exit x%02X", vector) },
+			Halt:              func() { record("halt") },
+		}
+		vm.AddHooks(hooks)
+		vm.Run()
+
+		assert.Equal(t, []string{
+			"before x3000 xA002",
+			"read x3003 xFE00 false",
+			"read xFE00 x8000 true",
+			"after x3000",
+			"before x3001 x3002",
+			"write x3004 x8000 false",
+			"after x3001",
+			"before x3002 xF025",
+			"trap x25",
+			"halt",
+			"trap exit x25",
+			"after x3002",
+		}, events, "%v", engine)
+
+		vm.RemoveHooks(hooks)
+		assert.Nil(t, vm.hooks)
+		assert.Nil(t, vm.RAM.hooks)
+		events = nil
+		vm.Run()
+		assert.Empty(t, events)
+	}
+}
+
+func TestLC3CPU_RemoveHooks(t *testing.T) {
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &bytes.Buffer{})
+	var calls []int
+	first := &Hooks{Halt: func() { calls = append(calls, 1) }}
+	second := &Hooks{Halt: func() { calls = append(calls, 2) }}
+	vm.AddHooks(first)
+	vm.AddHooks(second)
+	vm.StartProfile()
+	vm.StartCoverage()
+	assert.Len(t, vm.hooks, 4)
+
+	vm.trapHalt()
+	vm.RemoveHooks(first)
+	vm.StopProfile()
+	vm.StopCoverage()
+	vm.trapHalt()
+	assert.Equal(t, []int{1, 2, 2}, calls)
+	assert.Equal(t, hookList{second}, vm.hooks)
+}
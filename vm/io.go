@@ -7,28 +7,74 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-// CheckKeyPressed checks if a key was pressed.
-func CheckKeyPressed() bool {
-	fi, _ := os.Stdin.Stat()
-	return fi.Size() > 0
+// Terminal is a keyboard reading from a terminal or any other file.
+type Terminal struct {
+	file *os.File
 }
 
-// GetCharFromStdin get one char from standard input.
-func GetCharFromStdin() uint16 {
-	// fd 0 is stdin
-	state, err := terminal.MakeRaw(0)
+// NewTerminal creates keyboard reading from file.
+func NewTerminal(file *os.File) *Terminal {
+	return &Terminal{file: file}
+}
+
+// CheckKey checks if a key was pressed.
+func (t *Terminal) CheckKey() bool {
+	fi, err := t.file.Stat()
+	return err == nil && fi.Size() > 0
+}
+
+// GetChar gets one char, the terminal is switched to raw mode while reading.
+func (t *Terminal) GetChar() uint16 {
+	fd := int(t.file.Fd())
+	state, err := terminal.MakeRaw(fd)
 	if err != nil {
 		log.Fatalln("setting stdin to raw:", err)
 	}
 	defer func() {
-		if err := terminal.Restore(0, state); err != nil {
+		if err := terminal.Restore(fd, state); err != nil {
 			log.Println("warning, failed to restore terminal:", err)
 		}
 	}()
 
 	b := make([]byte, 1)
-	if _, err := os.Stdin.Read(b); err != nil {
+	if _, err := t.file.Read(b); err != nil {
 		log.Println("warning, failed to read from stdin:", err)
 	}
 	return uint16(b[0])
 }
+
+// CheckKeyPressed checks if a key was pressed on standard input.
+func CheckKeyPressed() bool {
+	return NewTerminal(os.Stdin).CheckKey()
+}
+
+// GetCharFromStdin get one char from standard input.
+func GetCharFromStdin() uint16 {
+	return NewTerminal(os.Stdin).GetChar()
+}
+
+// Keyboard is a keyboard typing a fixed input, one key is pressed at a time.
+type Keyboard struct {
+	input []byte
+	pos   int
+}
+
+// NewKeyboard creates keyboard which types input.
+func NewKeyboard(input []byte) *Keyboard {
+	return &Keyboard{input: input}
+}
+
+// CheckKey checks if there are keys left to press.
+func (k *Keyboard) CheckKey() bool {
+	return k.pos < len(k.input)
+}
+
+// GetChar returns the next key, 0 when the whole input was typed.
+func (k *Keyboard) GetChar() uint16 {
+	if k.pos >= len(k.input) {
+		return 0
+	}
+	c := k.input[k.pos]
+	k.pos++
+	return uint16(c)
+}
@@ -0,0 +1,16 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyboard(t *testing.T) {
+	k := NewKeyboard([]byte("hi"))
+	assert.True(t, k.CheckKey())
+	assert.Equal(t, uint16('h'), k.GetChar())
+	assert.Equal(t, uint16('i'), k.GetChar())
+	assert.False(t, k.CheckKey())
+	assert.Equal(t, uint16(0), k.GetChar())
+}
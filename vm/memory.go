@@ -2,18 +2,25 @@ package vm
 
 import (
 	"encoding/binary"
-	"io/ioutil"
-	"log"
+	"errors"
+	"io/fs"
 )
 
 // MaxMemorySize maximum RAM size.
-const MaxMemorySize uint16 = 65535
+const MaxMemorySize = 1 << 16
 
 const (
 	MR_KBSR uint16 = 0xfe00 // keyboard status
 	MR_KBDR uint16 = 0xfe02 // keyboard data
 )
 
+// Object file errors.
+var (
+	ErrObjectTooShort  = errors.New("object file is too short, origin is missing")
+	ErrObjectOddLength = errors.New("object file has odd length")
+	ErrObjectTooLarge  = errors.New("object file does not fit into memory")
+)
+
 // CheckKey checks is keyboard key has been pressed.
 type CheckKey func() bool
 
@@ -25,15 +32,32 @@ type LC3RAM struct {
 	CheckKey
 	GetChar
 	Storage [MaxMemorySize]uint16
+	// Debug describes the loaded program, Load attaches it when the object file has
+	// debug information. It may be nil.
+	Debug *DebugInfo
+
+	hooks hookList
 }
 
 // Write writes value to memory on specified address.
 func (m *LC3RAM) Write(address, val uint16) {
 	m.Storage[address] = val
+	if m.hooks != nil {
+		m.hooks.memoryWrite(address, val)
+	}
 }
 
 // Read reads a value from memory.
 func (m *LC3RAM) Read(address uint16) uint16 {
+	val := m.fetch(address)
+	if m.hooks != nil {
+		m.hooks.memoryRead(address, val)
+	}
+	return val
+}
+
+// fetch reads a value from memory without notifying hooks, it is used for instruction fetches.
+func (m *LC3RAM) fetch(address uint16) uint16 {
 	if address == MR_KBSR {
 		if m.CheckKey() {
 			m.Storage[MR_KBSR] = 1 << 15
@@ -47,14 +71,47 @@ func (m *LC3RAM) Read(address uint16) uint16 {
 }
 
 // Load loads program into the memory.
-func (m *LC3RAM) Load(path string) {
-	b, err := ioutil.ReadFile(path) //nolint: gosec
+func (m *LC3RAM) Load(path string) error {
+	b, err := ReadObject(path)
+	if err != nil {
+		return err
+	}
+	if err := m.LoadObject(b); err != nil {
+		return err
+	}
+	m.Debug, err = LoadDebugInfo(path, b)
+	return err
+}
+
+// LoadFS is Load for an object file of a file system, like the programs embedded by the apps package.
+func (m *LC3RAM) LoadFS(fsys fs.FS, name string) error {
+	b, err := ReadObjectFS(fsys, name)
 	if err != nil {
-		log.Fatalf("Can't read file, reason: %v", err)
+		return err
+	}
+	if err := m.LoadObject(b); err != nil {
+		return err
+	}
+	m.Debug, err = LoadDebugInfoFS(fsys, name, b)
+	return err
+}
+
+// LoadObject loads object file contents into the memory.
+// The first word is the origin, the following words are placed at consecutive addresses.
+func (m *LC3RAM) LoadObject(b []byte) error {
+	if len(b) < 2 {
+		return ErrObjectTooShort
+	}
+	if len(b)%2 != 0 {
+		return ErrObjectOddLength
+	}
+	origin := int(binary.BigEndian.Uint16(b[:2]))
+	if origin+(len(b)-2)/2 > MaxMemorySize {
+		return ErrObjectTooLarge
 	}
-	origin := binary.BigEndian.Uint16(b[:2])
 	for i := 2; i < len(b); i += 2 {
-		m.Storage[origin] = binary.BigEndian.Uint16(b[i : i+2])
+		m.Write(uint16(origin), binary.BigEndian.Uint16(b[i:i+2]))
 		origin++
 	}
+	return nil
 }
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -9,7 +10,40 @@ import (
 const testChar = uint16(0x41) // "A"
 
 func TestLC3RAM_Load(t *testing.T) {
-	t.Skip()
+	m := &LC3RAM{}
+
+	assert.Nil(t, m.Load("../apps/hello-world.obj"))
+	assert.Equal(t, uint16(0xE002), m.Storage[0x3000])
+	assert.Equal(t, uint16('H'), m.Storage[0x3003])
+
+	assert.NotNil(t, m.Load("../apps/missing.obj"))
+}
+
+func TestLC3RAM_LoadFS(t *testing.T) {
+	m := &LC3RAM{}
+	fsys := fstest.MapFS{
+		"prog.obj": {Data: []byte{0x40, 0x00, 0x12, 0x34}},
+		"prog.hex": {Data: []byte("4000\n5678\n")},
+	}
+
+	assert.Nil(t, m.LoadFS(fsys, "prog.obj"))
+	assert.Equal(t, uint16(0x1234), m.Storage[0x4000])
+	assert.Nil(t, m.Debug)
+	assert.Nil(t, m.LoadFS(fsys, "prog.hex"))
+	assert.Equal(t, uint16(0x5678), m.Storage[0x4000])
+
+	assert.NotNil(t, m.LoadFS(fsys, "missing.obj"))
+}
+
+func TestLC3RAM_LoadObject(t *testing.T) {
+	m := &LC3RAM{}
+
+	assert.Nil(t, m.LoadObject([]byte{0xFF, 0xFF, 0x12, 0x34}))
+	assert.Equal(t, uint16(0x1234), m.Storage[0xFFFF])
+
+	assert.Equal(t, ErrObjectTooShort, m.LoadObject([]byte{0x30}))
+	assert.Equal(t, ErrObjectOddLength, m.LoadObject([]byte{0x30, 0x00, 0x12}))
+	assert.Equal(t, ErrObjectTooLarge, m.LoadObject([]byte{0xFF, 0xFF, 0x12, 0x34, 0x56, 0x78}))
 }
 
 func TestLC3RAM_Read(t *testing.T) {
@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Field numbers of perftools.profiles.Profile, see
+// https://github.com/google/pprof/blob/master/proto/profile.proto
+const (
+	pprofSampleType  = 1
+	pprofSample      = 2
+	pprofLocation    = 4
+	pprofFunction    = 5
+	pprofStringTable = 6
+	pprofPeriodType  = 11
+	pprofPeriod      = 12
+)
+
+// protoBuffer is a minimal protocol buffers encoder, just enough for profile.proto.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) uint64Field(tag int, x uint64) {
+	b.varint(uint64(tag) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) bytesField(tag int, data []byte) {
+	b.varint(uint64(tag)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) packedField(tag int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytesField(tag, packed.data)
+}
+
+// pprofWriter deduplicates strings, functions and locations while the profile is encoded.
+type pprofWriter struct {
+	profile   protoBuffer
+	strings   map[string]uint64
+	functions map[uint16]uint64
+	locations map[uint32]uint64
+}
+
+func (w *pprofWriter) str(s string) uint64 {
+	id, ok := w.strings[s]
+	if !ok {
+		id = uint64(len(w.strings))
+		w.strings[s] = id
+		w.profile.bytesField(pprofStringTable, []byte(s))
+	}
+	return id
+}
+
+func (w *pprofWriter) valueType(tag int, typ, unit string) {
+	var vt protoBuffer
+	vt.uint64Field(1, w.str(typ))
+	vt.uint64Field(2, w.str(unit))
+	w.profile.bytesField(tag, vt.data)
+}
+
+// function returns the id of the subroutine starting at entry.
+func (w *pprofWriter) function(entry uint16) uint64 {
+	id, ok := w.functions[entry]
+	if !ok {
+		id = uint64(len(w.functions) + 1)
+		w.functions[entry] = id
+
+		var f protoBuffer
+		f.uint64Field(1, id)
+		f.uint64Field(2, w.str(fmt.Sprintf("x%04X", entry)))
+		w.profile.bytesField(pprofFunction, f.data)
+	}
+	return id
+}
+
+// location returns the id of address inside the subroutine starting at entry.
+// The address doubles as the line number, so that pprof can show per address costs.
+func (w *pprofWriter) location(address, entry uint16) uint64 {
+	key := uint32(address)<<16 | uint32(entry)
+	id, ok := w.locations[key]
+	if !ok {
+		id = uint64(len(w.locations) + 1)
+		w.locations[key] = id
+
+		var line protoBuffer
+		line.uint64Field(1, w.function(entry))
+		line.uint64Field(2, uint64(address))
+
+		var l protoBuffer
+		l.uint64Field(1, id)
+		l.uint64Field(3, uint64(address))
+		l.bytesField(4, line.data)
+		w.profile.bytesField(pprofLocation, l.data)
+	}
+	return id
+}
+
+// WritePprof writes the profile as gzipped protobuf understood by "go tool pprof".
+// Every call stack of every executed address is a sample, the value is the number of executions.
+func (p *Profile) WritePprof(out io.Writer) error {
+	w := &pprofWriter{
+		strings:   map[string]uint64{},
+		functions: map[uint16]uint64{},
+		locations: map[uint32]uint64{},
+	}
+	// The first string in the table has to be empty
+	w.str("")
+	w.valueType(pprofSampleType, "instructions", "count")
+	w.valueType(pprofPeriodType, "instructions", "count")
+	w.profile.uint64Field(pprofPeriod, 1)
+
+	for _, n := range p.nodes() {
+		addresses := make([]uint16, 0, len(n.samples))
+		for a := range n.samples {
+			addresses = append(addresses, a)
+		}
+		sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+
+		for _, a := range addresses {
+			stack := []uint64{w.location(a, n.entry)}
+			for c := n; c.parent != nil; c = c.parent {
+				stack = append(stack, w.location(c.callSite, c.parent.entry))
+			}
+
+			var s protoBuffer
+			s.packedField(1, stack)
+			s.packedField(2, []uint64{n.samples[a]})
+			w.profile.bytesField(pprofSample, s.data)
+		}
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := gz.Write(w.profile.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
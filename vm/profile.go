@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// maxProfileDepth limits call stacks of programs which use JSR without ever returning.
+const maxProfileDepth = 256
+
+// Profile counts executed instructions per address and attributes them to subroutines.
+// Subroutines are entered with JSR or JSRR and left with RET (JMP R7) to the saved return address.
+// Every instruction is counted as one cycle.
+type Profile struct {
+	Total  uint64
+	Counts [MaxMemorySize]uint64
+
+	root    *callNode
+	current *callNode
+	hooks   *Hooks
+}
+
+// callNode is a subroutine on a particular call stack.
+type callNode struct {
+	parent     *callNode
+	entry      uint16 // first address of the subroutine
+	callSite   uint16 // address of the JSR or JSRR in the parent
+	returnAddr uint16
+	depth      int
+	calls      uint64
+	children   map[uint32]*callNode // by call site and entry
+	samples    map[uint16]uint64    // instructions executed per address
+}
+
+func newCallNode(parent *callNode, entry, callSite uint16) *callNode {
+	depth := 0
+	if parent != nil {
+		depth = parent.depth + 1
+	}
+	return &callNode{
+		depth:      depth,
+		parent:     parent,
+		entry:      entry,
+		callSite:   callSite,
+		returnAddr: callSite + 1,
+		children:   map[uint32]*callNode{},
+		samples:    map[uint16]uint64{},
+	}
+}
+
+// SubroutineStats are the cycles attributed to a single subroutine.
+type SubroutineStats struct {
+	Entry uint16
+	Calls uint64
+	Self  uint64 // cycles spent in the subroutine itself
+	Total uint64 // cycles spent in the subroutine and everything it called
+}
+
+// StartProfile enables profiling. The first executed instruction becomes the root of all call stacks.
+func (v *LC3CPU) StartProfile() *Profile {
+	v.StopProfile()
+	p := &Profile{}
+	p.hooks = &Hooks{AfterInstruction: func(pc, instr uint16) { p.record(pc, instr, v.registers[R_PC]) }}
+	v.AddHooks(p.hooks)
+	v.profile = p
+	return p
+}
+
+// StopProfile disables profiling.
+func (v *LC3CPU) StopProfile() {
+	if v.profile != nil {
+		v.RemoveHooks(v.profile.hooks)
+		v.profile = nil
+	}
+}
+
+// record accounts instruction instr at pc, next is the PC after its execution.
+func (p *Profile) record(pc, instr, next uint16) {
+	if p.current == nil {
+		p.root = newCallNode(nil, pc, pc)
+		p.current = p.root
+	}
+	p.Total++
+	p.Counts[pc]++
+	p.current.samples[pc]++
+
+	switch instr >> 12 {
+	case OP_JSR:
+		if p.current.depth == maxProfileDepth {
+			return
+		}
+		key := uint32(pc)<<16 | uint32(next)
+		child, ok := p.current.children[key]
+		if !ok {
+			child = newCallNode(p.current, next, pc)
+			p.current.children[key] = child
+		}
+		child.calls++
+		p.current = child
+	case OP_JMP:
+		if (instr>>6)&0x7 != R_R7 {
+			return
+		}
+		// RET leaves every subroutine up to the one which returns to next
+		for n := p.current; n != p.root; n = n.parent {
+			if n.returnAddr == next {
+				p.current = n.parent
+				return
+			}
+		}
+	}
+}
+
+// nodes returns all call stack nodes in a stable order.
+func (p *Profile) nodes() []*callNode {
+	if p.root == nil {
+		return nil
+	}
+	nodes := []*callNode{p.root}
+	for i := 0; i < len(nodes); i++ {
+		children := make([]*callNode, 0, len(nodes[i].children))
+		for _, c := range nodes[i].children {
+			children = append(children, c)
+		}
+		sort.Slice(children, func(a, b int) bool {
+			if children[a].entry != children[b].entry {
+				return children[a].entry < children[b].entry
+			}
+			return children[a].callSite < children[b].callSite
+		})
+		nodes = append(nodes, children...)
+	}
+	return nodes
+}
+
+// Subroutines returns cycles per subroutine, the most expensive one by self cycles first.
+// The code executed outside of any subroutine is reported under the first executed address.
+func (p *Profile) Subroutines() []SubroutineStats {
+	stats := map[uint16]*SubroutineStats{}
+	get := func(entry uint16) *SubroutineStats {
+		s, ok := stats[entry]
+		if !ok {
+			s = &SubroutineStats{Entry: entry}
+			stats[entry] = s
+		}
+		return s
+	}
+
+	for _, n := range p.nodes() {
+		var self uint64
+		for _, c := range n.samples {
+			self += c
+		}
+		get(n.entry).Self += self
+		get(n.entry).Calls += n.calls
+
+		// Recursive subroutines are accounted once per stack
+		seen := map[uint16]bool{}
+		for a := n; a != nil; a = a.parent {
+			if !seen[a.entry] {
+				seen[a.entry] = true
+				get(a.entry).Total += self
+			}
+		}
+	}
+
+	result := make([]SubroutineStats, 0, len(stats))
+	for _, s := range stats {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Self != result[j].Self {
+			return result[i].Self > result[j].Self
+		}
+		return result[i].Entry < result[j].Entry
+	})
+	return result
+}
+
+// WriteReport writes a ranked text report of the top hottest addresses and subroutines.
+func (p *Profile) WriteReport(w io.Writer, top int) error {
+	type hotspot struct {
+		address uint16
+		count   uint64
+	}
+	var hotspots []hotspot
+	for a, c := range p.Counts {
+		if c > 0 {
+			hotspots = append(hotspots, hotspot{uint16(a), c})
+		}
+	}
+	sort.SliceStable(hotspots, func(i, j int) bool { return hotspots[i].count > hotspots[j].count })
+	if len(hotspots) > top {
+		hotspots = hotspots[:top]
+	}
+
+	subroutines := p.Subroutines()
+	if len(subroutines) > top {
+		subroutines = subroutines[:top]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Instructions executed: %d\n\n", p.Total)
+	fmt.Fprintln(tw, "count\tpercent\taddress\t")
+	for _, h := range hotspots {
+		fmt.Fprintf(tw, "%d\t%.2f%%\tx%04X\t\n", h.count, p.percent(h.count), h.address)
+	}
+	fmt.Fprintln(tw, "\nself\tself%\ttotal\ttotal%\tcalls\tsubroutine\t")
+	for _, s := range subroutines {
+		fmt.Fprintf(tw, "%d\t%.2f%%\t%d\t%.2f%%\t%d\tx%04X\t\n",
+			s.Self, p.percent(s.Self), s.Total, p.percent(s.Total), s.Calls, s.Entry)
+	}
+	return tw.Flush()
+}
+
+func (p *Profile) percent(n uint64) float64 {
+	if p.Total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(p.Total)
+}
@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loadMultiplyProgram loads a program which calls a multiply-by-repeated-add subroutine twice.
+func loadMultiplyProgram(vm *LC3CPU) {
+	vm.RAM.Write(0x3000, 0b0101_000_000_1_00000) // AND R0, R0, #0
+	vm.RAM.Write(0x3001, 0b0001_001_000_1_00011) // ADD R1, R0, #3
+	vm.RAM.Write(0x3002, 0b0100_1_00000000011)   // JSR MUL
+	vm.RAM.Write(0x3003, 0b0100_1_00000000010)   // JSR MUL
+	vm.RAM.Write(0x3004, 0xF025)                 // HALT
+	vm.RAM.Write(0x3006, 0b0001_000_000_1_00010) // MUL ADD R0, R0, #2
+	vm.RAM.Write(0x3007, 0b0001_001_001_1_11111) // ADD R1, R1, #-1
+	vm.RAM.Write(0x3008, 0b0000_001_111111101)   // BRp MUL
+	vm.RAM.Write(0x3009, 0b1100_000_111_000000)  // RET
+}
+
+func TestLC3CPU_StartProfile(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	loadMultiplyProgram(vm)
+
+	p := vm.StartProfile()
+	vm.Run()
+	vm.StopProfile()
+
+	assert.Equal(t, uint64(19), p.Total)
+	assert.Equal(t, uint64(4), p.Counts[0x3006])
+	assert.Equal(t, uint64(1), p.Counts[0x3004])
+	assert.Equal(t, []SubroutineStats{
+		{Entry: 0x3006, Calls: 2, Self: 14, Total: 14},
+		{Entry: 0x3000, Calls: 0, Self: 5, Total: 19},
+	}, p.Subroutines())
+
+	var report bytes.Buffer
+	assert.Nil(t, p.WriteReport(&report, 3))
+	assert.Contains(t, report.String(), "Instructions executed: 19")
+	assert.Equal(t, 3+2+2+3, strings.Count(report.String(), "\n"))
+
+	var pprof bytes.Buffer
+	assert.Nil(t, p.WritePprof(&pprof))
+	gz, err := gzip.NewReader(&pprof)
+	assert.Nil(t, err)
+	raw, err := ioutil.ReadAll(gz)
+	assert.Nil(t, err)
+	assert.Contains(t, string(raw), "x3006")
+	assert.Contains(t, string(raw), "instructions")
+}
@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// refMachine is a deliberately simple LC-3 interpreter written straight from the ISA
+// description. It shares no code with LC3CPU and is only used to cross-check it.
+type refMachine struct {
+	mem    [1 << 16]uint16
+	reg    [8]uint16
+	pc     uint16
+	cond   uint16
+	halted bool
+	out    bytes.Buffer
+	in     *scriptedInput
+
+	// lastWrite is the address written by the last step or -1.
+	lastWrite int
+}
+
+func newRefMachine(in *scriptedInput) *refMachine {
+	return &refMachine{pc: 0x3000, cond: FL_ZRO, in: in, lastWrite: -1}
+}
+
+// load places an object image (origin word followed by data) into memory.
+func (m *refMachine) load(image []byte) {
+	origin := uint16(image[0])<<8 | uint16(image[1])
+	for i := 2; i+1 < len(image); i += 2 {
+		m.mem[origin] = uint16(image[i])<<8 | uint16(image[i+1])
+		origin++
+	}
+}
+
+func (m *refMachine) read(addr uint16) uint16 {
+	if addr == 0xFE00 {
+		if m.in.ready() {
+			m.mem[0xFE00] = 0x8000
+			m.mem[0xFE02] = m.in.next()
+		} else {
+			m.mem[0xFE00] = 0
+		}
+	}
+	return m.mem[addr]
+}
+
+func (m *refMachine) write(addr, val uint16) {
+	m.mem[addr] = val
+	m.lastWrite = int(addr)
+}
+
+func (m *refMachine) setcc(dr, val uint16) {
+	m.reg[dr] = val
+	switch {
+	case val == 0:
+		m.cond = FL_ZRO
+	case int16(val) < 0:
+		m.cond = FL_NEG
+	default:
+		m.cond = FL_POS
+	}
+}
+
+// sext sign extends the lowest bits of ir.
+func sext(ir uint16, bits uint) uint16 {
+	shift := 16 - bits
+	return uint16(int16(ir<<shift) >> shift)
+}
+
+func (m *refMachine) step() {
+	m.lastWrite = -1
+	ir := m.read(m.pc)
+	m.pc++
+
+	dr := ir >> 9 & 7
+	sr1 := ir >> 6 & 7
+	operand := m.reg[ir&7]
+	if ir&0x20 != 0 {
+		operand = sext(ir, 5)
+	}
+
+	switch ir >> 12 {
+	case 0x0: // BR
+		n, z, p := ir&0x800 != 0, ir&0x400 != 0, ir&0x200 != 0
+		if n && m.cond == FL_NEG || z && m.cond == FL_ZRO || p && m.cond == FL_POS {
+			m.pc += sext(ir, 9)
+		}
+	case 0x1: // ADD
+		m.setcc(dr, m.reg[sr1]+operand)
+	case 0x2: // LD
+		m.setcc(dr, m.read(m.pc+sext(ir, 9)))
+	case 0x3: // ST
+		m.write(m.pc+sext(ir, 9), m.reg[dr])
+	case 0x4: // JSR, JSRR
+		ret := m.pc
+		if ir&0x800 != 0 {
+			m.pc += sext(ir, 11)
+		} else {
+			m.pc = m.reg[sr1]
+		}
+		m.reg[7] = ret
+	case 0x5: // AND
+		m.setcc(dr, m.reg[sr1]&operand)
+	case 0x6: // LDR
+		m.setcc(dr, m.read(m.reg[sr1]+sext(ir, 6)))
+	case 0x7: // STR
+		m.write(m.reg[sr1]+sext(ir, 6), m.reg[dr])
+	case 0x9: // NOT
+		m.setcc(dr, ^m.reg[sr1])
+	case 0xA: // LDI
+		m.setcc(dr, m.read(m.read(m.pc+sext(ir, 9))))
+	case 0xB: // STI
+		m.write(m.read(m.pc+sext(ir, 9)), m.reg[dr])
+	case 0xC: // JMP, RET
+		m.pc = m.reg[sr1]
+	case 0xE: // LEA
+		m.setcc(dr, m.pc+sext(ir, 9))
+	case 0xF: // TRAP
+		m.reg[7] = m.pc
+		m.trap(ir & 0xFF)
+	case 0x8, 0xD: // RTI and the reserved opcode are ignored, there is no supervisor mode
+	}
+}
+
+func (m *refMachine) trap(vector uint16) {
+	switch vector {
+	case 0x20: // GETC
+		m.reg[0] = m.in.next()
+	case 0x21: // OUT
+		m.out.WriteRune(rune(m.reg[0]))
+	case 0x22: // PUTS
+		for a := m.reg[0]; ; a++ {
+			w := m.read(a)
+			if w == 0 {
+				break
+			}
+			m.out.WriteRune(rune(w))
+		}
+	case 0x23: // IN
+		m.out.WriteString("Input a character: ")
+		m.reg[0] = m.in.next()
+		m.out.WriteRune(rune(m.reg[0]))
+	case 0x24: // PUTSP
+		for a := m.reg[0]; ; a++ {
+			w := m.read(a)
+			if w == 0 {
+				break
+			}
+			m.out.WriteRune(rune(w & 0xFF))
+			if w>>8 != 0 {
+				m.out.WriteRune(rune(w >> 8))
+			}
+		}
+	case 0x25: // HALT
+		m.out.WriteString("HALT\n")
+		m.halted = true
+	}
+}
+
+// scriptedInput replays a fixed sequence of key presses, once exhausted no key is pressed.
+type scriptedInput struct {
+	data []byte
+	pos  int
+}
+
+func (s *scriptedInput) ready() bool {
+	return s.pos < len(s.data)
+}
+
+func (s *scriptedInput) next() uint16 {
+	if !s.ready() {
+		return 0
+	}
+	c := s.data[s.pos]
+	s.pos++
+	return uint16(c)
+}
+
+// objectImage builds an object image from an origin and words.
+func objectImage(origin uint16, words []uint16) []byte {
+	b := make([]byte, 2+2*len(words))
+	binary.BigEndian.PutUint16(b, origin)
+	for i, w := range words {
+		binary.BigEndian.PutUint16(b[2+2*i:], w)
+	}
+	return b
+}
@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const replayHeader = "lc3-replay 1"
+
+// ErrReplayHeader is returned when a replay file has an unknown header.
+var ErrReplayHeader = errors.New("not an LC-3 replay file")
+
+// InputEvent is a character delivered to the program and the number of the
+// instruction which consumed it.
+type InputEvent struct {
+	Instruction uint64
+	Char        uint16
+}
+
+// InputRecorder records every character delivered through KBDR or the input traps.
+type InputRecorder struct {
+	cpu     *LC3CPU
+	getChar GetChar
+	Events  []InputEvent
+}
+
+// RecordInput starts recording keyboard input of the CPU.
+func (v *LC3CPU) RecordInput() *InputRecorder {
+	r := &InputRecorder{cpu: v, getChar: v.RAM.GetChar}
+	v.RAM.GetChar = r.recordChar
+	return r
+}
+
+func (r *InputRecorder) recordChar() uint16 {
+	c := r.getChar()
+	r.Events = append(r.Events, InputEvent{Instruction: r.cpu.instructions, Char: c})
+	return c
+}
+
+// InputReplayer feeds recorded characters to the CPU at the same instructions they were consumed.
+type InputReplayer struct {
+	cpu    *LC3CPU
+	events []InputEvent
+	pos    int
+	err    error
+}
+
+// ReplayInput replaces keyboard input of the CPU with recorded events.
+// The CPU is stopped when the program asks for more input than was recorded.
+func (v *LC3CPU) ReplayInput(events []InputEvent) *InputReplayer {
+	r := &InputReplayer{cpu: v, events: events}
+	v.RAM.CheckKey = r.checkKey
+	v.RAM.GetChar = r.replayChar
+	return r
+}
+
+// Err reports the first point where the replayed run diverged from the recording.
+func (r *InputReplayer) Err() error {
+	return r.err
+}
+
+func (r *InputReplayer) checkKey() bool {
+	return r.pos < len(r.events) && r.events[r.pos].Instruction <= r.cpu.instructions
+}
+
+func (r *InputReplayer) replayChar() uint16 {
+	if r.pos == len(r.events) {
+		if r.err == nil {
+			r.err = fmt.Errorf("instruction %d: input requested after the end of the recording", r.cpu.instructions)
+		}
+		r.cpu.Stop()
+		return 0
+	}
+
+	e := r.events[r.pos]
+	r.pos++
+	if e.Instruction != r.cpu.instructions && r.err == nil {
+		r.err = fmt.Errorf("instruction %d: input was recorded at instruction %d", r.cpu.instructions, e.Instruction)
+	}
+	return e.Char
+}
+
+// WriteReplay writes input events in the replay file format, one event per line.
+func WriteReplay(w io.Writer, events []InputEvent) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bw, replayHeader); err != nil {
+		return err
+	}
+	for _, e := range events {
+		if _, err := fmt.Fprintf(bw, "%d %d\n", e.Instruction, e.Char); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadReplay reads input events written by WriteReplay.
+func ReadReplay(r io.Reader) ([]InputEvent, error) {
+	s := bufio.NewScanner(r)
+	if !s.Scan() || s.Text() != replayHeader {
+		return nil, ErrReplayHeader
+	}
+
+	var events []InputEvent
+	for line := 2; s.Scan(); line++ {
+		var e InputEvent
+		if _, err := fmt.Sscanf(s.Text(), "%d %d", &e.Instruction, &e.Char); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, s.Err()
+}
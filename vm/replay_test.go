@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loadEchoProgram loads a program which twice polls KBSR, echoes KBDR and then echoes a GETC character.
+func loadEchoProgram(vm *LC3CPU) {
+	vm.RAM.Write(0x3000, 0b1010_001_000001111)   // LDI R1, x3010
+	vm.RAM.Write(0x3001, 0b0000_011_111111110)   // BRzp #-2
+	vm.RAM.Write(0x3002, 0b1010_000_000001110)   // LDI R0, x3011
+	vm.RAM.Write(0x3003, 0xF021)                 // OUT
+	vm.RAM.Write(0x3004, 0xF020)                 // GETC
+	vm.RAM.Write(0x3005, 0xF021)                 // OUT
+	vm.RAM.Write(0x3006, 0b0001_010_010_1_11111) // ADD R2, R2, #-1
+	vm.RAM.Write(0x3007, 0b0000_001_111111000)   // BRp #-8
+	vm.RAM.Write(0x3008, 0xF025)                 // HALT
+	vm.RAM.Write(0x3010, MR_KBSR)
+	vm.RAM.Write(0x3011, MR_KBDR)
+	vm.registers[R_R2] = 2
+}
+
+func TestLC3CPU_RecordInput(t *testing.T) {
+	var out bytes.Buffer
+
+	// A key is only pressed on every third poll
+	polls := 0
+	input := &scriptedInput{data: []byte("abcd")}
+	vm := NewCPU(&LC3RAM{
+		CheckKey: func() bool {
+			polls++
+			return polls%3 == 0
+		},
+		GetChar: input.next,
+	}, &out)
+	loadEchoProgram(vm)
+
+	recorder := vm.RecordInput()
+	vm.Run()
+	assert.Equal(t, "abcdHALT\n", out.String())
+	assert.Len(t, recorder.Events, 4)
+
+	var file bytes.Buffer
+	assert.Nil(t, WriteReplay(&file, recorder.Events))
+	events, err := ReadReplay(&file)
+	assert.Nil(t, err)
+	assert.Equal(t, recorder.Events, events)
+
+	var replayed bytes.Buffer
+	replay := NewCPU(&LC3RAM{
+		CheckKey: func() bool { panic("live input must not be used") },
+		GetChar:  func() uint16 { panic("live input must not be used") },
+	}, &replayed)
+	loadEchoProgram(replay)
+
+	replayer := replay.ReplayInput(events)
+	replay.Run()
+	assert.Nil(t, replayer.Err())
+	assert.Equal(t, out.String(), replayed.String())
+	assert.Equal(t, vm.registers, replay.registers)
+	assert.Equal(t, vm.instructions, replay.instructions)
+	assert.Equal(t, vm.RAM.Storage, replay.RAM.Storage)
+}
+
+func TestLC3CPU_ReplayInput(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{}, &out)
+	loadEchoProgram(vm)
+
+	replayer := vm.ReplayInput([]InputEvent{{Instruction: 7, Char: 'x'}})
+	vm.Run()
+
+	assert.NotNil(t, replayer.Err())
+	assert.Equal(t, "x", out.String())
+}
+
+func TestReadReplay(t *testing.T) {
+	_, err := ReadReplay(strings.NewReader("garbage\n"))
+	assert.Equal(t, ErrReplayHeader, err)
+
+	_, err = ReadReplay(strings.NewReader(replayHeader + "\n10 x\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,151 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StopReason tells why Run or Resume returned.
+type StopReason int
+
+// Stop reasons.
+const (
+	StopHalt             StopReason = iota // the program executed the HALT trap
+	StopRequested                          // Stop was called
+	StopInstructionLimit                   // the limit of SetInstructionLimit was reached
+	StopOutputError                        // a trap couldn't write its output, see RunResult.Err
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopHalt:
+		return "halt"
+	case StopRequested:
+		return "stop requested"
+	case StopInstructionLimit:
+		return "instruction limit"
+	case StopOutputError:
+		return "output error"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// RunResult describes a single Run or Resume.
+type RunResult struct {
+	Reason       StopReason
+	PC           uint16 // address of the next instruction
+	Instructions uint64 // executed by this run
+	Duration     time.Duration
+	// Engine executed the run. Hooks make every engine fall back to the interpreter.
+	Engine Engine
+	// Err is the error of StopOutputError.
+	Err error
+	// Stats is only collected when enabled with CollectStats.
+	Stats *Stats
+}
+
+var opcodeNames = [...]string{
+	OP_BR: "BR", OP_ADD: "ADD", OP_LD: "LD", OP_ST: "ST", OP_JSR: "JSR", OP_AND: "AND", OP_LDR: "LDR", OP_STR: "STR",
+	OP_RTI: "RTI", OP_NOT: "NOT", OP_LDI: "LDI", OP_STI: "STI", OP_JMP: "JMP", OP_RES: "RES", OP_LEA: "LEA",
+	OP_TRAP: "TRAP",
+}
+
+var trapNames = map[uint16]string{
+	TRAP_GETC: "GETC", TRAP_OUT: "OUT", TRAP_PUTS: "PUTS", TRAP_IN: "IN", TRAP_PUTSP: "PUTSP", TRAP_HALT: "HALT",
+}
+
+// OpcodeName returns the mnemonic of an opcode, JSR and JSRR as well as JMP and RET share their opcodes.
+func OpcodeName(op uint16) string {
+	return opcodeNames[op&0xF]
+}
+
+// TrapName returns the name of a trap vector, unknown vectors are formatted as hex.
+func TrapName(vector uint16) string {
+	if name, ok := trapNames[vector]; ok {
+		return name
+	}
+	return fmt.Sprintf("x%02X", vector)
+}
+
+// Stats counts what a run executed.
+type Stats struct {
+	Opcodes [16]uint64        // instructions by opcode
+	Traps   map[uint16]uint64 // TRAP instructions by vector
+	// MemoryTouched is the number of bytes of distinct words fetched, read or written.
+	MemoryTouched int
+
+	touched *[MaxMemorySize]bool
+	hooks   *Hooks
+}
+
+// CollectStats enables or disables Stats in the results of Run and Resume.
+func (v *LC3CPU) CollectStats(enabled bool) {
+	if v.stats != nil {
+		v.RemoveHooks(v.stats.hooks)
+		v.stats = nil
+	}
+	if !enabled {
+		return
+	}
+
+	s := &Stats{}
+	s.reset()
+	s.hooks = &Hooks{
+		BeforeInstruction: func(pc, instr uint16) {
+			s.Opcodes[instr>>12]++
+			s.touch(pc)
+		},
+		MemoryRead:  func(address, _ uint16, _ bool) { s.touch(address) },
+		MemoryWrite: func(address, _ uint16, _ bool) { s.touch(address) },
+		TrapEnter:   func(vector uint16) { s.Traps[vector]++ },
+	}
+	v.AddHooks(s.hooks)
+	v.stats = s
+}
+
+func (s *Stats) reset() {
+	s.Opcodes = [16]uint64{}
+	s.Traps = map[uint16]uint64{}
+	s.MemoryTouched = 0
+	s.touched = &[MaxMemorySize]bool{}
+}
+
+func (s *Stats) touch(address uint16) {
+	if !s.touched[address] {
+		s.touched[address] = true
+		s.MemoryTouched += 2
+	}
+}
+
+// WriteSummary writes a human readable summary of the run.
+func (r RunResult) WriteSummary(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "stopped:       %v at x%04X\ninstructions:  %d\ntime:          %v (%.0f instructions/s)\n"+
+		"engine:        %v\n",
+		r.Reason, r.PC, r.Instructions, r.Duration, float64(r.Instructions)/r.Duration.Seconds(), r.Engine)
+	if err != nil || r.Stats == nil {
+		return err
+	}
+
+	var opcodes []string
+	for op, n := range r.Stats.Opcodes {
+		if n > 0 {
+			opcodes = append(opcodes, fmt.Sprintf("%s %d", OpcodeName(uint16(op)), n))
+		}
+	}
+	vectors := make([]uint16, 0, len(r.Stats.Traps))
+	for vector := range r.Stats.Traps {
+		vectors = append(vectors, vector)
+	}
+	sort.Slice(vectors, func(i, j int) bool { return vectors[i] < vectors[j] })
+	traps := make([]string, len(vectors))
+	for i, vector := range vectors {
+		traps[i] = fmt.Sprintf("%s %d", TrapName(vector), r.Stats.Traps[vector])
+	}
+
+	_, err = fmt.Fprintf(w, "memory:        %d bytes touched\nopcodes:       %s\ntraps:         %s\n",
+		r.Stats.MemoryTouched, strings.Join(opcodes, ", "), strings.Join(traps, ", "))
+	return err
+}
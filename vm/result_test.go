@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLC3CPU_Run_result(t *testing.T) {
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &bytes.Buffer{})
+	vm.Memory().WriteWords(0x3000,
+		0b0010_000_000000011, // LD R0, x3004
+		0xF021,               // OUT
+		0xF0FF,               // TRAP xFF
+		0xF025,               // HALT
+		'!',
+	)
+	vm.CollectStats(true)
+
+	r := vm.Run()
+	assert.Equal(t, StopHalt, r.Reason)
+	assert.Equal(t, uint16(0x3004), r.PC)
+	assert.Equal(t, uint64(4), r.Instructions)
+	assert.NotZero(t, r.Duration)
+	assert.Equal(t, uint64(1), r.Stats.Opcodes[OP_LD])
+	assert.Equal(t, uint64(3), r.Stats.Opcodes[OP_TRAP])
+	assert.Equal(t, map[uint16]uint64{TRAP_OUT: 1, 0xFF: 1, TRAP_HALT: 1}, r.Stats.Traps)
+	assert.Equal(t, 10, r.Stats.MemoryTouched)
+
+	var summary bytes.Buffer
+	assert.Nil(t, r.WriteSummary(&summary))
+	assert.True(t, strings.HasPrefix(summary.String(), "stopped:       halt at x3004\ninstructions:  4\n"))
+	assert.Contains(t, summary.String(), "engine:        interpreter\n")
+	assert.Contains(t, summary.String(), "memory:        10 bytes touched\n"+
+		"opcodes:       LD 1, TRAP 3\ntraps:         OUT 1, HALT 1, xFF 1\n")
+
+	// Statistics are collected per run
+	vm.SetInstructionLimit(vm.Instructions() + 2)
+	r = vm.Run()
+	assert.Equal(t, StopInstructionLimit, r.Reason)
+	assert.Equal(t, uint16(0x3002), r.PC)
+	assert.Equal(t, uint64(2), r.Instructions)
+	assert.Equal(t, map[uint16]uint64{TRAP_OUT: 1}, r.Stats.Traps)
+
+	vm.CollectStats(false)
+	vm.SetInstructionLimit(0)
+	vm.Stop()
+	r = vm.Resume()
+	assert.Equal(t, StopRequested, r.Reason)
+	assert.Zero(t, r.Instructions)
+	assert.Nil(t, r.Stats)
+	assert.Nil(t, vm.hooks)
+}
+
+func TestStopReason_String(t *testing.T) {
+	assert.Equal(t, "instruction limit", StopInstructionLimit.String())
+	assert.Equal(t, "output error", StopOutputError.String())
+	assert.Equal(t, "StopReason(9)", StopReason(9).String())
+}
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Snapshot.
+const SnapshotVersion uint16 = 1
+
+var snapshotMagic = [4]byte{'L', 'C', '3', 'S'}
+
+// Snapshot errors.
+var (
+	ErrSnapshotMagic     = errors.New("not an LC-3 snapshot")
+	ErrSnapshotVersion   = errors.New("unsupported snapshot version")
+	ErrSnapshotCorrupted = errors.New("snapshot is corrupted")
+)
+
+// snapshotHeader is the fixed part of a snapshot, it is followed by the memory
+// contents and a CRC-32 of everything before the checksum. All words are big endian.
+type snapshotHeader struct {
+	Magic     [4]byte
+	Version   uint16
+	Registers [R_PC]uint16 // R0-R7
+	PC        uint16
+	PSR       uint16
+	// Keyboard device, a character latched in KBDR while the ready bit of KBSR
+	// is set is input which has not been consumed by the program yet.
+	KBSR uint16
+	KBDR uint16
+}
+
+var snapshotSize = binary.Size(snapshotHeader{}) + 2*MaxMemorySize + crc32.Size
+
+// Snapshot captures the full machine state: registers, PSR, memory and keyboard
+// device. The same state always produces the same bytes.
+func (v *LC3CPU) Snapshot() ([]byte, error) {
+	h := snapshotHeader{
+		Magic:   snapshotMagic,
+		Version: SnapshotVersion,
+		PC:      v.registers[R_PC],
+		PSR:     v.PSR(),
+		KBSR:    v.RAM.Storage[MR_KBSR],
+		KBDR:    v.RAM.Storage[MR_KBDR],
+	}
+	copy(h.Registers[:], v.registers[:R_PC])
+
+	buf := bytes.NewBuffer(make([]byte, 0, snapshotSize))
+	if err := binary.Write(buf, binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.BigEndian, v.RAM.Storage[:]); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes())); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore replaces the machine state with a snapshot taken by Snapshot.
+// The CPU is left untouched when the snapshot can't be decoded.
+func (v *LC3CPU) Restore(b []byte) error {
+	if len(b) < len(snapshotMagic) || !bytes.Equal(b[:len(snapshotMagic)], snapshotMagic[:]) {
+		return ErrSnapshotMagic
+	}
+	var h snapshotHeader
+	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, &h); err != nil {
+		return ErrSnapshotCorrupted
+	}
+	if h.Version != SnapshotVersion {
+		return ErrSnapshotVersion
+	}
+	if len(b) != snapshotSize {
+		return ErrSnapshotCorrupted
+	}
+	sum := b[len(b)-crc32.Size:]
+	if binary.BigEndian.Uint32(sum) != crc32.ChecksumIEEE(b[:len(b)-crc32.Size]) {
+		return ErrSnapshotCorrupted
+	}
+
+	memory := b[binary.Size(h) : len(b)-crc32.Size]
+	for i := range v.RAM.Storage {
+		v.RAM.Storage[i] = binary.BigEndian.Uint16(memory[2*i:])
+	}
+	v.RAM.Storage[MR_KBSR] = h.KBSR
+	v.RAM.Storage[MR_KBDR] = h.KBDR
+
+	copy(v.registers[:R_PC], h.Registers[:])
+	v.registers[R_PC] = h.PC
+	v.registers[R_COND] = h.PSR & (FL_NEG | FL_ZRO | FL_POS)
+	// Memory was replaced behind the back of the execution engine
+	v.SetEngine(v.engine)
+	return nil
+}
@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLC3CPU_Snapshot(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	assert.Nil(t, vm.RAM.Load("../apps/hello-world.obj"))
+	vm.Run()
+
+	first, err := vm.Snapshot()
+	assert.Nil(t, err)
+	second, err := vm.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+
+	restored := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	assert.Nil(t, restored.Restore(first))
+	assert.Equal(t, vm.registers, restored.registers)
+	assert.Equal(t, vm.RAM.Storage, restored.RAM.Storage)
+
+	third, err := restored.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, first, third)
+}
+
+func TestLC3CPU_Restore(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+
+	// Count R0 down from 3 and halt, snapshot is taken before the second iteration
+	vm.RAM.Write(0x3000, 0b0101_000_000_1_00000) // AND R0, R0, #0
+	vm.RAM.Write(0x3001, 0b0001_000_000_1_00011) // ADD R0, R0, #3
+	vm.RAM.Write(0x3002, 0b0001_000_000_1_11111) // ADD R0, R0, #-1
+	vm.RAM.Write(0x3003, 0b0000_001_111111110)   // BRp #-2
+	vm.RAM.Write(0x3004, 0xF025)                 // HALT
+	vm.registers[R_PC] = PC_START
+	for i := 0; i < 4; i++ {
+		vm.step()
+	}
+
+	snapshot, err := vm.Snapshot()
+	assert.Nil(t, err)
+
+	resumed := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	assert.Nil(t, resumed.Restore(snapshot))
+	assert.Equal(t, uint16(0x3002), resumed.registers[R_PC])
+	assert.Equal(t, FL_POS, resumed.registers[R_COND])
+
+	resumed.Resume()
+	assert.Equal(t, uint16(0), resumed.registers[R_R0])
+	assert.Equal(t, "HALT\n", out.String())
+
+	assert.Equal(t, ErrSnapshotMagic, resumed.Restore([]byte("nope")))
+
+	corrupted := append([]byte{}, snapshot...)
+	corrupted[100]++
+	assert.Equal(t, ErrSnapshotCorrupted, resumed.Restore(corrupted))
+	assert.Equal(t, ErrSnapshotCorrupted, resumed.Restore(snapshot[:len(snapshot)-1]))
+
+	future := append([]byte{}, snapshot...)
+	future[5]++
+	assert.Equal(t, ErrSnapshotVersion, resumed.Restore(future))
+}
+
+func TestLC3CPU_Stop(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &out)
+	vm.RAM.Write(0x3000, 0b0000_111_111111111) // BRnzp #-1
+
+	vm.Stop()
+	vm.Run()
+
+	assert.False(t, vm.isRunning)
+	assert.Equal(t, PC_START, vm.registers[R_PC])
+}
@@ -0,0 +1,107 @@
+package vm
+
+// State is the register state of the CPU.
+type State struct {
+	Registers [R_PC]uint16 // R0-R7
+	PC        uint16
+	Cond      uint16 // one of FL_NEG, FL_ZRO or FL_POS
+}
+
+// State returns all registers at once.
+func (v *LC3CPU) State() State {
+	s := State{PC: v.registers[R_PC], Cond: v.registers[R_COND]}
+	copy(s.Registers[:], v.registers[:R_PC])
+	return s
+}
+
+// SetState sets all registers at once.
+func (v *LC3CPU) SetState(s State) {
+	copy(v.registers[:R_PC], s.Registers[:])
+	v.registers[R_PC] = s.PC
+	v.registers[R_COND] = s.Cond
+}
+
+// Reg returns the value of register r, one of R_R0 to R_COND.
+func (v *LC3CPU) Reg(r uint16) uint16 {
+	return v.registers[r]
+}
+
+// SetReg sets register r, one of R_R0 to R_COND, to val.
+func (v *LC3CPU) SetReg(r, val uint16) {
+	v.registers[r] = val
+}
+
+// PC returns the program counter, the address of the next instruction.
+func (v *LC3CPU) PC() uint16 {
+	return v.registers[R_PC]
+}
+
+// SetPC sets the program counter, Resume continues at address.
+func (v *LC3CPU) SetPC(address uint16) {
+	v.registers[R_PC] = address
+}
+
+// Cond returns the condition codes, one of FL_NEG, FL_ZRO or FL_POS.
+func (v *LC3CPU) Cond() uint16 {
+	return v.registers[R_COND]
+}
+
+// PSR returns the processor status register. The VM has no privilege levels or
+// interrupt priorities, so only the condition codes are set.
+func (v *LC3CPU) PSR() uint16 {
+	return v.registers[R_COND] & (FL_NEG | FL_ZRO | FL_POS)
+}
+
+// Running reports whether the CPU executes instructions. Like the other accessors it
+// must not be called from another goroutine while the CPU runs.
+func (v *LC3CPU) Running() bool {
+	return v.isRunning
+}
+
+// Memory returns a view of the memory as the CPU sees it.
+func (v *LC3CPU) Memory() MemoryView {
+	return MemoryView{ram: v.RAM}
+}
+
+// MemoryView accesses memory through the device bus: reading the keyboard registers
+// polls the keyboard and writes notify the memory hooks.
+type MemoryView struct {
+	ram *LC3RAM
+}
+
+// Read reads a word the way LD does.
+func (m MemoryView) Read(address uint16) uint16 {
+	return m.ram.Read(address)
+}
+
+// Write writes a word the way ST does.
+func (m MemoryView) Write(address, val uint16) {
+	m.ram.Write(address, val)
+}
+
+// Peek reads a word without device side effects, device registers hold their last value.
+func (m MemoryView) Peek(address uint16) uint16 {
+	return m.ram.Storage[address]
+}
+
+// Words returns n words starting at address without device side effects, addresses wrap
+// around after xFFFF.
+func (m MemoryView) Words(address uint16, n int) []uint16 {
+	words := make([]uint16, n)
+	for i := range words {
+		words[i] = m.ram.Storage[address+uint16(i)]
+	}
+	return words
+}
+
+// WriteWords writes consecutive words starting at address.
+func (m MemoryView) WriteWords(address uint16, words ...uint16) {
+	for i, w := range words {
+		m.ram.Write(address+uint16(i), w)
+	}
+}
+
+// Location describes an address by the source line of the loaded program, see DebugInfo.Location.
+func (v *LC3CPU) Location(address uint16) string {
+	return v.RAM.Debug.Location(address)
+}
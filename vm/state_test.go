@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLC3CPU_State(t *testing.T) {
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(false),
+		GetChar:  GetTestChar,
+	}, &bytes.Buffer{})
+	vm.Memory().WriteWords(0x4000,
+		0b0001_000_000_0_00_001, // ADD R0, R0, R1
+		0xF025,                  // HALT
+	)
+
+	vm.SetState(State{Registers: [R_PC]uint16{1, 0xFFFE}, PC: 0x4000, Cond: FL_POS})
+	assert.Equal(t, uint16(0xFFFE), vm.Reg(R_R1))
+	assert.Equal(t, uint16(0x4000), vm.PC())
+	assert.Equal(t, FL_POS, vm.Cond())
+	assert.False(t, vm.Running())
+
+	vm.Resume()
+	assert.Equal(t, State{Registers: [R_PC]uint16{0xFFFF, 0xFFFE, 0, 0, 0, 0, 0, 0x4002}, PC: 0x4002, Cond: FL_NEG},
+		vm.State())
+	assert.Equal(t, FL_NEG, vm.PSR())
+	assert.True(t, vm.Halted())
+
+	vm.SetReg(R_R3, 7)
+	vm.SetPC(0x4001)
+	assert.Equal(t, uint16(7), vm.State().Registers[R_R3])
+	assert.Equal(t, uint16(0x4001), vm.State().PC)
+}
+
+func TestMemoryView(t *testing.T) {
+	vm := NewCPU(&LC3RAM{
+		CheckKey: KeyPressedMock(true),
+		GetChar:  GetTestChar,
+	}, &bytes.Buffer{})
+	mem := vm.Memory()
+
+	assert.Equal(t, uint16(0), mem.Peek(MR_KBSR))
+	assert.Equal(t, uint16(1<<15), mem.Read(MR_KBSR))
+	assert.Equal(t, []uint16{1 << 15, 0, testChar}, mem.Words(MR_KBSR, 3))
+
+	mem.Write(0xFFFF, 1)
+	mem.WriteWords(0xFFFF, 1, 2)
+	assert.Equal(t, []uint16{1, 2}, mem.Words(0xFFFF, 2))
+	assert.Equal(t, uint16(2), vm.RAM.Storage[0])
+}